@@ -0,0 +1,250 @@
+// Package checkpoint snapshots the git working tree to hidden refs and
+// restores it, without touching the user's index, branches or stash.
+//
+// A checkpoint is a commit (parented on HEAD) whose tree is the working tree
+// at snapshot time: tracked files plus untracked files that are not ignored.
+// Checkpoints live under refs/tatsu/checkpoints/, so they never show up in
+// `git branch` or `git log --all` by default and are not pushed.
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RefPrefix is the namespace all checkpoint refs live under.
+const RefPrefix = "refs/tatsu/checkpoints/"
+
+// excludePathspec keeps tatsu's own state directory out of snapshots and
+// restores.
+const excludePathspec = ":(exclude).tatsu"
+
+// Checkpoint is a snapshot stored under RefPrefix.
+type Checkpoint struct {
+	Ref     string // full ref name
+	Name    string // ref name without RefPrefix
+	SHA     string
+	Created time.Time
+	Message string
+}
+
+// Repo runs git plumbing commands in a work tree.
+type Repo struct {
+	root string
+}
+
+// Open returns a Repo for the git work tree containing dir.
+func Open(dir string) (*Repo, error) {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s is not inside a git work tree", dir)
+	}
+	return &Repo{root: strings.TrimSpace(string(out))}, nil
+}
+
+// Root returns the top-level directory of the work tree.
+func (r *Repo) Root() string {
+	return r.root
+}
+
+// Snapshot records the current working tree as a checkpoint commit under
+// RefPrefix+name and returns its SHA.
+func (r *Repo) Snapshot(ctx context.Context, name, message string) (string, error) {
+	tree, err := r.WorkTree(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"commit-tree", tree, "-m", message}
+	if head, err := r.git(ctx, nil, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		args = append(args, "-p", head)
+	}
+	sha, err := r.git(ctx, identityEnv(), args...)
+	if err != nil {
+		return "", fmt.Errorf("create checkpoint commit: %w", err)
+	}
+
+	if _, err := r.git(ctx, nil, "update-ref", RefPrefix+name, sha); err != nil {
+		return "", fmt.Errorf("update checkpoint ref: %w", err)
+	}
+	return sha, nil
+}
+
+// WorkTree writes the current working tree (tracked and untracked,
+// non-ignored files) as a git tree object and returns its hash. The user's
+// index is left untouched.
+func (r *Repo) WorkTree(ctx context.Context) (string, error) {
+	env, cleanup, err := r.tempIndex()
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	// Seed from HEAD so the add only has to hash changed files
+	if _, err := r.git(ctx, nil, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		if _, err := r.git(ctx, env, "read-tree", "HEAD"); err != nil {
+			return "", fmt.Errorf("read HEAD tree: %w", err)
+		}
+	}
+	if _, err := r.git(ctx, env, "add", "-A", "--", ".", excludePathspec); err != nil {
+		return "", fmt.Errorf("stage working tree: %w", err)
+	}
+	tree, err := r.git(ctx, env, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("write tree: %w", err)
+	}
+	return tree, nil
+}
+
+// ChangedFiles returns the paths that differ between two trees (e.g. from
+// WorkTree), sorted.
+func (r *Repo) ChangedFiles(ctx context.Context, from, to string) ([]string, error) {
+	out, err := r.git(ctx, nil, "diff-tree", "-r", "--name-only", "--no-renames", from, to)
+	if err != nil {
+		return nil, err
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// Diff returns the patch between two trees (e.g. from WorkTree) without
+// context lines.
+func (r *Repo) Diff(ctx context.Context, from, to string) (string, error) {
+	return r.git(ctx, nil, "diff-tree", "-r", "-p", "-U0", "--no-renames", "--no-color", from, to)
+}
+
+// Restore makes the working tree match the checkpoint rev (a SHA, full ref
+// or checkpoint name): files are rewritten to their checkpointed content and
+// files created since the checkpoint are removed. Ignored files and the
+// user's index are not touched.
+func (r *Repo) Restore(ctx context.Context, rev string) error {
+	target, err := r.Resolve(ctx, rev)
+	if err != nil {
+		return err
+	}
+
+	// Files that exist now but not in the checkpoint must be deleted
+	current, err := r.WorkTree(ctx)
+	if err != nil {
+		return err
+	}
+	added, err := r.git(ctx, nil, "diff-tree", "-r", "--name-only", "--no-renames", "--diff-filter=A", "-z", target, current)
+	if err != nil {
+		return fmt.Errorf("diff against checkpoint: %w", err)
+	}
+	for _, path := range strings.Split(added, "\x00") {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.root, path)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", path, err)
+		}
+	}
+
+	// Write every checkpointed file back through a throwaway index
+	env, cleanup, err := r.tempIndex()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if _, err := r.git(ctx, env, "read-tree", target+"^{tree}"); err != nil {
+		return fmt.Errorf("read checkpoint tree: %w", err)
+	}
+	if _, err := r.git(ctx, env, "checkout-index", "-a", "-f"); err != nil {
+		return fmt.Errorf("restore files: %w", err)
+	}
+	return nil
+}
+
+// Resolve turns a checkpoint name, full ref or SHA into a commit SHA.
+func (r *Repo) Resolve(ctx context.Context, rev string) (string, error) {
+	for _, candidate := range []string{RefPrefix + rev, rev} {
+		if sha, err := r.git(ctx, nil, "rev-parse", "--verify", "--quiet", candidate+"^{commit}"); err == nil {
+			return sha, nil
+		}
+	}
+	return "", fmt.Errorf("checkpoint %q not found", rev)
+}
+
+// List returns checkpoints whose name starts with prefix (all when empty),
+// oldest first.
+func (r *Repo) List(ctx context.Context, prefix string) ([]Checkpoint, error) {
+	out, err := r.git(ctx, nil, "for-each-ref",
+		"--format=%(refname)%00%(objectname)%00%(creatordate:unix)%00%(contents:subject)",
+		RefPrefix+prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list checkpoints: %w", err)
+	}
+
+	var checkpoints []Checkpoint
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\x00", 4)
+		if len(fields) != 4 || !strings.HasPrefix(fields[0], RefPrefix+prefix) {
+			continue
+		}
+		var unix int64
+		fmt.Sscan(fields[2], &unix)
+		checkpoints = append(checkpoints, Checkpoint{
+			Ref:     fields[0],
+			Name:    strings.TrimPrefix(fields[0], RefPrefix),
+			SHA:     fields[1],
+			Created: time.Unix(unix, 0),
+			Message: fields[3],
+		})
+	}
+	sort.SliceStable(checkpoints, func(i, j int) bool {
+		return checkpoints[i].Created.Before(checkpoints[j].Created)
+	})
+	return checkpoints, nil
+}
+
+// tempIndex returns env vars pointing git at a fresh index file, and a
+// cleanup func that removes it.
+func (r *Repo) tempIndex() ([]string, func(), error) {
+	f, err := os.CreateTemp("", "tatsu-index-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("create temporary index: %w", err)
+	}
+	name := f.Name()
+	f.Close()
+	// git refuses an empty file as an index; it must not exist yet
+	os.Remove(name)
+	return []string{"GIT_INDEX_FILE=" + name}, func() { os.Remove(name) }, nil
+}
+
+// git runs a git command at the work tree root and returns trimmed stdout.
+func (r *Repo) git(ctx context.Context, env []string, args ...string) (string, error) {
+	c := exec.CommandContext(ctx, "git", args...)
+	c.Dir = r.root
+	c.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// identityEnv provides a committer identity so commit-tree works in repos
+// (and CI machines) without user.name/user.email configured.
+func identityEnv() []string {
+	return []string{
+		"GIT_AUTHOR_NAME=tatsu",
+		"GIT_AUTHOR_EMAIL=tatsu@localhost",
+		"GIT_COMMITTER_NAME=tatsu",
+		"GIT_COMMITTER_EMAIL=tatsu@localhost",
+	}
+}
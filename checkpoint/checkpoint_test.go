@@ -0,0 +1,181 @@
+package checkpoint
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initRepo creates a git repo with one committed file and returns it.
+func initRepo(t *testing.T) (*Repo, string) {
+	t.Helper()
+	dir := t.TempDir()
+	run := func(args ...string) {
+		c := exec.Command("git", args...)
+		c.Dir = dir
+		c.Env = append(os.Environ(), identityEnv()...)
+		out, err := c.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	run("init", "-q")
+	writeFile(t, dir, "main.go", "package main\n")
+	writeFile(t, dir, ".gitignore", "build/\n")
+	run("add", "-A")
+	run("commit", "-q", "-m", "initial")
+
+	repo, err := Open(dir)
+	require.NoError(t, err)
+	return repo, dir
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestOpen_NotARepo(t *testing.T) {
+	_, err := Open(t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not inside a git work tree")
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	ctx := context.Background()
+	repo, dir := initRepo(t)
+
+	// Uncommitted and untracked changes are part of the snapshot
+	writeFile(t, dir, "main.go", "package main // v1\n")
+	writeFile(t, dir, "notes.txt", "keep me\n")
+	sha, err := repo.Snapshot(ctx, "run/task-01/iter-001", "before iteration 1")
+	require.NoError(t, err)
+	require.NotEmpty(t, sha)
+
+	// Agent edits, deletes and creates files
+	writeFile(t, dir, "main.go", "package main // broken\n")
+	require.NoError(t, os.Remove(filepath.Join(dir, "notes.txt")))
+	writeFile(t, dir, "pkg/new.go", "package pkg\n")
+	writeFile(t, dir, "build/out.bin", "ignored\n")
+
+	require.NoError(t, repo.Restore(ctx, "run/task-01/iter-001"))
+
+	assert.Equal(t, "package main // v1\n", readFile(t, dir, "main.go"))
+	assert.Equal(t, "keep me\n", readFile(t, dir, "notes.txt"))
+	assert.NoFileExists(t, filepath.Join(dir, "pkg/new.go"))
+	// Ignored files are left alone
+	assert.FileExists(t, filepath.Join(dir, "build/out.bin"))
+}
+
+func TestSnapshot_LeavesIndexAndHeadAlone(t *testing.T) {
+	ctx := context.Background()
+	repo, dir := initRepo(t)
+
+	head, err := repo.git(ctx, nil, "rev-parse", "HEAD")
+	require.NoError(t, err)
+
+	writeFile(t, dir, "untracked.txt", "x\n")
+	_, err = repo.Snapshot(ctx, "run/task-01/iter-001", "before iteration 1")
+	require.NoError(t, err)
+
+	after, err := repo.git(ctx, nil, "rev-parse", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, head, after)
+
+	status, err := repo.git(ctx, nil, "status", "--porcelain")
+	require.NoError(t, err)
+	assert.Equal(t, "?? untracked.txt", status)
+}
+
+func TestSnapshot_ExcludesTatsuDir(t *testing.T) {
+	ctx := context.Background()
+	repo, dir := initRepo(t)
+
+	writeFile(t, dir, ".tatsu/runs/x/manifest.json", "{}")
+	_, err := repo.Snapshot(ctx, "run/task-01/iter-001", "before iteration 1")
+	require.NoError(t, err)
+
+	// Restoring must not delete tatsu's own state
+	require.NoError(t, repo.Restore(ctx, "run/task-01/iter-001"))
+	assert.FileExists(t, filepath.Join(dir, ".tatsu/runs/x/manifest.json"))
+}
+
+func TestChangedFiles(t *testing.T) {
+	ctx := context.Background()
+	repo, dir := initRepo(t)
+
+	before, err := repo.WorkTree(ctx)
+	require.NoError(t, err)
+	writeFile(t, dir, "tracked.txt", "changed")
+	writeFile(t, dir, "sub/new.go", "package sub")
+	after, err := repo.WorkTree(ctx)
+	require.NoError(t, err)
+
+	files, err := repo.ChangedFiles(ctx, before, after)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sub/new.go", "tracked.txt"}, files)
+
+	files, err = repo.ChangedFiles(ctx, after, after)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	repo, dir := initRepo(t)
+
+	before, err := repo.WorkTree(ctx)
+	require.NoError(t, err)
+	writeFile(t, dir, "main.go", "package main\n\nfunc main() {}\n")
+	after, err := repo.WorkTree(ctx)
+	require.NoError(t, err)
+
+	diff, err := repo.Diff(ctx, before, after)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "+++ b/main.go\n")
+	assert.Contains(t, diff, "\n+func main() {}")
+	assert.NotContains(t, diff, "\n package main", "no context lines")
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := initRepo(t)
+
+	_, err := repo.Snapshot(ctx, "run-a/task-01/iter-001", "a1")
+	require.NoError(t, err)
+	_, err = repo.Snapshot(ctx, "run-a/task-01/iter-002", "a2")
+	require.NoError(t, err)
+	_, err = repo.Snapshot(ctx, "run-b/task-01/iter-001", "b1")
+	require.NoError(t, err)
+
+	all, err := repo.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	runA, err := repo.List(ctx, "run-a/")
+	require.NoError(t, err)
+	require.Len(t, runA, 2)
+	assert.Equal(t, "run-a/task-01/iter-001", runA[0].Name)
+	assert.Equal(t, "a1", runA[0].Message)
+	assert.Equal(t, RefPrefix+"run-a/task-01/iter-002", runA[1].Ref)
+}
+
+func TestResolve_Unknown(t *testing.T) {
+	repo, _ := initRepo(t)
+
+	_, err := repo.Resolve(context.Background(), "nope")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `checkpoint "nope" not found`)
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/runner"
+)
+
+// command is a tatsu subcommand. Each command owns a flag set with its own
+// flags and the global ones, so flags work before or after the command name
+// and between its arguments.
+type command struct {
+	name    string
+	aliases []string
+	args    string // argument synopsis for help, e.g. "<task>"
+	summary string
+	// minArgs and maxArgs bound the positional arguments; maxArgs -1 means
+	// any number.
+	minArgs, maxArgs int
+	// flags registers the command's flags and returns the function that
+	// runs it with the positional arguments.
+	flags func(fs *flag.FlagSet) func(args []string)
+}
+
+// Global flags, accepted by every command in any position.
+var (
+	dirFlag    string
+	configFlag string
+	outputFlag string
+)
+
+func globalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&dirFlag, "C", "", "Run in `dir` (load tatsu.yaml and run commands there)")
+	fs.StringVar(&configFlag, "config", "", "Read the project config from `file` instead of tatsu.yaml")
+	fs.StringVar(&outputFlag, "output", "text", "Output `format`: text, or json for one JSON event per line on stdout")
+}
+
+// runFlags are the flags of the commands that run tasks. Zero values leave
+// tatsu.yaml's settings alone.
+type runFlags struct {
+	profile       string
+	maxIterations int
+	patience      int
+	timeout       time.Duration
+}
+
+// register registers the flags that override config values.
+func (f *runFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.profile, "profile", "", "Apply the tatsu.yaml profile `name` (default: profile in tatsu.yaml)")
+	fs.IntVar(&f.maxIterations, "max-iterations", 0, fmt.Sprintf("Give up on a task after `N` iterations (default: tatsu.yaml or %d, at most %d)", runner.DefaultMaxIterations, config.MaxIterationsLimit))
+	fs.IntVar(&f.patience, "patience", 0, fmt.Sprintf("Give up after `N` iterations in a row without progress (default: tatsu.yaml or %d, -1: never)", config.DefaultPatience))
+	fs.DurationVar(&f.timeout, "timeout", 0, "Give up on a task after this wall time, e.g. 30m (default: tatsu.yaml)")
+}
+
+// options returns the config layers the flags select.
+func (f *runFlags) options() config.Options {
+	var flags []config.Flag
+	if f.maxIterations != 0 {
+		flags = append(flags, config.Flag{Name: "max-iterations", Key: "max_iterations", Value: strconv.Itoa(f.maxIterations)})
+	}
+	if f.patience != 0 {
+		flags = append(flags, config.Flag{Name: "patience", Key: "patience", Value: strconv.Itoa(f.patience)})
+	}
+	if f.timeout != 0 {
+		flags = append(flags, config.Flag{Name: "timeout", Key: "timeout", Value: f.timeout.String()})
+	}
+	return config.Options{File: configFlag, Flags: flags, Profile: f.profile}
+}
+
+func (f *runFlags) validate() error {
+	switch {
+	case f.maxIterations < 0:
+		return errors.New("max-iterations must be at least 1")
+	case f.maxIterations > config.MaxIterationsLimit:
+		return fmt.Errorf("max-iterations cannot exceed %d (got %d)", config.MaxIterationsLimit, f.maxIterations)
+	case f.timeout < 0:
+		return errors.New("timeout must not be negative")
+	}
+	return nil
+}
+
+// runCommand registers the run flags for a command whose function needs
+// them, and validates them before calling it.
+func runCommand(fn func(args []string, opts runFlags)) func(fs *flag.FlagSet) func(args []string) {
+	return func(fs *flag.FlagSet) func(args []string) {
+		var opts runFlags
+		opts.register(fs)
+		return func(args []string) {
+			if err := opts.validate(); err != nil {
+				fatal(exitUsage, "Error: %v", err)
+			}
+			fn(args, opts)
+		}
+	}
+}
+
+// tuiCommand runs when no command is given.
+var tuiCommand = &command{
+	summary: "Open the TUI (Tab to switch Task / PRD)",
+	flags:   runCommand(func(_ []string, opts runFlags) { runTUI(opts) }),
+}
+
+// commands are set in init: help refers back to them.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name: "run", args: "<task>", summary: "Run a task until validation passes",
+			minArgs: 1, maxArgs: 1,
+			flags: runCommand(func(args []string, opts runFlags) { runTask(args[0], opts) }),
+		},
+		{
+			name: "prd", args: "<file>", summary: "Execute the unchecked tasks of a PRD file",
+			minArgs: 1, maxArgs: 1,
+			flags: runCommand(func(args []string, opts runFlags) { runPRD(args[0], opts) }),
+		},
+		{
+			name: "resume", args: "[run-id]", summary: "Continue an interrupted run (default: the latest)",
+			maxArgs: 1,
+			flags: func(fs *flag.FlagSet) func(args []string) {
+				return func(args []string) {
+					runID := ""
+					if len(args) > 0 {
+						runID = args[0]
+					}
+					runResume(runID)
+				}
+			},
+		},
+		{
+			name: "generate", aliases: []string{"gen"}, summary: "Generate tatsu.yaml for the project",
+			flags: func(fs *flag.FlagSet) func(args []string) {
+				force := fs.Bool("force", false, "Overwrite an existing tatsu.yaml")
+				fs.BoolVar(force, "f", false, "Shorthand for -force")
+				return func([]string) { generateConfig(*force) }
+			},
+		},
+		{
+			name: "checkpoints", aliases: []string{"cp"}, args: "[list [run] | restore <name>]",
+			summary: "List git checkpoints (all, or for one run) or restore one",
+			maxArgs: 2,
+			flags: func(fs *flag.FlagSet) func(args []string) {
+				return runCheckpoints
+			},
+		},
+		{
+			name: "config", args: "show|validate|schema",
+			summary: "Print the merged config, check it, or print its JSON Schema",
+			minArgs: 1, maxArgs: 1,
+			flags: func(fs *flag.FlagSet) func(args []string) {
+				var opts runFlags
+				opts.register(fs)
+				origin := fs.Bool("origin", false, "With show: show where each value comes from")
+				return func(args []string) {
+					if err := opts.validate(); err != nil {
+						fatal(exitUsage, "Error: %v", err)
+					}
+					switch args[0] {
+					case "show":
+						showConfig(opts, *origin)
+					case "validate":
+						validateConfig(opts)
+					case "schema":
+						printSchema()
+					default:
+						fatal(exitUsage, "Unknown config command: %s (see 'tatsu help config')", args[0])
+					}
+				}
+			},
+		},
+		{
+			name: "version", summary: "Show version",
+			flags: func(fs *flag.FlagSet) func(args []string) {
+				return func([]string) { fmt.Printf("tatsu v%s\n", Version) }
+			},
+		},
+		{
+			name: "help", args: "[command]", summary: "Show help for tatsu or a command",
+			maxArgs: 1,
+			flags: func(fs *flag.FlagSet) func(args []string) {
+				return func(args []string) {
+					if len(args) == 0 {
+						printUsage()
+						return
+					}
+					c := findCommand(args[0])
+					if c == nil {
+						fatal(exitUsage, "Unknown command: %s", args[0])
+					}
+					printCommandHelp(c)
+				}
+			},
+		},
+	}
+}
+
+// helpCommand is the command line that shows c's help.
+func (c *command) helpCommand() string {
+	return strings.TrimSpace("'tatsu help "+c.name) + "'"
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+		for _, alias := range c.aliases {
+			if alias == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// newFlagSet returns c's flag set and run function. Errors and help are
+// reported by the caller, not the flag package.
+func (c *command) newFlagSet() (*flag.FlagSet, func(args []string)) {
+	fs := flag.NewFlagSet("tatsu "+c.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	globalFlags(fs)
+	return fs, c.flags(fs)
+}
+
+// dispatch finds the command in args (the first argument that is not a
+// flag or a flag's value) and runs it with the other arguments.
+func dispatch(args []string) {
+	name, rest := splitCommand(args)
+	c := tuiCommand
+	if name != "" {
+		if c = findCommand(name); c == nil {
+			printUsage()
+			fatal(exitUsage, "Unknown command: %s", name)
+		}
+	}
+
+	fs, run := c.newFlagSet()
+	positional, err := parseInterleaved(fs, rest)
+	applyGlobals()
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		if c == tuiCommand {
+			printUsage()
+		} else {
+			printCommandHelp(c)
+		}
+		return
+	case err != nil:
+		fatal(exitUsage, "Error: %v (see %s)", err, c.helpCommand())
+	case len(positional) < c.minArgs:
+		fatal(exitUsage, "Error: %s requires %s (see %s)", c.name, c.args, c.helpCommand())
+	case c.maxArgs >= 0 && len(positional) > c.maxArgs:
+		fatal(exitUsage, "Error: unexpected arguments: %s (see %s)", strings.Join(positional, " "), c.helpCommand())
+	}
+	run(positional)
+}
+
+// splitCommand removes the command name from args. Flags before it are
+// parsed with every command's flags so that their values are skipped (e.g.
+// "-C dir run"); the command's own flag set checks them again. The name is
+// empty when there is no command, or "help" for -h before one.
+func splitCommand(args []string) (string, []string) {
+	all := flag.NewFlagSet("tatsu", flag.ContinueOnError)
+	all.SetOutput(io.Discard)
+	all.Usage = func() {}
+	globalFlags(all)
+	version := all.Bool("version", false, "")
+	all.BoolVar(version, "v", false, "")
+	for _, c := range append([]*command{tuiCommand}, commands...) {
+		sub := flag.NewFlagSet("", flag.ContinueOnError)
+		c.flags(sub)
+		sub.VisitAll(func(f *flag.Flag) {
+			if all.Lookup(f.Name) == nil {
+				all.Var(f.Value, f.Name, f.Usage)
+			}
+		})
+	}
+
+	err := all.Parse(args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return "help", nil
+	case err != nil:
+		applyGlobals()
+		fatal(exitUsage, "Error: %v (see 'tatsu help')", err)
+	case *version:
+		return "version", nil
+	}
+	i := len(args) - len(all.Args())
+	if all.NArg() == 0 || (i > 0 && args[i-1] == "--") {
+		return "", args
+	}
+	rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+	return all.Arg(0), rest
+}
+
+// parseInterleaved parses fs from args, allowing flags after positional
+// arguments, and returns the positional arguments. Everything after "--" is
+// positional.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// applyGlobals acts on the global flags: selects the output and changes to
+// the -C directory.
+func applyGlobals() {
+	switch outputFlag {
+	case "text":
+	case "json":
+		out = os.Stderr
+		if jsonOut == nil {
+			jsonOut = runner.NewJSONPrinter(os.Stdout)
+			jsonOut.ExitCode = exitCode
+		}
+	default:
+		format := outputFlag
+		outputFlag = "text"
+		fatal(exitUsage, "Error: -output must be text or json (got %q)", format)
+	}
+	if dirFlag != "" {
+		dir := dirFlag
+		dirFlag = ""
+		if err := os.Chdir(dir); err != nil {
+			fatal(exitFailure, "Error: %v", err)
+		}
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(out, "tatsu v"+Version)
+	fmt.Fprintln(out, "\nUsage:")
+	lines := [][2]string{{"tatsu [flags]", tuiCommand.summary}}
+	width := 0
+	for _, c := range commands {
+		lines = append(lines, [2]string{strings.TrimSpace("tatsu " + c.name + " " + c.args), c.summary})
+	}
+	for _, l := range lines {
+		width = max(width, len(l[0]))
+	}
+	for _, l := range lines {
+		fmt.Fprintf(out, "  %-*s  %s\n", width, l[0], l[1])
+	}
+	fmt.Fprintln(out, "\nGlobal flags (any position):")
+	printFlags(globalFlags)
+	fmt.Fprintln(out, "\nTask flags (tatsu, run, prd):")
+	printFlags(func(fs *flag.FlagSet) { new(runFlags).register(fs) })
+	fmt.Fprintln(out, "\nRun 'tatsu help <command>' for a command's flags.")
+	fmt.Fprintln(out, "\nExamples:")
+	fmt.Fprintln(out, "  tatsu run \"add unit tests to the parser\"")
+	fmt.Fprintln(out, "  tatsu run -max-iterations 5 \"quick test\"")
+	fmt.Fprintln(out, "  tatsu prd PRD.example.md -max-iterations 10")
+	fmt.Fprintln(out, "  tatsu generate --force")
+	fmt.Fprintln(out, "  tatsu -output json run \"fix the build\"")
+	fmt.Fprintln(out, "\nExit codes: 0 success, 1 failure, 2 usage error, 3 max iterations or no progress,")
+	fmt.Fprintln(out, "  4 config error, 5 agent unavailable, 124 timeout, 130 interrupted")
+	fmt.Fprintln(out, "\nNote: tatsu.yaml will be auto-generated on first run if it doesn't exist")
+}
+
+func printCommandHelp(c *command) {
+	fmt.Fprintf(out, "Usage: %s\n\n%s\n", strings.TrimSpace("tatsu "+c.name+" [flags] "+c.args), c.summary)
+	if len(c.aliases) > 0 {
+		fmt.Fprintf(out, "Aliases: %s\n", strings.Join(c.aliases, ", "))
+	}
+	own := func(fs *flag.FlagSet) { c.flags(fs) }
+	if hasFlags(own) {
+		fmt.Fprintln(out, "\nFlags:")
+		printFlags(own)
+	}
+	fmt.Fprintln(out, "\nGlobal flags:")
+	printFlags(globalFlags)
+}
+
+func hasFlags(register func(*flag.FlagSet)) bool {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	register(fs)
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	return n > 0
+}
+
+// printFlags prints the flags register defines, with their defaults.
+func printFlags(register func(*flag.FlagSet)) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(out)
+	register(fs)
+	fs.PrintDefaults()
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jack/tatsu/proc"
+	"gopkg.in/yaml.v3"
+)
+
+// Ways of passing the prompt to the agent (agent.prompt_via).
+const (
+	// PromptViaArgv passes the prompt as a single argument, substituted for
+	// %s (or appended), and runs the command without a shell. A string
+	// command is split into words first; nothing in it is expanded.
+	PromptViaArgv = "argv"
+	// PromptViaStdin writes the prompt to the agent's standard input.
+	PromptViaStdin = "stdin"
+	// PromptViaFile writes the prompt to a temporary file and substitutes
+	// its path for %s (or appends it).
+	PromptViaFile = "file"
+	// PromptViaEnv passes the prompt in the PromptEnv environment
+	// variable.
+	PromptViaEnv = "env"
+	// PromptViaShell substitutes the prompt, escaped for double quotes, for
+	// %s in a string command and runs it with bash -c, so the command may
+	// use pipes, redirects and other shell syntax. It must be asked for.
+	PromptViaShell = "shell"
+)
+
+// PromptEnv is the environment variable holding the prompt when
+// agent.prompt_via is env. It is not a config setting.
+const PromptEnv = "TATSU_PROMPT"
+
+var promptVias = []string{PromptViaArgv, PromptViaStdin, PromptViaFile, PromptViaEnv, PromptViaShell}
+
+// HasCommand reports whether agent.command is set, as a string or a list.
+func (a *Agent) HasCommand() bool {
+	return a.Command != "" || len(a.Argv) > 0
+}
+
+// CommandLine returns agent.command for display: the shell string, or the
+// argument list joined with shell quoting.
+func (a *Agent) CommandLine() string {
+	if len(a.Argv) > 0 {
+		return proc.JoinArgs(a.Argv)
+	}
+	return a.Command
+}
+
+// PromptMode returns how the prompt is passed: agent.prompt_via, or else
+// argv, so a %s command runs without a shell. Empty means a string command
+// template, which is rendered and run with bash -c.
+func (a *Agent) PromptMode() string {
+	switch {
+	case a.PromptVia != "":
+		return a.PromptVia
+	case len(a.Argv) == 0 && IsTemplate(a.Command):
+		return ""
+	default:
+		return PromptViaArgv
+	}
+}
+
+// CheckArgvCommand reports an error if a string agent.command uses shell
+// syntax (a pipe, a redirect, $VAR, a leading VAR=value, cd, ...), which
+// the argv prompt mode would pass to the program as literal words.
+func CheckArgvCommand(command string) error {
+	if s := proc.ShellSyntax(command); s != "" {
+		return fmt.Errorf("agent.command uses shell syntax (%q), which only works with agent.prompt_via: shell; "+
+			"otherwise the command is split into words and run without a shell", s)
+	}
+	return nil
+}
+
+// UnmarshalYAML reads agent.command as either a shell string (Command) or
+// a list of arguments (Argv).
+func (a *Agent) UnmarshalYAML(node *yaml.Node) error {
+	type plain Agent
+	if err := node.Decode((*plain)(a)); err != nil {
+		return err
+	}
+	var raw struct {
+		Command yaml.Node `yaml:"command"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	switch raw.Command.Kind {
+	case 0:
+		// Not set
+	case yaml.ScalarNode:
+		return raw.Command.Decode(&a.Command)
+	case yaml.SequenceNode:
+		if err := raw.Command.Decode(&a.Argv); err != nil {
+			return err
+		}
+		if len(a.Argv) == 0 {
+			return fmt.Errorf("line %d: agent.command list must not be empty", raw.Command.Line)
+		}
+	default:
+		return fmt.Errorf("line %d: agent.command must be a string or a list of arguments", raw.Command.Line)
+	}
+	return nil
+}
+
+// MarshalYAML writes agent.command back in the form it was read.
+func (a Agent) MarshalYAML() (interface{}, error) {
+	type plain Agent
+	out := struct {
+		Command interface{} `yaml:"command,omitempty"`
+		plain   `yaml:",inline"`
+	}{plain: plain(a)}
+	switch {
+	case len(a.Argv) > 0:
+		out.Command = a.Argv
+	case a.Command != "":
+		out.Command = a.Command
+	}
+	return out, nil
+}
+
+// validatePromptVia checks agent.prompt_via against agent.command.
+func validatePromptVia(a *Agent) error {
+	switch a.PromptMode() {
+	case "":
+		return nil
+	case PromptViaShell:
+		if len(a.Argv) > 0 {
+			return fmt.Errorf("agent.command must be a string when agent.prompt_via is shell")
+		}
+		return nil
+	case PromptViaArgv:
+		if len(a.Argv) == 0 && a.Command != "" {
+			args, err := proc.SplitArgs(a.Command)
+			if err != nil {
+				return fmt.Errorf("agent.command: %w", err)
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("agent.command is required in tatsu.yaml")
+			}
+			if err := CheckArgvCommand(a.Command); err != nil {
+				return err
+			}
+		}
+		return nil
+	case PromptViaStdin, PromptViaFile, PromptViaEnv:
+		// The adapters' default commands take the prompt as an argument
+		if !a.HasCommand() {
+			return fmt.Errorf("agent.command is required when agent.prompt_via is %s", a.PromptVia)
+		}
+		command := a.Command + " " + strings.Join(a.Argv, " ")
+		if a.PromptVia != PromptViaFile && !IsTemplate(command) && hasPlaceholder(command) {
+			return fmt.Errorf("agent.command must not contain %%s when agent.prompt_via is %s (write %%%%s for a literal %%s)", a.PromptVia)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown agent.prompt_via %q (expected one of %s)", a.PromptVia, strings.Join(promptVias, ", "))
+	}
+}
+
+// hasPlaceholder reports whether command contains %s (not %%s).
+func hasPlaceholder(command string) bool {
+	for i := 0; i+1 < len(command); i++ {
+		if command[i] == '%' {
+			if command[i+1] == 's' {
+				return true
+			}
+			if command[i+1] == '%' {
+				i++
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParse_CommandList(t *testing.T) {
+	cfg, err := Parse([]byte(`agent:
+  command: [aider, --yes-always, --message, "%s"]
+validate:
+  command: go test ./...
+`))
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Agent.Command)
+	assert.Equal(t, []string{"aider", "--yes-always", "--message", "%s"}, cfg.Agent.Argv)
+	assert.Equal(t, PromptViaArgv, cfg.Agent.PromptMode())
+	assert.Equal(t, "aider --yes-always --message %s", cfg.Agent.CommandLine())
+}
+
+func TestParse_CommandString(t *testing.T) {
+	cfg, err := Parse([]byte(`agent:
+  command: opencode run "%s"
+validate:
+  command: go test ./...
+`))
+	require.NoError(t, err)
+	assert.Equal(t, `opencode run "%s"`, cfg.Agent.Command)
+	assert.Nil(t, cfg.Agent.Argv)
+	assert.Equal(t, PromptViaArgv, cfg.Agent.PromptMode())
+
+	cfg.Agent.Command = "opencode run {{quote .Prompt}}"
+	assert.Empty(t, cfg.Agent.PromptMode())
+	cfg.Agent.PromptVia = PromptViaShell
+	assert.Equal(t, PromptViaShell, cfg.Agent.PromptMode())
+}
+
+func TestAgent_MarshalRoundTrip(t *testing.T) {
+	for _, agent := range []Agent{
+		{Argv: []string{"codex", "exec", "%s"}, PromptVia: PromptViaArgv},
+		{Command: `opencode run "%s"`, Harness: "opencode"},
+		{Harness: "aider"},
+	} {
+		data, err := yaml.Marshal(agent)
+		require.NoError(t, err)
+		var got Agent
+		require.NoError(t, yaml.Unmarshal(data, &got))
+		assert.Equal(t, agent, got, string(data))
+	}
+}
+
+func TestParse_PromptVia(t *testing.T) {
+	tests := []struct {
+		agent string
+		err   string
+	}{
+		{"command: 'opencode run \"%s\"'\n  prompt_via: argv", ""},
+		{"command: [cat]\n  prompt_via: stdin", ""},
+		{"command: 'agent --message-file %s'\n  prompt_via: file", ""},
+		{"command: 'agent -m \"$TATSU_PROMPT\" --fmt %%s'\n  prompt_via: env", ""},
+		{"command: 'agent \"%s\"'\n  prompt_via: stdin", "must not contain %s"},
+		{"command: [agent, '%s']\n  prompt_via: env", "must not contain %s"},
+		{"harness: aider\n  prompt_via: stdin", "agent.command is required when agent.prompt_via is stdin"},
+		{"harness: aider\n  prompt_via: argv", ""},
+		{"command: 'agent \"%s'\n  prompt_via: argv", "unterminated"},
+		{"command: 'agent \"%s'", "unterminated"},
+		{"command: 'agent \"%s\" | tee log'\n  prompt_via: shell", ""},
+		{"command: 'agent \"%s\" | tee log'", `shell syntax ("|"), which only works with agent.prompt_via: shell`},
+		{"command: 'FOO=1 agent \"%s\"'", `shell syntax ("FOO=1")`},
+		{"command: 'cd /tmp && agent \"%s\"'", `shell syntax ("&")`},
+		{"command: 'agent \"%s\" 2>&1'\n  prompt_via: argv", `shell syntax (">")`},
+		{"command: 'cd /tmp && agent'\n  prompt_via: stdin", ""},
+		{"command: [agent, '%s']\n  prompt_via: shell", "must be a string when agent.prompt_via is shell"},
+		{"command: agent\n  prompt_via: pipe", `unknown agent.prompt_via "pipe"`},
+		{"command: []", "must not be empty"},
+		{"command: {a: b}", "must be a string or a list"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte("agent:\n  " + tt.agent + "\nvalidate:\n  command: go test ./...\n"))
+		if tt.err == "" {
+			assert.NoError(t, err, tt.agent)
+		} else if assert.Error(t, err, tt.agent) {
+			assert.Contains(t, err.Error(), tt.err, tt.agent)
+		}
+	}
+}
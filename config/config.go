@@ -3,49 +3,347 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/jack/tatsu/testresult"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	// DefaultFeedbackMaxBytes caps how much validation output is fed back to the agent.
+	DefaultFeedbackMaxBytes = 4000
+	// DefaultFeedbackMaxLines caps how many lines of validation output are fed back to the agent.
+	DefaultFeedbackMaxLines = 100
+	// DefaultPatience is how many iterations in a row may fail the same way
+	// before a task is given up.
+	DefaultPatience = 3
+	// MaxIterationsLimit caps max_iterations, for safety.
+	MaxIterationsLimit = 100
+)
+
+// DefaultRetryPrompt is the prompt sent to the agent on iteration 2+ when
+// agent.retry_prompt is not set. It is a text/template.
+const DefaultRetryPrompt = `{{.Task}}
+
+This is attempt {{.Iteration}} of {{.MaxIterations}}. The previous attempt failed validation{{if .FailedStages}} (failed stage: {{.FailedStages}}){{end}} with this output:
+
+{{.LastValidationOutput}}
+
+Fix the problems above and complete the task.`
+
+// Agent configures the coding agent and the prompts it is sent.
+type Agent struct {
+	// Harness selects the agent adapter: opencode, aider, codex, goose or
+	// custom. Empty means detect from the program Command runs.
+	Harness string `yaml:"harness,omitempty"`
+	// Command is the agent command as a shell string; %s is replaced with
+	// the prompt and %% with %. A command containing {{ is a text/template
+	// instead (see CommandVars). It may be omitted when Harness names an
+	// adapter with a default. In tatsu.yaml, command may also be a list
+	// (see Argv).
+	Command string `yaml:"-"`
+	// Argv is the agent command as a list of arguments, run without a
+	// shell; %s in an argument is replaced with the prompt. Set from a
+	// YAML list in agent.command.
+	Argv []string `yaml:"-"`
+	// PromptVia selects how the prompt reaches the agent: argv, stdin,
+	// file, env or shell (see PromptVia*). Empty means argv, except for a
+	// string command template (see PromptMode).
+	PromptVia string `yaml:"prompt_via,omitempty"`
+	// Prompt is the text/template sent on the first iteration (see
+	// PromptVars). Empty means the bare task.
+	Prompt string `yaml:"prompt,omitempty"`
+	// RetryPrompt is the text/template used instead of the bare task from
+	// iteration 2 onwards. Empty means DefaultRetryPrompt.
+	RetryPrompt string `yaml:"retry_prompt,omitempty"`
+	// PromptFile and RetryPromptFile read Prompt and RetryPrompt from a
+	// file instead, relative to the config file that sets them. Parse
+	// inlines the file and clears these fields.
+	PromptFile      string `yaml:"prompt_file,omitempty"`
+	RetryPromptFile string `yaml:"retry_prompt_file,omitempty"`
+	// Feedback trims the validation output included in the retry prompt.
+	Feedback Feedback `yaml:"feedback,omitempty"`
+	// Timeout bounds a single agent call (e.g. "10m"). 0 means no limit.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Session controls agent session continuity for harnesses that keep
+	// sessions (OpenCode): by default every iteration of a task continues
+	// the session the first iteration started.
+	Session struct {
+		// Fresh starts a new session on every iteration.
+		Fresh bool `yaml:"fresh,omitempty"`
+		// ResetAfter starts a new session after this many failed
+		// iterations in the same session. 0 means never.
+		ResetAfter int `yaml:"reset_after,omitempty"`
+	} `yaml:"session,omitempty"`
+	// Env selects the environment the agent and the validation commands
+	// inherit. By default everything but DefaultEnvDeny is passed.
+	Env Env `yaml:"env,omitempty"`
+}
+
+// Feedback trims the validation output included in the retry prompt (the
+// tail is kept). 0 means the default.
+type Feedback struct {
+	MaxBytes int `yaml:"max_bytes,omitempty"`
+	MaxLines int `yaml:"max_lines,omitempty"`
+}
+
 type Config struct {
-	Agent struct {
-		Command string `yaml:"command"`
-	} `yaml:"agent"`
+	// Version is the format of the file (see CurrentVersion). Older files
+	// are migrated when they are read.
+	Version  int   `yaml:"version,omitempty"`
+	Agent    Agent `yaml:"agent"`
 	Validate struct {
-		Command string `yaml:"command"`
+		// Command is a single validation command; shorthand for a one-stage
+		// pipeline. Mutually exclusive with Stages.
+		Command string `yaml:"command,omitempty"`
+		// Stages is an ordered validation pipeline.
+		Stages []Stage `yaml:"stages,omitempty"`
+		// Timeout bounds a single validation run (e.g. "5m"), across all
+		// stages. 0 means no limit.
+		Timeout time.Duration `yaml:"timeout,omitempty"`
+		// Parser selects how test results are read from the output: go,
+		// junit, pytest, jest or none. Empty means detect from project files.
+		Parser string `yaml:"parser,omitempty"`
+		// Report is a file to parse instead of the command output (e.g. a
+		// JUnit XML report written by the test command).
+		Report string `yaml:"report,omitempty"`
+		// Baseline runs validation once before each task's first agent
+		// call; see Baseline.
+		Baseline Baseline `yaml:"baseline,omitempty"`
+		// Integrity compares the test results of a passing task with the
+		// baseline (run for it even if Baseline is not enabled) and checks
+		// the diff for new skip markers. Lost or newly skipped tests keep
+		// the task from completing unless the user accepts them.
+		Integrity bool `yaml:"integrity,omitempty"`
 	} `yaml:"validate"`
+	// MaxIterations gives up on a task after this many agent calls. 0
+	// means the runner's default.
+	MaxIterations int `yaml:"max_iterations,omitempty"`
+	// Timeout bounds a whole task, across all iterations. 0 means no limit.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Patience stops a task early after this many iterations in a row that
+	// made no progress (same validation output, same failing tests, same
+	// file-change status). 0 means DefaultPatience; negative disables.
+	Patience int `yaml:"patience,omitempty"`
+	// Permissions overrides rules of DefaultPermissions. Nil means the
+	// defaults.
+	Permissions *Permissions `yaml:"permissions,omitempty"`
+	Git         struct {
+		// Checkpoints snapshots the working tree to a hidden ref
+		// (refs/tatsu/checkpoints/...) before every agent call.
+		Checkpoints bool `yaml:"checkpoints,omitempty"`
+		// RollbackOnFailure restores the pre-task checkpoint when a task
+		// fails. Requires checkpoints.
+		RollbackOnFailure bool `yaml:"rollback_on_failure,omitempty"`
+	} `yaml:"git,omitempty"`
+	// Guard protects files the agent must not change (tests, CI config).
+	Guard Guard `yaml:"guard,omitempty"`
+	// Profile is the profile in effect. Resolve has already applied it.
+	Profile string `yaml:"profile,omitempty"`
+	// Profiles are named sets of overrides for ProfileKeys, kept as YAML
+	// so that they merge over the config like any other layer.
+	Profiles map[string]yaml.Node `yaml:"profiles,omitempty"`
 }
 
-func Load() (*Config, error) {
-	// Check file exists
-	if _, err := os.Stat("tatsu.yaml"); os.IsNotExist(err) {
-		return nil, fmt.Errorf("tatsu.yaml not found. Create one with:\n\nagent:\n  command: 'opencode run \"%%s\"'\nvalidate:\n  command: 'go test ./...'")
+// Stage is one named step of the validation pipeline.
+type Stage struct {
+	Name    string `yaml:"name"`
+	Command string `yaml:"command"`
+	// Dir is the working directory for the command, relative to the
+	// directory tatsu runs in. Empty means the current directory.
+	Dir string `yaml:"dir,omitempty"`
+	// ContinueOnFailure runs the remaining stages even if this one fails
+	// (the validation still fails). The default is fail-fast.
+	ContinueOnFailure bool `yaml:"continue_on_failure,omitempty"`
+	// Timeout bounds this stage. 0 means only validate.timeout applies.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Parser and Report override validate.parser and validate.report for
+	// this stage. Report is relative to Dir.
+	Parser string `yaml:"parser,omitempty"`
+	Report string `yaml:"report,omitempty"`
+}
+
+// What to do when validation already passes before a task
+// (validate.baseline.if_passing).
+const (
+	IfPassingRun  = "run"  // run the agent anyway
+	IfPassingSkip = "skip" // the task is already satisfied
+	IfPassingAsk  = "ask"  // ask the user; skip without an answer
+)
+
+// How tests that already failed before a task count
+// (validate.baseline.known_failures).
+const (
+	KnownFailuresIgnore = "ignore" // only new failures fail validation
+	KnownFailuresFail   = "fail"   // every failure does
+)
+
+// Baseline is the validation run before each task's first agent call.
+type Baseline struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// IfPassing is IfPassingRun (the default), IfPassingSkip or
+	// IfPassingAsk.
+	IfPassing string `yaml:"if_passing,omitempty"`
+	// KnownFailures is KnownFailuresIgnore (the default) or
+	// KnownFailuresFail. Ignoring them needs test results that name the
+	// failing tests; other failures always count.
+	KnownFailures string `yaml:"known_failures,omitempty"`
+}
+
+// validateBaseline checks validate.baseline.
+func validateBaseline(b Baseline) error {
+	switch b.IfPassing {
+	case "", IfPassingRun, IfPassingSkip, IfPassingAsk:
+	default:
+		return fmt.Errorf("validate.baseline.if_passing must be %s, %s or %s", IfPassingRun, IfPassingSkip, IfPassingAsk)
 	}
+	switch b.KnownFailures {
+	case "", KnownFailuresIgnore, KnownFailuresFail:
+	default:
+		return fmt.Errorf("validate.baseline.known_failures must be %s or %s", KnownFailuresIgnore, KnownFailuresFail)
+	}
+	if !b.Enabled && (b.IfPassing != "" || b.KnownFailures != "") {
+		return fmt.Errorf("validate.baseline settings require validate.baseline.enabled: true")
+	}
+	return nil
+}
 
-	// Read file
-	data, err := os.ReadFile("tatsu.yaml")
-	if err != nil {
-		return nil, fmt.Errorf("failed to read tatsu.yaml: %w", err)
+// DefaultStageName is the stage name used when validate.command is set.
+const DefaultStageName = "validate"
+
+// ValidationStages returns the validation pipeline: validate.stages, or a
+// single stage wrapping validate.command. Stages inherit validate.parser and
+// validate.report unless they set their own.
+func (c *Config) ValidationStages() []Stage {
+	if len(c.Validate.Stages) == 0 {
+		return []Stage{{
+			Name:    DefaultStageName,
+			Command: c.Validate.Command,
+			Parser:  c.Validate.Parser,
+			Report:  c.Validate.Report,
+		}}
 	}
+	stages := make([]Stage, len(c.Validate.Stages))
+	for i, stage := range c.Validate.Stages {
+		if stage.Parser == "" {
+			stage.Parser = c.Validate.Parser
+		}
+		if stage.Report == "" {
+			stage.Report = c.Validate.Report
+		}
+		stages[i] = stage
+	}
+	return stages
+}
+
+// Load reads the config layers (see Options) without flags: the global
+// file, the project tatsu.yaml found from the current directory, and
+// TATSU_* variables.
+func Load() (*Config, error) {
+	return LoadWith(Options{})
+}
 
-	// Parse YAML
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+// Parse parses and validates tatsu.yaml content, e.g. the config snapshot
+// saved with a run.
+func Parse(data []byte) (*Config, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
 		return nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+		if _, err := checkFile(root, ""); err != nil {
+			return nil, err
+		}
+	}
+	return decode(root)
+}
 
+// validate checks a decoded config, fills in defaults and inlines prompt
+// files.
+func validate(cfg *Config) error {
 	// Validate required fields
-	if cfg.Agent.Command == "" {
-		return nil, fmt.Errorf("agent.command is required in tatsu.yaml")
+	if !cfg.Agent.HasCommand() && (cfg.Agent.Harness == "" || cfg.Agent.Harness == "custom") {
+		return fmt.Errorf("agent.command is required in tatsu.yaml")
+	}
+	if err := validatePromptVia(&cfg.Agent); err != nil {
+		return err
+	}
+	if cfg.Validate.Command == "" && len(cfg.Validate.Stages) == 0 {
+		return fmt.Errorf("validate.command is required in tatsu.yaml")
+	}
+	if err := validateStages(cfg); err != nil {
+		return err
+	}
+	if err := validateBaseline(cfg.Validate.Baseline); err != nil {
+		return err
+	}
+	if err := loadTemplates(&cfg.Agent); err != nil {
+		return err
+	}
+	if cfg.Agent.Feedback.MaxBytes < 0 || cfg.Agent.Feedback.MaxLines < 0 {
+		return fmt.Errorf("agent.feedback.max_bytes and agent.feedback.max_lines must not be negative")
 	}
-	if cfg.Validate.Command == "" {
-		return nil, fmt.Errorf("validate.command is required in tatsu.yaml")
+	if err := validateEnv(cfg.Agent.Env); err != nil {
+		return err
+	}
+	if cfg.Agent.Session.ResetAfter < 0 {
+		return fmt.Errorf("agent.session.reset_after must not be negative")
+	}
+	if cfg.MaxIterations < 0 || cfg.MaxIterations > MaxIterationsLimit {
+		return fmt.Errorf("max_iterations must be between 1 and %d", MaxIterationsLimit)
+	}
+	if cfg.Agent.Timeout < 0 || cfg.Validate.Timeout < 0 || cfg.Timeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	if err := validateGuard(cfg.Guard); err != nil {
+		return err
+	}
+	if cfg.Git.RollbackOnFailure && !cfg.Git.Checkpoints {
+		return fmt.Errorf("git.rollback_on_failure requires git.checkpoints: true")
 	}
 
-	return &cfg, nil
+	return nil
 }
 
-// Generate creates a tatsu.yaml file by detecting the project type
+// validateStages checks validate.stages and fills in default stage names.
+func validateStages(cfg *Config) error {
+	if cfg.Validate.Command != "" && len(cfg.Validate.Stages) > 0 {
+		return fmt.Errorf("set either validate.command or validate.stages in tatsu.yaml, not both")
+	}
+	seen := make(map[string]bool)
+	for i := range cfg.Validate.Stages {
+		stage := &cfg.Validate.Stages[i]
+		if stage.Command == "" {
+			return fmt.Errorf("validate.stages[%d].command is required in tatsu.yaml", i)
+		}
+		if stage.Name == "" {
+			stage.Name = fmt.Sprintf("stage %d", i+1)
+		}
+		if seen[stage.Name] {
+			return fmt.Errorf("validate.stages: duplicate stage name %q", stage.Name)
+		}
+		seen[stage.Name] = true
+		if stage.Timeout < 0 {
+			return fmt.Errorf("validate.stages[%d].timeout must not be negative", i)
+		}
+		if stage.Parser != "" {
+			if _, err := testresult.Get(stage.Parser); err != nil {
+				return fmt.Errorf("validate.stages[%d].parser: %w", i, err)
+			}
+		}
+	}
+	if cfg.Validate.Parser != "" {
+		if _, err := testresult.Get(cfg.Validate.Parser); err != nil {
+			return fmt.Errorf("validate.parser: %w", err)
+		}
+	}
+	return nil
+}
+
+// Generate creates a tatsu.yaml file for the projects Detect finds in the
+// current directory, with comments explaining each detection.
 // If force is true, it will overwrite an existing tatsu.yaml file
 func Generate(force bool) error {
 	// Check if tatsu.yaml already exists
@@ -53,11 +351,9 @@ func Generate(force bool) error {
 		return fmt.Errorf("tatsu.yaml already exists (use --force to overwrite)")
 	}
 
-	// Detect project type and generate config
-	cfg := detectProjectType()
-
-	// Marshal to YAML
-	data, err := yaml.Marshal(cfg)
+	// Detect the projects and generate config
+	found := Detect(".")
+	data, err := generated(found)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -70,44 +366,65 @@ func Generate(force bool) error {
 	return nil
 }
 
-func detectProjectType() *Config {
-	var cfg Config
+// noTests is the validate.command Generate writes when Detect finds
+// nothing.
+const noTests = "echo 'No tests configured. Update tatsu.yaml with your test command.'"
+
+// generatedConfig returns the config for the detections: a single
+// validate.command for one project in the current directory, one stage
+// per detection otherwise.
+func generatedConfig(found []Detection) *Config {
+	cfg := Config{Version: CurrentVersion}
 
 	// Default agent command
 	cfg.Agent.Command = `opencode run "%s"`
 
-	// Detect project type by looking for common files
-	if _, err := os.Stat("go.mod"); err == nil {
-		// Go project
-		cfg.Validate.Command = "go test ./..."
-		return &cfg
+	switch {
+	case len(found) == 0:
+		cfg.Validate.Command = noTests
+	case len(found) == 1 && found[0].Dir == "":
+		cfg.Validate.Command = found[0].Command
+		cfg.Validate.Parser = found[0].Parser
+	default:
+		for _, d := range found {
+			cfg.Validate.Stages = append(cfg.Validate.Stages, Stage{
+				Name:    d.Name,
+				Command: d.Command,
+				Dir:     d.Dir,
+				Parser:  d.Parser,
+			})
+		}
 	}
+	return &cfg
+}
 
-	if _, err := os.Stat("package.json"); err == nil {
-		// Node.js project
-		cfg.Validate.Command = "npm test"
-		return &cfg
+// generated returns the tatsu.yaml content for the detections, with each
+// reason as a comment above its command or stage.
+func generated(found []Detection) ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(generatedConfig(found)); err != nil {
+		return nil, err
 	}
+	doc.HeadComment = "Generated by tatsu generate from the files found in this directory.\n" +
+		"Review the commands below; tatsu config validate checks your edits."
 
-	if _, err := os.Stat("requirements.txt"); err == nil {
-		// Python project (requirements.txt)
-		cfg.Validate.Command = "pytest"
-		return &cfg
-	}
+	agent := doc.Content[mappingIndex(&doc, "agent")+1]
+	agent.Content[mappingIndex(agent, "command")].HeadComment =
+		"%s is replaced with the task. Set agent.harness to use aider, codex, goose\n" +
+			"or a custom agent instead of OpenCode."
 
-	if _, err := os.Stat("pyproject.toml"); err == nil {
-		// Python project (pyproject.toml)
-		cfg.Validate.Command = "pytest"
-		return &cfg
+	validate := doc.Content[mappingIndex(&doc, "validate")+1]
+	if i := mappingIndex(validate, "stages"); i >= 0 {
+		validate.Content[i].HeadComment = "One stage per project and lint config found; they run in this order."
+		for j, stage := range validate.Content[i+1].Content {
+			stage.HeadComment = found[j].Reason
+		}
+	} else {
+		command := validate.Content[mappingIndex(validate, "command")]
+		command.HeadComment = "No project files found: set your test command."
+		if len(found) == 1 {
+			command.HeadComment = found[0].Reason
+		}
 	}
-
-	if _, err := os.Stat("Cargo.toml"); err == nil {
-		// Rust project
-		cfg.Validate.Command = "cargo test"
-		return &cfg
-	}
-
-	// Default fallback
-	cfg.Validate.Command = "echo 'No tests configured. Update tatsu.yaml with your test command.'"
-	return &cfg
+	return yaml.Marshal(&doc)
 }
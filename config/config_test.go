@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -87,9 +89,10 @@ func TestGenerate_FileDoesNotExist(t *testing.T) {
 	// Generate config
 	require.NoError(t, Generate(false))
 
-	// Verify file was created
-	_, err := os.Stat("tatsu.yaml")
+	// Verify file was created, with the current version
+	data, err := os.ReadFile("tatsu.yaml")
 	require.NoError(t, err, "tatsu.yaml was not created")
+	assert.Contains(t, string(data), fmt.Sprintf("version: %d\n", CurrentVersion))
 
 	// Verify we can load it
 	cfg, err := Load()
@@ -195,3 +198,246 @@ func TestGenerate_DefaultFallback(t *testing.T) {
 	expected := "echo 'No tests configured. Update tatsu.yaml with your test command.'"
 	assert.Equal(t, expected, cfg.Validate.Command)
 }
+
+func TestLoad_RetryPrompt(t *testing.T) {
+	content := `agent:
+  command: 'opencode run "%s"'
+  retry_prompt: '{{.Task}} - {{.LastValidationOutput}}'
+  feedback:
+    max_lines: 20
+validate:
+  command: 'go test ./...'
+`
+	require.NoError(t, os.WriteFile("tatsu.yaml", []byte(content), 0644))
+	defer os.Remove("tatsu.yaml")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "{{.Task}} - {{.LastValidationOutput}}", cfg.Agent.RetryPrompt)
+	assert.Equal(t, 20, cfg.Agent.Feedback.MaxLines)
+}
+
+func TestLoad_InvalidRetryPrompt(t *testing.T) {
+	content := `agent:
+  command: 'opencode run "%s"'
+  retry_prompt: '{{.Task'
+validate:
+  command: 'go test ./...'
+`
+	require.NoError(t, os.WriteFile("tatsu.yaml", []byte(content), 0644))
+	defer os.Remove("tatsu.yaml")
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "agent.retry_prompt")
+}
+
+func TestLoad_Timeouts(t *testing.T) {
+	content := `agent:
+  command: 'opencode run "%s"'
+  timeout: 10m
+validate:
+  command: 'go test ./...'
+  timeout: 90s
+timeout: 1h
+`
+	require.NoError(t, os.WriteFile("tatsu.yaml", []byte(content), 0644))
+	defer os.Remove("tatsu.yaml")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, cfg.Agent.Timeout)
+	assert.Equal(t, 90*time.Second, cfg.Validate.Timeout)
+	assert.Equal(t, time.Hour, cfg.Timeout)
+}
+
+func TestLoad_NegativeTimeout(t *testing.T) {
+	content := `agent:
+  command: 'opencode run "%s"'
+validate:
+  command: 'go test ./...'
+  timeout: -5s
+`
+	require.NoError(t, os.WriteFile("tatsu.yaml", []byte(content), 0644))
+	defer os.Remove("tatsu.yaml")
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must not be negative")
+}
+
+func TestParse_Session(t *testing.T) {
+	cfg, err := Parse([]byte(`agent:
+  harness: opencode
+  session:
+    reset_after: 3
+validate:
+  command: 'go test ./...'
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, cfg.Agent.Session.ResetAfter)
+	assert.False(t, cfg.Agent.Session.Fresh)
+
+	_, err = Parse([]byte("agent:\n  harness: opencode\n  session:\n    reset_after: -1\nvalidate:\n  command: x\n"))
+	assert.ErrorContains(t, err, "agent.session.reset_after must not be negative")
+}
+
+func TestParse_Baseline(t *testing.T) {
+	cfg, err := Parse([]byte(`agent:
+  command: 'opencode run "%s"'
+validate:
+  command: 'go test ./...'
+  baseline:
+    enabled: true
+    if_passing: skip
+`))
+	require.NoError(t, err)
+	assert.Equal(t, Baseline{Enabled: true, IfPassing: IfPassingSkip}, cfg.Validate.Baseline)
+
+	for yaml, msg := range map[string]string{
+		"enabled: true\n    if_passing: never":   "validate.baseline.if_passing must be run, skip or ask",
+		"enabled: true\n    known_failures: yes": "validate.baseline.known_failures must be ignore or fail",
+		"if_passing: ask":                        "require validate.baseline.enabled: true",
+	} {
+		_, err := Parse([]byte("agent:\n  command: x %s\nvalidate:\n  command: x\n  baseline:\n    " + yaml + "\n"))
+		assert.ErrorContains(t, err, msg, yaml)
+	}
+}
+
+func TestLoad_RollbackRequiresCheckpoints(t *testing.T) {
+	content := `agent:
+  command: 'opencode run "%s"'
+validate:
+  command: 'go test ./...'
+git:
+  rollback_on_failure: true
+`
+	require.NoError(t, os.WriteFile("tatsu.yaml", []byte(content), 0644))
+	defer os.Remove("tatsu.yaml")
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "git.checkpoints")
+}
+
+func TestLoad_Stages(t *testing.T) {
+	content := `agent:
+  command: 'opencode run "%s"'
+validate:
+  stages:
+    - name: build
+      command: go build ./...
+    - command: go vet ./...
+      continue_on_failure: true
+    - name: test
+      command: go test ./...
+      dir: backend
+      timeout: 2m
+`
+	require.NoError(t, os.WriteFile("tatsu.yaml", []byte(content), 0644))
+	defer os.Remove("tatsu.yaml")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	stages := cfg.ValidationStages()
+	require.Len(t, stages, 3)
+	assert.Equal(t, Stage{Name: "build", Command: "go build ./..."}, stages[0])
+	assert.Equal(t, "stage 2", stages[1].Name)
+	assert.True(t, stages[1].ContinueOnFailure)
+	assert.Equal(t, "backend", stages[2].Dir)
+	assert.Equal(t, 2*time.Minute, stages[2].Timeout)
+}
+
+func TestValidationStages_SingleCommand(t *testing.T) {
+	cfg := &Config{}
+	cfg.Validate.Command = "go test ./..."
+
+	assert.Equal(t, []Stage{{Name: DefaultStageName, Command: "go test ./..."}}, cfg.ValidationStages())
+}
+
+func TestLoad_StagesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate string
+		expected string
+	}{
+		{
+			name: "command and stages",
+			validate: `  command: go test ./...
+  stages:
+    - name: build
+      command: go build ./...`,
+			expected: "not both",
+		},
+		{
+			name: "stage without command",
+			validate: `  stages:
+    - name: build`,
+			expected: "validate.stages[0].command is required",
+		},
+		{
+			name: "unknown parser",
+			validate: `  command: make test
+  parser: tap`,
+			expected: `validate.parser: unknown test result parser "tap"`,
+		},
+		{
+			name: "duplicate names",
+			validate: `  stages:
+    - name: build
+      command: a
+    - name: build
+      command: b`,
+			expected: `duplicate stage name "build"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := "agent:\n  command: 'opencode run \"%s\"'\nvalidate:\n" + tt.validate + "\n"
+			require.NoError(t, os.WriteFile("tatsu.yaml", []byte(content), 0644))
+			defer os.Remove("tatsu.yaml")
+
+			_, err := Load()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+}
+
+func TestValidationStages_InheritParser(t *testing.T) {
+	cfg := &Config{}
+	cfg.Validate.Parser = "junit"
+	cfg.Validate.Report = "report.xml"
+	cfg.Validate.Stages = []Stage{
+		{Name: "unit", Command: "make unit"},
+		{Name: "e2e", Command: "make e2e", Parser: "none"},
+	}
+
+	stages := cfg.ValidationStages()
+	assert.Equal(t, "junit", stages[0].Parser)
+	assert.Equal(t, "report.xml", stages[0].Report)
+	assert.Equal(t, "none", stages[1].Parser)
+}
+
+func TestLoad_HarnessWithoutCommand(t *testing.T) {
+	content := `agent:
+  harness: aider
+validate:
+  command: 'go test ./...'
+`
+	require.NoError(t, os.WriteFile("tatsu.yaml", []byte(content), 0644))
+	defer os.Remove("tatsu.yaml")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "aider", cfg.Agent.Harness)
+	assert.Empty(t, cfg.Agent.Command)
+
+	content = "agent:\n  harness: custom\nvalidate:\n  command: make test\n"
+	require.NoError(t, os.WriteFile("tatsu.yaml", []byte(content), 0644))
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "agent.command is required")
+}
@@ -0,0 +1,516 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jack/tatsu/testresult"
+)
+
+// detectDepth is how many directory levels below the project root Detect
+// looks for more projects, e.g. backend/ or services/api/ in a monorepo.
+const detectDepth = 2
+
+// skipDirs are directories Detect never looks into: dependencies, build
+// output and test fixtures.
+var skipDirs = map[string]bool{
+	"node_modules": true, "vendor": true, "target": true, "build": true,
+	"dist": true, "out": true, "bin": true, "obj": true, "deps": true,
+	"_build": true, "testdata": true, "fixtures": true, "coverage": true,
+	"__pycache__": true, "venv": true,
+}
+
+// Detection is a validation command Generate found for a project.
+type Detection struct {
+	// Dir is the project directory relative to the root, "" for the root.
+	Dir string
+	// Name is the stage name, e.g. "go" or "web/eslint".
+	Name    string
+	Command string
+	// Parser is the test result parser for Command (see testresult), ""
+	// for none.
+	Parser string
+	// Reason explains the detection; Generate writes it as a comment.
+	Reason string
+}
+
+// Detect finds the projects in root and its subdirectories (down to
+// detectDepth) and returns their test commands, each followed by the
+// lint commands its config files call for. A Makefile or justfile test
+// target is preferred over a language's own test command. Subprojects a
+// workspace already covers (npm/pnpm/yarn workspaces, Cargo and Go
+// workspaces, multi-project Gradle and Maven builds, .sln files, Elixir
+// umbrellas) are not listed again.
+func Detect(root string) []Detection {
+	var found []Detection
+	var walk func(rel string, depth int, covered map[string]bool)
+	walk = func(rel string, depth int, covered map[string]bool) {
+		dir := filepath.Join(root, rel)
+		detections, workspaces := detectDir(dir, filepath.ToSlash(rel), covered)
+		found = append(found, detections...)
+		if depth == detectDepth {
+			return
+		}
+		if len(workspaces) > 0 {
+			inner := map[string]bool{}
+			for kind := range covered {
+				inner[kind] = true
+			}
+			for _, kind := range workspaces {
+				inner[kind] = true
+			}
+			covered = inner
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() || strings.HasPrefix(name, ".") || skipDirs[name] {
+				continue
+			}
+			walk(filepath.Join(rel, name), depth+1, covered)
+		}
+	}
+	walk("", 0, nil)
+	return found
+}
+
+// DetectParser returns the test result parser for the project in dir,
+// based on the same marker files Generate uses to pick a test command.
+func DetectParser(dir string) string {
+	for _, detect := range detectors {
+		if p := detect(projectDir{path: dir}); p != nil && p.parser != "" {
+			return p.parser
+		}
+	}
+	return testresult.FormatNone
+}
+
+// detectDir returns the detections for the projects in one directory
+// and the kinds of project whose workspace covers the directories below.
+// Projects of a covered kind are skipped.
+func detectDir(path, rel string, covered map[string]bool) ([]Detection, []string) {
+	d := projectDir{path: path, rel: rel}
+	var projects []*project
+	var workspaces []string
+	for _, detect := range detectors {
+		p := detect(d)
+		if p == nil || covered[p.kind] {
+			continue
+		}
+		projects = append(projects, p)
+		if p.workspace {
+			workspaces = append(workspaces, p.kind)
+		}
+	}
+
+	var found []Detection
+	add := func(name, command, parser, reason string) {
+		if rel != "" {
+			name = rel + "/" + name
+		}
+		found = append(found, Detection{Dir: rel, Name: name, Command: command, Parser: parser, Reason: reason})
+	}
+
+	tasks := detectTasks(d)
+	var tests, lints []string
+	for _, p := range projects {
+		tests = append(tests, p.test)
+		for _, lint := range p.lints {
+			lints = append(lints, lint.command)
+		}
+	}
+	if tasks.test != "" {
+		parser := ""
+		if len(projects) > 0 {
+			parser = projects[0].parser
+		}
+		add(tasks.program, tasks.program+" test", parser, insteadOf(tasks.test, tests))
+	} else {
+		for _, p := range projects {
+			add(p.kind, p.test, p.parser, p.reason)
+		}
+	}
+	if tasks.lint != "" {
+		add("lint", tasks.program+" lint", "", insteadOf(tasks.lint, lints))
+	} else {
+		for _, p := range projects {
+			for _, lint := range p.lints {
+				add(lint.name, lint.command, "", lint.reason)
+			}
+		}
+	}
+	return found, workspaces
+}
+
+// insteadOf adds the commands a Makefile or justfile target replaces to
+// reason.
+func insteadOf(reason string, commands []string) string {
+	if len(commands) == 0 {
+		return reason
+	}
+	return fmt.Sprintf("%s, used instead of %s", reason, strings.Join(commands, " and "))
+}
+
+// project is a project found in one directory.
+type project struct {
+	kind   string // also the name of its test stage
+	test   string
+	parser string
+	reason string
+	lints  []lint
+	// workspace means test also covers the projects of the same kind in
+	// the directories below.
+	workspace bool
+}
+
+// lint is a lint command picked up from a lint tool's config file.
+type lint struct {
+	name, command, reason string
+}
+
+// projectDir looks at the files in one directory.
+type projectDir struct {
+	path string
+	rel  string // for reasons; "" for the root
+}
+
+// has returns the first of names that exists in the directory, "" if
+// none does.
+func (d projectDir) has(names ...string) string {
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(d.path, name)); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// glob returns the first file matching one of patterns, "" if none does.
+func (d projectDir) glob(patterns ...string) string {
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(filepath.Join(d.path, pattern))
+		if len(matches) > 0 {
+			return filepath.Base(matches[0])
+		}
+	}
+	return ""
+}
+
+// read returns the content of a file in the directory, "" if it cannot
+// be read.
+func (d projectDir) read(name string) string {
+	data, err := os.ReadFile(filepath.Join(d.path, name))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// file returns name as shown in a reason: relative to the root.
+func (d projectDir) file(name string) string {
+	if d.rel == "" {
+		return name
+	}
+	return d.rel + "/" + name
+}
+
+// lintConfig returns the lint for the first of configs that exists, nil
+// if none does.
+func (d projectDir) lintConfig(name, command string, configs ...string) []lint {
+	if config := d.has(configs...); config != "" {
+		return []lint{{name: name, command: command, reason: fmt.Sprintf("%s: %s config", d.file(config), name)}}
+	}
+	return nil
+}
+
+// detectors find a project in a directory, nil if there is none. The
+// order decides DetectParser's pick and the order of the stages.
+var detectors = []func(projectDir) *project{
+	detectGo,
+	detectNode,
+	detectDeno,
+	detectPython,
+	detectRust,
+	detectGradle,
+	detectMaven,
+	detectRuby,
+	detectElixir,
+	detectDotnet,
+	detectPHP,
+}
+
+func detectGo(d projectDir) *project {
+	marker := d.has("go.work", "go.mod")
+	if marker == "" {
+		return nil
+	}
+	p := &project{kind: "go", test: "go test ./...", parser: testresult.FormatGo,
+		reason: d.file(marker) + ": Go module"}
+	if marker == "go.work" {
+		p.reason = d.file(marker) + ": Go workspace, go test ./... covers its modules"
+		p.workspace = true
+	}
+	p.lints = d.lintConfig("golangci-lint", "golangci-lint run",
+		".golangci.yml", ".golangci.yaml", ".golangci.toml", ".golangci.json")
+	return p
+}
+
+// packageManagers maps the lockfiles and workspace files that select a
+// Node package manager to it.
+var packageManagers = map[string]string{
+	"pnpm-lock.yaml":      "pnpm",
+	"pnpm-workspace.yaml": "pnpm",
+	"yarn.lock":           "yarn",
+	"bun.lockb":           "bun",
+	"bun.lock":            "bun",
+}
+
+// npmPlaceholder is the test script npm init writes.
+const npmPlaceholder = `echo "Error: no test specified" && exit 1`
+
+func detectNode(d projectDir) *project {
+	if d.has("package.json") == "" {
+		return nil
+	}
+	var pkg struct {
+		Scripts        map[string]string `json:"scripts"`
+		Workspaces     json.RawMessage   `json:"workspaces"`
+		PackageManager string            `json:"packageManager"`
+	}
+	_ = json.Unmarshal([]byte(d.read("package.json")), &pkg)
+
+	// The package manager, from the lockfile or package.json
+	pm, why := "npm", ""
+	if file := d.has("pnpm-lock.yaml", "pnpm-workspace.yaml", "yarn.lock", "bun.lockb", "bun.lock"); file != "" {
+		pm, why = packageManagers[file], d.file(file)
+	} else if name, _, ok := strings.Cut(pkg.PackageManager, "@"); ok {
+		pm, why = name, d.file("package.json")+" packageManager"
+	}
+
+	p := &project{kind: "node", parser: testresult.FormatJest}
+	script := pkg.Scripts["test"]
+	switch {
+	case script != "" && script != npmPlaceholder:
+		p.test = pm + " test"
+		if pm == "bun" {
+			// bun test runs bun's own test runner, not the script
+			p.test = "bun run test"
+		}
+		p.reason = d.file("package.json") + " has a test script"
+	case pm == "bun":
+		p.test = "bun test"
+		p.reason = d.file("package.json") + " has no test script, using bun's test runner"
+	default:
+		p.test = pm + " test"
+		p.reason = d.file("package.json") + " has no test script yet"
+	}
+	if why != "" {
+		p.reason += fmt.Sprintf("; %s selects %s", why, pm)
+	}
+	if (len(pkg.Workspaces) > 0 && string(pkg.Workspaces) != "null") || d.has("pnpm-workspace.yaml") != "" {
+		p.workspace = true
+		p.reason += "; its workspaces cover the packages below"
+	}
+
+	if pkg.Scripts["lint"] != "" {
+		p.lints = []lint{{name: "lint", command: pm + " run lint", reason: d.file("package.json") + " has a lint script"}}
+	} else {
+		exec := map[string]string{"npm": "npx", "pnpm": "pnpm exec", "yarn": "yarn", "bun": "bunx"}[pm]
+		if exec == "" {
+			exec = "npx"
+		}
+		p.lints = d.lintConfig("eslint", exec+" eslint .",
+			".eslintrc", ".eslintrc.js", ".eslintrc.cjs", ".eslintrc.json", ".eslintrc.yml", ".eslintrc.yaml",
+			"eslint.config.js", "eslint.config.mjs", "eslint.config.cjs", "eslint.config.ts")
+	}
+	return p
+}
+
+func detectDeno(d projectDir) *project {
+	marker := d.has("deno.json", "deno.jsonc")
+	if marker == "" {
+		return nil
+	}
+	return &project{kind: "deno", test: "deno test", reason: d.file(marker) + ": Deno project",
+		lints: []lint{{name: "deno-lint", command: "deno lint", reason: d.file(marker) + ": deno lint is built in"}}}
+}
+
+func detectPython(d projectDir) *project {
+	marker := d.has("pyproject.toml", "requirements.txt", "setup.py", "setup.cfg")
+	if marker == "" {
+		return nil
+	}
+	p := &project{kind: "python", test: "pytest", parser: testresult.FormatPytest,
+		reason: d.file(marker) + ": Python project"}
+	run := ""
+	if lock := d.has("uv.lock", "poetry.lock"); lock != "" {
+		tool := strings.TrimSuffix(lock, ".lock")
+		run = tool + " run "
+		p.test = run + p.test
+		p.reason += fmt.Sprintf("; %s runs it with %s", d.file(lock), tool)
+	}
+	p.lints = d.lintConfig("ruff", run+"ruff check .", "ruff.toml", ".ruff.toml")
+	if p.lints == nil && strings.Contains(d.read("pyproject.toml"), "[tool.ruff") {
+		p.lints = []lint{{name: "ruff", command: run + "ruff check .", reason: d.file("pyproject.toml") + ": [tool.ruff] config"}}
+	}
+	return p
+}
+
+func detectRust(d projectDir) *project {
+	if d.has("Cargo.toml") == "" {
+		return nil
+	}
+	p := &project{kind: "rust", test: "cargo test", reason: d.file("Cargo.toml") + ": Rust crate"}
+	if strings.Contains(d.read("Cargo.toml"), "[workspace]") {
+		p.test = "cargo test --workspace"
+		p.reason = d.file("Cargo.toml") + ": Cargo workspace, cargo test --workspace covers its crates"
+		p.workspace = true
+	}
+	p.lints = d.lintConfig("clippy", "cargo clippy -- -D warnings", "clippy.toml", ".clippy.toml")
+	return p
+}
+
+func detectGradle(d projectDir) *project {
+	marker := d.has("build.gradle.kts", "build.gradle", "settings.gradle.kts", "settings.gradle")
+	if marker == "" {
+		return nil
+	}
+	p := &project{kind: "gradle", test: "gradle test", reason: d.file(marker) + ": Gradle build"}
+	if d.has("gradlew") != "" {
+		p.test = "./gradlew test"
+		p.reason += ", run with its wrapper"
+	}
+	if d.has("settings.gradle.kts", "settings.gradle") != "" {
+		p.workspace = true
+		p.reason += "; its settings cover the subprojects below"
+	}
+	return p
+}
+
+func detectMaven(d projectDir) *project {
+	if d.has("pom.xml") == "" {
+		return nil
+	}
+	p := &project{kind: "maven", test: "mvn test", reason: d.file("pom.xml") + ": Maven build"}
+	if d.has("mvnw") != "" {
+		p.test = "./mvnw test"
+		p.reason += ", run with its wrapper"
+	}
+	if strings.Contains(d.read("pom.xml"), "<modules>") {
+		p.workspace = true
+		p.reason += "; its modules cover the projects below"
+	}
+	return p
+}
+
+func detectRuby(d projectDir) *project {
+	if d.has("Gemfile") == "" {
+		return nil
+	}
+	p := &project{kind: "ruby", test: "bundle exec rake test", reason: d.file("Gemfile") + ": Ruby project"}
+	if spec := d.has(".rspec", "spec"); spec != "" {
+		p.test = "bundle exec rspec"
+		p.reason += fmt.Sprintf("; %s: RSpec", d.file(spec))
+	}
+	p.lints = d.lintConfig("rubocop", "bundle exec rubocop", ".rubocop.yml")
+	return p
+}
+
+func detectElixir(d projectDir) *project {
+	if d.has("mix.exs") == "" {
+		return nil
+	}
+	p := &project{kind: "elixir", test: "mix test", reason: d.file("mix.exs") + ": Mix project"}
+	if strings.Contains(d.read("mix.exs"), "apps_path") {
+		p.workspace = true
+		p.reason = d.file("mix.exs") + ": umbrella project, mix test covers its apps"
+	}
+	p.lints = d.lintConfig("credo", "mix credo", ".credo.exs")
+	return p
+}
+
+func detectDotnet(d projectDir) *project {
+	marker := d.glob("*.sln", "*.csproj", "*.fsproj", "*.vbproj")
+	if marker == "" {
+		return nil
+	}
+	p := &project{kind: "dotnet", test: "dotnet test", reason: d.file(marker) + ": .NET project"}
+	if strings.HasSuffix(marker, ".sln") {
+		p.workspace = true
+		p.reason = d.file(marker) + ": .NET solution, dotnet test covers its projects"
+	}
+	return p
+}
+
+func detectPHP(d projectDir) *project {
+	if d.has("composer.json") == "" {
+		return nil
+	}
+	var composer struct {
+		Scripts map[string]json.RawMessage `json:"scripts"`
+	}
+	_ = json.Unmarshal([]byte(d.read("composer.json")), &composer)
+
+	p := &project{kind: "php", test: "vendor/bin/phpunit", reason: d.file("composer.json") + ": Composer project"}
+	if _, ok := composer.Scripts["test"]; ok {
+		p.test = "composer test"
+		p.reason = d.file("composer.json") + " has a test script"
+	} else if config := d.has("phpunit.xml", "phpunit.xml.dist"); config != "" {
+		p.reason += fmt.Sprintf("; %s: PHPUnit", d.file(config))
+	}
+	p.lints = d.lintConfig("phpstan", "vendor/bin/phpstan analyse", "phpstan.neon", "phpstan.neon.dist")
+	return p
+}
+
+// tasks are the test and lint targets of a Makefile or justfile.
+type tasks struct {
+	program    string // make or just
+	test, lint string // the reasons, "" without the target
+}
+
+var (
+	// makeTarget matches a rule for target in a Makefile, also with
+	// other targets on the same line; not a variable assignment.
+	makeTarget = func(target string) *regexp.Regexp {
+		return regexp.MustCompile(`(?m)^(?:[\w.-]+[ \t]+)*` + target + `(?:[ \t]+[\w.-]+)*[ \t]*::?(?:[^=]|$)`)
+	}
+	makeTest, makeLint = makeTarget("test"), makeTarget("lint")
+	// justRecipe matches a recipe in a justfile, also with parameters.
+	justRecipe = func(recipe string) *regexp.Regexp {
+		return regexp.MustCompile(`(?m)^@?` + recipe + `(?:[ \t]+[^:=\n]*)?[ \t]*:(?:[^=]|$)`)
+	}
+	justTest, justLint = justRecipe("test"), justRecipe("lint")
+)
+
+// detectTasks looks for test and lint targets in a Makefile, then in a
+// justfile.
+func detectTasks(d projectDir) tasks {
+	if file := d.has("GNUmakefile", "Makefile", "makefile"); file != "" {
+		if t := findTasks(d, file, "make", makeTest, makeLint); t.test != "" || t.lint != "" {
+			return t
+		}
+	}
+	if file := d.has("justfile", "Justfile", ".justfile"); file != "" {
+		return findTasks(d, file, "just", justTest, justLint)
+	}
+	return tasks{}
+}
+
+func findTasks(d projectDir, file, program string, test, lint *regexp.Regexp) tasks {
+	content := d.read(file)
+	t := tasks{program: program}
+	if test.MatchString(content) {
+		t.test = fmt.Sprintf("%s has a test target", d.file(file))
+	}
+	if lint.MatchString(content) {
+		t.lint = fmt.Sprintf("%s has a lint target", d.file(file))
+	}
+	return t
+}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles creates files (path: content) under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+// commands returns the stage name and command of each detection.
+func commands(found []Detection) map[string]string {
+	out := map[string]string{}
+	for _, d := range found {
+		out[d.Name] = d.Command
+	}
+	return out
+}
+
+func TestDetect_Projects(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected map[string]string
+	}{
+		{"go", map[string]string{"go.mod": "module x\n"}, map[string]string{"go": "go test ./..."}},
+		{"npm", map[string]string{"package.json": `{"scripts": {"test": "jest"}}`, "package-lock.json": "{}"},
+			map[string]string{"node": "npm test"}},
+		{"pnpm", map[string]string{"package.json": `{"scripts": {"test": "vitest"}}`, "pnpm-lock.yaml": ""},
+			map[string]string{"node": "pnpm test"}},
+		{"yarn", map[string]string{"package.json": `{"scripts": {"test": "jest"}}`, "yarn.lock": ""},
+			map[string]string{"node": "yarn test"}},
+		{"packageManager", map[string]string{"package.json": `{"packageManager": "pnpm@9.0.0", "scripts": {"test": "jest"}}`},
+			map[string]string{"node": "pnpm test"}},
+		{"bun script", map[string]string{"package.json": `{"scripts": {"test": "vitest"}}`, "bun.lockb": ""},
+			map[string]string{"node": "bun run test"}},
+		{"bun runner", map[string]string{"package.json": `{}`, "bun.lock": ""}, map[string]string{"node": "bun test"}},
+		{"deno", map[string]string{"deno.json": "{}"}, map[string]string{"deno": "deno test", "deno-lint": "deno lint"}},
+		{"pytest", map[string]string{"requirements.txt": ""}, map[string]string{"python": "pytest"}},
+		{"uv", map[string]string{"pyproject.toml": "", "uv.lock": ""}, map[string]string{"python": "uv run pytest"}},
+		{"rust", map[string]string{"Cargo.toml": "[package]\n"}, map[string]string{"rust": "cargo test"}},
+		{"gradle wrapper", map[string]string{"build.gradle.kts": "", "gradlew": ""}, map[string]string{"gradle": "./gradlew test"}},
+		{"maven", map[string]string{"pom.xml": "<project/>"}, map[string]string{"maven": "mvn test"}},
+		{"rspec", map[string]string{"Gemfile": "", ".rspec": ""}, map[string]string{"ruby": "bundle exec rspec"}},
+		{"minitest", map[string]string{"Gemfile": "", "Rakefile": ""}, map[string]string{"ruby": "bundle exec rake test"}},
+		{"elixir", map[string]string{"mix.exs": ""}, map[string]string{"elixir": "mix test"}},
+		{"dotnet", map[string]string{"App.Tests.csproj": "<Project/>"}, map[string]string{"dotnet": "dotnet test"}},
+		{"phpunit", map[string]string{"composer.json": "{}", "phpunit.xml": ""}, map[string]string{"php": "vendor/bin/phpunit"}},
+		{"composer script", map[string]string{"composer.json": `{"scripts": {"test": "phpunit"}}`},
+			map[string]string{"php": "composer test"}},
+		{"go and node", map[string]string{"go.mod": "", "package.json": `{"scripts": {"test": "jest"}}`},
+			map[string]string{"go": "go test ./...", "node": "npm test"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			assert.Equal(t, tt.expected, commands(Detect(dir)))
+		})
+	}
+}
+
+func TestDetect_Lint(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected map[string]string
+	}{
+		{"golangci", map[string]string{"go.mod": "", ".golangci.yml": ""},
+			map[string]string{"go": "go test ./...", "golangci-lint": "golangci-lint run"}},
+		{"ruff", map[string]string{"pyproject.toml": "", "ruff.toml": ""},
+			map[string]string{"python": "pytest", "ruff": "ruff check ."}},
+		{"tool.ruff", map[string]string{"pyproject.toml": "[tool.ruff]\nline-length = 100\n"},
+			map[string]string{"python": "pytest", "ruff": "ruff check ."}},
+		{"eslintrc", map[string]string{"package.json": `{"scripts": {"test": "jest"}}`, ".eslintrc.json": "{}"},
+			map[string]string{"node": "npm test", "eslint": "npx eslint ."}},
+		{"eslint with pnpm", map[string]string{"package.json": `{"scripts": {"test": "jest"}}`, "pnpm-lock.yaml": "", "eslint.config.js": ""},
+			map[string]string{"node": "pnpm test", "eslint": "pnpm exec eslint ."}},
+		{"lint script", map[string]string{"package.json": `{"scripts": {"test": "jest", "lint": "eslint ."}}`, ".eslintrc": ""},
+			map[string]string{"node": "npm test", "lint": "npm run lint"}},
+		{"no config", map[string]string{"go.mod": ""}, map[string]string{"go": "go test ./..."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			assert.Equal(t, tt.expected, commands(Detect(dir)))
+		})
+	}
+}
+
+func TestDetect_Tasks(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected map[string]string
+	}{
+		{"make test", map[string]string{"go.mod": "", "Makefile": ".PHONY: test\ntest: build\n\tgo test -race ./...\n"},
+			map[string]string{"make": "make test"}},
+		{"make test and lint", map[string]string{"go.mod": "", ".golangci.yml": "", "Makefile": "all lint test:\n\ttrue\n"},
+			map[string]string{"make": "make test", "lint": "make lint"}},
+		{"make variable", map[string]string{"go.mod": "", "Makefile": "test := ./...\nbuild:\n\tgo build\n"},
+			map[string]string{"go": "go test ./..."}},
+		{"just", map[string]string{"package.json": "{}", "justfile": "test *args:\n    npm test {{args}}\n"},
+			map[string]string{"just": "just test"}},
+		{"make without test", map[string]string{"Makefile": "build:\n\tgo build\n"}, map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			assert.Equal(t, tt.expected, commands(Detect(dir)))
+		})
+	}
+}
+
+func TestDetect_Monorepo(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":                            "module x\n",
+		"web/package.json":                  `{"scripts": {"test": "vitest"}}`,
+		"web/node_modules/x/package.json":   `{"scripts": {"test": "jest"}}`,
+		"services/api/pyproject.toml":       "",
+		"services/api/ruff.toml":            "",
+		".github/workflows/package.json":    "{}",
+		"services/api/deep/more/Cargo.toml": "",
+	})
+
+	found := Detect(dir)
+	assert.Equal(t, []Detection{
+		{Name: "go", Command: "go test ./...", Parser: "go", Reason: "go.mod: Go module"},
+		{Dir: "services/api", Name: "services/api/python", Command: "pytest", Parser: "pytest",
+			Reason: "services/api/pyproject.toml: Python project"},
+		{Dir: "services/api", Name: "services/api/ruff", Command: "ruff check .",
+			Reason: "services/api/ruff.toml: ruff config"},
+		{Dir: "web", Name: "web/node", Command: "npm test", Parser: "jest", Reason: "web/package.json has a test script"},
+	}, found)
+}
+
+func TestDetect_Workspaces(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected map[string]string
+	}{
+		{"npm workspaces", map[string]string{
+			"package.json":            `{"workspaces": ["packages/*"], "scripts": {"test": "npm test -ws"}}`,
+			"packages/a/package.json": `{"scripts": {"test": "jest"}}`,
+			"packages/a/go.mod":       "",
+		}, map[string]string{"node": "npm test", "packages/a/go": "go test ./..."}},
+		{"pnpm workspace", map[string]string{
+			"package.json":          `{"scripts": {"test": "pnpm -r test"}}`,
+			"pnpm-workspace.yaml":   "packages:\n  - apps/*\n",
+			"apps/web/package.json": `{"scripts": {"test": "jest"}}`,
+		}, map[string]string{"node": "pnpm test"}},
+		{"cargo workspace", map[string]string{
+			"Cargo.toml":          "[workspace]\nmembers = [\"crates/*\"]\n",
+			"crates/a/Cargo.toml": "[package]\n",
+		}, map[string]string{"rust": "cargo test --workspace"}},
+		{"go workspace", map[string]string{
+			"go.work":  "go 1.21\nuse ./a\n",
+			"a/go.mod": "module a\n",
+		}, map[string]string{"go": "go test ./..."}},
+		{"nested go modules", map[string]string{
+			"go.mod":       "module x\n",
+			"tools/go.mod": "module tools\n",
+		}, map[string]string{"go": "go test ./...", "tools/go": "go test ./..."}},
+		{"dotnet solution", map[string]string{
+			"App.sln":                          "",
+			"src/App/App.csproj":               "",
+			"tests/App.Tests/App.Tests.csproj": "",
+		}, map[string]string{"dotnet": "dotnet test"}},
+		{"maven modules", map[string]string{
+			"pom.xml":      "<project><modules><module>core</module></modules></project>",
+			"core/pom.xml": "<project/>",
+		}, map[string]string{"maven": "mvn test"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			assert.Equal(t, tt.expected, commands(Detect(dir)))
+		})
+	}
+}
+
+func TestDetectParser(t *testing.T) {
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"go.mod", "go"},
+		{"package.json", "jest"},
+		{"pyproject.toml", "pytest"},
+		{"Cargo.toml", "none"},
+		{"mix.exs", "none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, tt.file), nil, 0644))
+			assert.Equal(t, tt.expected, DetectParser(dir))
+		})
+	}
+}
+
+func TestGenerate_Monorepo(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":             "module x\n",
+		".golangci.yml":      "",
+		"web/package.json":   `{"scripts": {"test": "vitest"}}`,
+		"web/pnpm-lock.yaml": "",
+	})
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	require.NoError(t, Generate(false))
+
+	data, err := os.ReadFile("tatsu.yaml")
+	require.NoError(t, err)
+	content := string(data)
+	assert.Contains(t, content, "# Generated by tatsu generate")
+	assert.Contains(t, content, "# go.mod: Go module\n")
+	assert.Contains(t, content, "# .golangci.yml: golangci-lint config\n")
+	assert.Contains(t, content, "# web/package.json has a test script; web/pnpm-lock.yaml selects pnpm\n")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Validate.Command)
+	require.Len(t, cfg.Validate.Stages, 3)
+	assert.Equal(t, Stage{Name: "go", Command: "go test ./...", Parser: "go"}, cfg.Validate.Stages[0])
+	assert.Equal(t, Stage{Name: "golangci-lint", Command: "golangci-lint run"}, cfg.Validate.Stages[1])
+	assert.Equal(t, Stage{Name: "web/node", Command: "pnpm test", Dir: "web", Parser: "jest"}, cfg.Validate.Stages[2])
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvDeny are the variables withheld from the agent and validation
+// unless agent.env.allow names them: cloud credentials, tokens, passwords
+// and keys. Agent API keys (*_API_KEY) are passed, the agent needs them;
+// their values are still scrubbed (see SecretEnvNames).
+var DefaultEnvDeny = []string{
+	"AWS_*",
+	"AZURE_*",
+	"GOOGLE_APPLICATION_CREDENTIALS",
+	"GOOGLE_CREDENTIALS",
+	"*_TOKEN",
+	"*_SECRET",
+	"*_SECRET_*",
+	"*_SECRET_KEY",
+	"*PASSWORD*",
+	"*PRIVATE_KEY*",
+}
+
+// SecretEnvNames are the names of the variables whose values are scrubbed
+// from output even when they are passed on, inherited or set: API keys,
+// tokens and the like, which the agent may need but must not echo into the
+// journal.
+var SecretEnvNames = []string{
+	"*_KEY",
+	"*_KEY_*",
+	"*_TOKEN",
+	"*_TOKEN_*",
+	"*_PAT",
+	"*SECRET*",
+	"*PASSWORD*",
+	"*PASSWD*",
+	"*CREDENTIAL*",
+}
+
+// Redacted stands in for a secret value in output and in the config
+// snapshot saved with a run.
+const Redacted = "[REDACTED]"
+
+// MinSecretLength is the shortest value Environ reports as a secret;
+// scrubbing shorter values ("1", "true") would mangle ordinary output.
+const MinSecretLength = 8
+
+// Env selects the environment the agent and the validation commands run
+// with. Patterns are shell globs matched against variable names (e.g.
+// "AWS_*").
+type Env struct {
+	// Allow, when set, passes only the variables matching one of its
+	// patterns. A variable matching Allow is passed even if
+	// DefaultEnvDeny matches it.
+	Allow []string `yaml:"allow,omitempty"`
+	// Deny withholds the variables matching one of its patterns, on top
+	// of DefaultEnvDeny. Deny wins over Allow.
+	Deny []string `yaml:"deny,omitempty"`
+	// Set adds variables, overriding inherited ones and Files.
+	Set map[string]string `yaml:"set,omitempty"`
+	// Files are .env files (KEY=value lines) whose variables are added.
+	// They are read when a task starts, relative to the directory tatsu
+	// runs in, and their values are treated as secrets.
+	Files []string `yaml:"files,omitempty"`
+}
+
+// Passes reports whether the inherited variable name is passed on.
+func (e Env) Passes(name string) bool {
+	switch {
+	case matchAny(e.Deny, name):
+		return false
+	case matchAny(e.Allow, name):
+		return true
+	case len(e.Allow) > 0:
+		return false
+	default:
+		return !matchAny(DefaultEnvDeny, name)
+	}
+}
+
+// Environ filters base (KEY=value entries, e.g. os.Environ()) and adds the
+// variables of Files and Set. It also returns the values to scrub from
+// output: those of the withheld variables, of Files, and of the passed or
+// set variables named like secrets (SecretEnvNames, DefaultEnvDeny), at
+// least MinSecretLength long.
+func (e Env) Environ(base []string) (env, secrets []string, err error) {
+	for _, kv := range base {
+		name, value, _ := strings.Cut(kv, "=")
+		passes := e.Passes(name)
+		if passes {
+			env = append(env, kv)
+		}
+		if !passes || isSecretEnv(name) {
+			secrets = appendSecret(secrets, value)
+		}
+	}
+	for _, file := range e.Files {
+		vars, err := ReadEnvFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, name := range sortedKeys(vars) {
+			env = setEnv(env, name, vars[name])
+			secrets = appendSecret(secrets, vars[name])
+		}
+	}
+	for _, name := range sortedKeys(e.Set) {
+		env = setEnv(env, name, e.Set[name])
+		if isSecretEnv(name) {
+			secrets = appendSecret(secrets, e.Set[name])
+		}
+	}
+	return env, secrets, nil
+}
+
+// isSecretEnv reports whether name looks like it holds a secret.
+func isSecretEnv(name string) bool {
+	return matchAny(SecretEnvNames, name) || matchAny(DefaultEnvDeny, name)
+}
+
+// Restore fills in the agent.env.set values that Snapshot redacted from
+// current, e.g. the project config when a run is resumed. It returns the
+// names current does not set.
+func (e *Env) Restore(current Env) (missing []string) {
+	for _, name := range sortedKeys(e.Set) {
+		if e.Set[name] != Redacted {
+			continue
+		}
+		if value, ok := current.Set[name]; ok {
+			e.Set[name] = value
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// Snapshot marshals cfg for the run journal, with the values of the
+// agent.env.set variables named like secrets replaced by Redacted, at the
+// top level and in the profiles.
+func Snapshot(cfg *Config) ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(cfg); err != nil {
+		return nil, err
+	}
+	for _, agent := range agentNodes(&doc) {
+		i := mappingIndex(agent.node, "env")
+		if i < 0 {
+			continue
+		}
+		env := agent.node.Content[i+1]
+		if i = mappingIndex(env, "set"); i < 0 {
+			continue
+		}
+		set := env.Content[i+1]
+		for j := 0; j+1 < len(set.Content); j += 2 {
+			if isSecretEnv(set.Content[j].Value) {
+				set.Content[j+1] = scalarNode(Redacted)
+			}
+		}
+	}
+	return yaml.Marshal(&doc)
+}
+
+// ReadEnvFile reads a .env file: KEY=value lines, optionally prefixed with
+// "export ", with # comments and single- or double-quoted values.
+func ReadEnvFile(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("agent.env.files: %w", err)
+	}
+	defer f.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", file, n)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		vars[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return vars, nil
+}
+
+// validateEnv checks the patterns and names of agent.env.
+func validateEnv(e Env) error {
+	for _, list := range []struct {
+		name     string
+		patterns []string
+	}{{"allow", e.Allow}, {"deny", e.Deny}} {
+		for _, p := range list.patterns {
+			if _, err := path.Match(p, ""); err != nil || p == "" {
+				return fmt.Errorf("agent.env.%s: invalid pattern %q", list.name, p)
+			}
+		}
+	}
+	for name := range e.Set {
+		if name == "" || strings.ContainsAny(name, "= \t") {
+			return fmt.Errorf("agent.env.set: invalid variable name %q", name)
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// appendSecret adds each line of value that is long enough to scrub; output
+// is scrubbed line by line, so a multi-line value (a key) is split.
+func appendSecret(secrets []string, value string) []string {
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); len(line) >= MinSecretLength {
+			secrets = append(secrets, line)
+		}
+	}
+	return secrets
+}
+
+// setEnv sets name in env, replacing an earlier entry.
+func setEnv(env []string, name, value string) []string {
+	for i, kv := range env {
+		if strings.HasPrefix(kv, name+"=") {
+			env[i] = name + "=" + value
+			return env
+		}
+	}
+	return append(env, name+"="+value)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnv_Passes(t *testing.T) {
+	var defaults Env
+	assert.True(t, defaults.Passes("PATH"))
+	assert.True(t, defaults.Passes("ANTHROPIC_API_KEY"))
+	assert.False(t, defaults.Passes("AWS_SECRET_ACCESS_KEY"))
+	assert.False(t, defaults.Passes("GITHUB_TOKEN"))
+	assert.False(t, defaults.Passes("DB_PASSWORD"))
+
+	allow := Env{Allow: []string{"PATH", "HOME", "GITHUB_TOKEN"}}
+	assert.True(t, allow.Passes("PATH"))
+	assert.True(t, allow.Passes("GITHUB_TOKEN"), "allow beats the default deny list")
+	assert.False(t, allow.Passes("ANTHROPIC_API_KEY"), "only allowed variables pass")
+
+	deny := Env{Allow: []string{"*"}, Deny: []string{"NPM_*"}}
+	assert.True(t, deny.Passes("AWS_PROFILE"))
+	assert.False(t, deny.Passes("NPM_CONFIG_TOKEN"), "deny beats allow")
+}
+
+func TestEnv_Environ(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(file, []byte(`# agent keys
+export OPENAI_API_KEY="sk-file-123456"
+MODE=dev # comment
+QUOTED='a b'
+`), 0644))
+
+	e := Env{
+		Set:   map[string]string{"MODE": "test", "GOFLAGS": "-count=1", "DB_PASSWORD": "set-password"},
+		Files: []string{file},
+	}
+	env, secrets, err := e.Environ([]string{"PATH=/bin", "AWS_SECRET_ACCESS_KEY=aws-secret-value", "GITHUB_TOKEN=ghp",
+		"ANTHROPIC_API_KEY=sk-ant-passed", "HOME=/home/someone", "MODE=prod"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"PATH=/bin", "ANTHROPIC_API_KEY=sk-ant-passed", "HOME=/home/someone", "MODE=test",
+		"OPENAI_API_KEY=sk-file-123456", "QUOTED=a b", "DB_PASSWORD=set-password", "GOFLAGS=-count=1"}, env)
+	assert.Equal(t, []string{"aws-secret-value", "sk-ant-passed", "sk-file-123456", "set-password"}, secrets,
+		"withheld, .env and secret-named values are secrets; short values are not scrubbed")
+
+	_, _, err = Env{Files: []string{filepath.Join(dir, "missing")}}.Environ(nil)
+	assert.ErrorContains(t, err, "agent.env.files")
+}
+
+func TestReadEnvFile_Invalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(file, []byte("OK=1\nnot a variable\n"), 0644))
+
+	_, err := ReadEnvFile(file)
+	assert.ErrorContains(t, err, ":2: expected KEY=value")
+}
+
+func TestParse_Env(t *testing.T) {
+	cfg, err := Parse([]byte(`agent:
+  command: agent
+  env:
+    allow: [PATH, "GO*"]
+    set:
+      CI: "true"
+validate:
+  command: go test ./...
+`))
+	require.NoError(t, err)
+	assert.Equal(t, Env{Allow: []string{"PATH", "GO*"}, Set: map[string]string{"CI": "true"}}, cfg.Agent.Env)
+
+	_, err = Parse([]byte(`agent:
+  command: agent
+  env:
+    deny: ["AWS_["]
+validate:
+  command: go test ./...
+`))
+	assert.ErrorContains(t, err, `agent.env.deny: invalid pattern "AWS_["`)
+}
+
+func TestSnapshot_RedactsSecrets(t *testing.T) {
+	cfg, err := Parse([]byte(`agent:
+  command: agent
+  env:
+    set:
+      CI: "true"
+      OPENAI_API_KEY: sk-top-level
+validate:
+  command: go test ./...
+profiles:
+  ci:
+    agent:
+      env:
+        set:
+          GITHUB_TOKEN: ghp-profile
+`))
+	require.NoError(t, err)
+
+	data, err := Snapshot(cfg)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "sk-top-level")
+	assert.NotContains(t, string(data), "ghp-profile")
+	assert.Equal(t, "sk-top-level", cfg.Agent.Env.Set["OPENAI_API_KEY"], "cfg is not changed")
+
+	saved, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"CI": "true", "OPENAI_API_KEY": Redacted}, saved.Agent.Env.Set)
+	profile, err := ParseProfile(data, "ci")
+	require.NoError(t, err)
+	assert.Equal(t, Redacted, profile.Agent.Env.Set["GITHUB_TOKEN"])
+
+	assert.Empty(t, saved.Agent.Env.Restore(cfg.Agent.Env))
+	assert.Equal(t, "sk-top-level", saved.Agent.Env.Set["OPENAI_API_KEY"])
+	assert.Equal(t, []string{"GITHUB_TOKEN"}, profile.Agent.Env.Restore(cfg.Agent.Env))
+}
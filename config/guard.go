@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// What the runner does when the agent changes a protected file
+// (guard.on_violation).
+const (
+	// GuardRevert restores the protected files and tells the agent on the
+	// next iteration. The iteration is still validated.
+	GuardRevert = "revert"
+	// GuardFail fails the iteration without validating it, until the agent
+	// restores the files itself.
+	GuardFail = "fail"
+)
+
+// Guard keeps the agent from making validation pass by editing what
+// validates it.
+type Guard struct {
+	// ProtectedPaths are globs of files the agent must not create, modify
+	// or delete (see MatchPath), e.g. "*_test.go", "tatsu.yaml",
+	// ".github/".
+	ProtectedPaths []string `yaml:"protected_paths,omitempty"`
+	// OnViolation is GuardRevert (the default) or GuardFail.
+	OnViolation string `yaml:"on_violation,omitempty"`
+}
+
+// Enabled reports whether any paths are protected.
+func (g Guard) Enabled() bool {
+	return len(g.ProtectedPaths) > 0
+}
+
+// Protects reports whether the slash-separated path name, relative to the
+// directory tatsu runs in, matches one of ProtectedPaths.
+func (g Guard) Protects(name string) bool {
+	for _, pattern := range g.ProtectedPaths {
+		if MatchPath(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPath reports whether the slash-separated path name matches pattern,
+// with gitignore-like rules: a pattern without a slash matches a file or
+// directory name anywhere ("*_test.go"); otherwise it matches from the
+// directory tatsu runs in ("docs/*.md"), and ** matches any number of
+// directories ("src/**/fixtures"). A path inside a matching directory
+// matches too (".github/").
+func MatchPath(pattern, name string) bool {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/")
+	segs := strings.Split(name, "/")
+	if !strings.Contains(pattern, "/") {
+		for _, seg := range segs {
+			if ok, _ := path.Match(pattern, seg); ok {
+				return true
+			}
+		}
+		return false
+	}
+	pat := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	for n := len(segs); n >= 1; n-- {
+		if matchSegments(pat, segs[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pat, segs []string) bool {
+	if len(pat) == 0 {
+		return len(segs) == 0
+	}
+	if pat[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegments(pat[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pat[0], segs[0])
+	return ok && matchSegments(pat[1:], segs[1:])
+}
+
+// validateGuard checks the guard section.
+func validateGuard(g Guard) error {
+	switch g.OnViolation {
+	case "", GuardRevert, GuardFail:
+	default:
+		return fmt.Errorf("guard.on_violation must be %s or %s", GuardRevert, GuardFail)
+	}
+	for _, pattern := range g.ProtectedPaths {
+		if strings.Trim(pattern, "./") == "" {
+			return fmt.Errorf("guard.protected_paths: invalid pattern %q", pattern)
+		}
+		for _, seg := range strings.Split(pattern, "/") {
+			if _, err := path.Match(seg, ""); err != nil {
+				return fmt.Errorf("guard.protected_paths: invalid pattern %q", pattern)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*_test.go", "foo_test.go", true},
+		{"*_test.go", "pkg/sub/foo_test.go", true},
+		{"*_test.go", "foo.go", false},
+		{"tatsu.yaml", "tatsu.yaml", true},
+		{"tatsu.yaml", "sub/tatsu.yaml", true},
+		{"./tatsu.yaml", "tatsu.yaml", true},
+		{".github/", ".github/workflows/ci.yml", true},
+		{".github/workflows/*.yml", ".github/workflows/ci.yml", true},
+		{"docs/*.md", "docs/a/b.md", false},
+		{"src/**/fixtures", "src/a/b/fixtures/x.json", true},
+		{"src/**/*.snap", "src/x.snap", true},
+		{"/tests/**", "tests/unit/a.py", true},
+		{"/tests/**", "src/tests/a.py", false},
+		{"testdata", "pkg/testdata/in.txt", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, MatchPath(tt.pattern, tt.path), "%s ~ %s", tt.pattern, tt.path)
+	}
+}
+
+func TestParse_Guard(t *testing.T) {
+	cfg, err := Parse([]byte(`agent:
+  command: agent
+validate:
+  command: go test ./...
+guard:
+  protected_paths: ["*_test.go", tatsu.yaml]
+  on_violation: fail
+`))
+	require.NoError(t, err)
+	assert.Equal(t, Guard{ProtectedPaths: []string{"*_test.go", "tatsu.yaml"}, OnViolation: GuardFail}, cfg.Guard)
+	assert.True(t, cfg.Guard.Protects("pkg/a_test.go"))
+
+	_, err = Parse([]byte(`agent:
+  command: agent
+validate:
+  command: go test ./...
+guard:
+  on_violation: ask
+`))
+	assert.ErrorContains(t, err, "guard.on_violation must be revert or fail")
+
+	_, err = Parse([]byte(`agent:
+  command: agent
+validate:
+  command: go test ./...
+guard:
+  protected_paths: ["src/[a"]
+`))
+	assert.ErrorContains(t, err, "invalid pattern")
+}
@@ -0,0 +1,544 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the name of the project config file.
+const ProjectFile = "tatsu.yaml"
+
+// EnvPrefix starts the environment variables that override config values:
+// TATSU_ and the key path in upper case with _ for ., e.g. TATSU_TIMEOUT or
+// TATSU_AGENT_COMMAND.
+const EnvPrefix = "TATSU_"
+
+// ProfileKeys are the top-level keys a profile may set.
+var ProfileKeys = []string{"agent", "validate", "max_iterations", "patience", "timeout"}
+
+// Options selects the config layers to read. Each layer overrides the
+// values of the ones before it: the global file (GlobalFile), the project
+// file (FindProjectFile, or File), the selected profile, TATSU_*
+// environment variables, then command-line flags. Mappings are merged key by key; any other value (a
+// string, a list such as validate.stages) replaces the earlier one as a
+// whole.
+type Options struct {
+	// File is the project config to read instead of searching for
+	// tatsu.yaml (the -config flag).
+	File string
+	// Environ is where TATSU_* variables are read; nil means os.Environ().
+	Environ []string
+	// Flags are the command-line overrides, applied last.
+	Flags []Flag
+	// Profile selects the profile to apply (the -profile flag). Empty
+	// means TATSU_PROFILE, else the profile key of the files, else none.
+	Profile string
+}
+
+// Flag is a config value set by a command-line flag.
+type Flag struct {
+	Name  string // the flag, e.g. "timeout"
+	Key   string // the key path it sets, e.g. "timeout"
+	Value string
+}
+
+// Layers is the merged config tree and where each of its values came from.
+type Layers struct {
+	// Files are the config files read, lowest precedence first.
+	Files []string
+	// Origins maps the key path of each value set (e.g. "agent.command")
+	// to its source: a file, "profile NAME", "env TATSU_..." or "flag -...".
+	Origins map[string]string
+	// Profile is the profile applied, if any.
+	Profile string
+	// Notes describe how files of older versions were migrated, e.g.
+	// "tatsu.yaml: version 1: agent.x is now agent.y".
+	Notes []string
+	// Warnings describe input that was ignored, e.g. an unknown TATSU_*
+	// variable.
+	Warnings []string
+
+	root *yaml.Node
+}
+
+// GlobalFile returns the user's config file:
+// $XDG_CONFIG_HOME/tatsu/config.yaml, or ~/.config/tatsu/config.yaml. It is
+// empty if neither variable is set.
+func GlobalFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "tatsu", "config.yaml")
+}
+
+// FindProjectFile looks for tatsu.yaml in dir and then its parents and
+// returns its path, or "" if there is none.
+func FindProjectFile(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Resolve reads and merges the config layers. A missing global file is
+// skipped; a missing project file is an error.
+func Resolve(opts Options) (*Layers, error) {
+	l := &Layers{Origins: make(map[string]string), root: &yaml.Node{Kind: yaml.MappingNode}}
+
+	if global := GlobalFile(); global != "" {
+		if _, err := os.Stat(global); err == nil {
+			if err := l.mergeFile(global); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	project := opts.File
+	if project == "" {
+		if project = FindProjectFile("."); project == "" {
+			return nil, fmt.Errorf("tatsu.yaml not found. Create one with:\n\nagent:\n  command: 'opencode run \"%%s\"'\nvalidate:\n  command: 'go test ./...'")
+		}
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, project); err == nil {
+				project = rel
+			}
+		}
+	}
+	if err := l.mergeFile(project); err != nil {
+		return nil, err
+	}
+
+	environ := append([]string(nil), opts.Environ...)
+	if opts.Environ == nil {
+		environ = os.Environ()
+	}
+	sort.Strings(environ)
+
+	profile := opts.Profile
+	for _, kv := range environ {
+		if name, value, _ := strings.Cut(kv, "="); profile == "" && name == EnvName("profile") {
+			profile = value
+		}
+	}
+	if profile == "" {
+		if i := mappingIndex(l.root, "profile"); i >= 0 {
+			profile = l.root.Content[i+1].Value
+		}
+	}
+	if err := l.applyProfile(profile); err != nil {
+		return nil, err
+	}
+
+	keys := envKeys()
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		key, ok := keys[name]
+		if !ok {
+			if name != PromptEnv {
+				l.Warnings = append(l.Warnings, unknownEnv(name, keys))
+			}
+			continue
+		}
+		if err := l.set(key, value, "env "+name); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	for _, f := range opts.Flags {
+		if err := l.set(f.Key, f.Value, "flag -"+f.Name); err != nil {
+			return nil, fmt.Errorf("-%s: %w", f.Name, err)
+		}
+	}
+	if opts.Profile != "" {
+		if err := l.set("profile", opts.Profile, "flag -profile"); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// ParseProfile is Parse with the named profile of the config applied over
+// it, e.g. for a PRD task that asks for another profile than its run's
+// saved config.
+func ParseProfile(data []byte, name string) (*Config, error) {
+	l := &Layers{Origins: make(map[string]string), root: &yaml.Node{Kind: yaml.MappingNode}}
+	if err := l.mergeData(data, "config", ""); err != nil {
+		return nil, err
+	}
+	if err := l.applyProfile(name); err != nil {
+		return nil, err
+	}
+	if err := l.set("profile", name, "profile "+name); err != nil {
+		return nil, err
+	}
+	return l.Config()
+}
+
+// Profiles returns the names of the profiles defined, sorted.
+func (l *Layers) Profiles() []string {
+	return profileNames(l.root)
+}
+
+// applyProfile merges the named profile over the tree. An empty name
+// applies none. A profile's validate.command or validate.stages replaces
+// the other, so that profiles can choose between a command and stages.
+func (l *Layers) applyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	profile, err := findProfile(l.root, name)
+	if err != nil {
+		return err
+	}
+	if i, j := mappingIndex(profile, "validate"), mappingIndex(l.root, "validate"); i >= 0 && j >= 0 {
+		for key, other := range map[string]string{"command": "stages", "stages": "command"} {
+			validate := l.root.Content[j+1]
+			if mappingIndex(profile.Content[i+1], key) >= 0 {
+				if k := mappingIndex(validate, other); k >= 0 {
+					validate.Content = append(validate.Content[:k:k], validate.Content[k+2:]...)
+					l.forget("validate." + other)
+				}
+			}
+		}
+	}
+	l.merge(l.root, copyNode(profile), "", "profile "+name)
+	l.Profile = name
+	return nil
+}
+
+// findProfile returns profiles.<name> of the tree.
+func findProfile(root *yaml.Node, name string) (*yaml.Node, error) {
+	var profile *yaml.Node
+	if i := mappingIndex(root, "profiles"); i >= 0 {
+		if j := mappingIndex(root.Content[i+1], name); j >= 0 {
+			profile = root.Content[i+1].Content[j+1]
+		}
+	}
+	if profile == nil {
+		names := profileNames(root)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown profile %q: no profiles are defined", name)
+		}
+		return nil, fmt.Errorf("unknown profile %q (profiles: %s)", name, strings.Join(names, ", "))
+	}
+	if profile.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("profiles.%s: expected a mapping of config keys", name)
+	}
+	return profile, nil
+}
+
+func profileNames(root *yaml.Node) []string {
+	i := mappingIndex(root, "profiles")
+	if i < 0 {
+		return nil
+	}
+	var names []string
+	m := root.Content[i+1]
+	for j := 0; j+1 < len(m.Content); j += 2 {
+		names = append(names, m.Content[j].Value)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadWith resolves the config layers and parses the result.
+func LoadWith(opts Options) (*Config, error) {
+	l, err := Resolve(opts)
+	if err != nil {
+		return nil, err
+	}
+	return l.Config()
+}
+
+// Config decodes and validates the merged config. Every profile must also
+// give a valid config when applied over it.
+func (l *Layers) Config() (*Config, error) {
+	cfg, err := decode(l.root)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range l.Profiles() {
+		if name == l.Profile {
+			continue
+		}
+		p := &Layers{Origins: make(map[string]string), root: copyNode(l.root)}
+		if err := p.applyProfile(name); err != nil {
+			return nil, err
+		}
+		if _, err := decode(p.root); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+func decode(root *yaml.Node) (*Config, error) {
+	var cfg Config
+	if err := root.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if err := validate(&cfg); err != nil {
+		return nil, err
+	}
+	cfg.Version = CurrentVersion
+	return &cfg, nil
+}
+
+// YAML renders the merged config. With origins, each value is followed by
+// a comment naming its source.
+func (l *Layers) YAML(origins bool) ([]byte, error) {
+	root := l.root
+	if origins {
+		root = copyNode(root)
+		l.annotate(root, "")
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+	return yaml.Marshal(root)
+}
+
+func (l *Layers) annotate(m *yaml.Node, prefix string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key, value := m.Content[i], m.Content[i+1]
+		path := prefix + key.Value
+		if origin, ok := l.Origins[path]; ok {
+			if value.Kind == yaml.ScalarNode {
+				value.LineComment = origin
+			} else {
+				key.LineComment = origin
+			}
+			continue
+		}
+		if value.Kind == yaml.MappingNode {
+			l.annotate(value, path+".")
+		}
+	}
+}
+
+// mergeFile merges a YAML config file into the tree.
+func (l *Layers) mergeFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	l.Files = append(l.Files, path)
+	return l.mergeData(data, path, filepath.Dir(path))
+}
+
+// mergeData merges YAML config content from source into the tree. Relative
+// prompt files are resolved against dir, if set.
+func (l *Layers) mergeData(data []byte, path, dir string) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: failed to parse YAML: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	m := doc.Content[0]
+	if m.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: expected a mapping of config keys", path)
+	}
+	notes, err := checkFile(m, path)
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		l.Notes = append(l.Notes, path+": "+note)
+	}
+	stripComments(m)
+	if dir != "" {
+		resolvePromptFiles(m, dir)
+	}
+	l.merge(l.root, m, "", path)
+	return nil
+}
+
+// resolvePromptFiles makes the relative agent.prompt_file and
+// agent.retry_prompt_file paths of a config file (top-level and in
+// profiles) relative to dir, the file's directory, instead of to wherever
+// tatsu runs.
+func resolvePromptFiles(m *yaml.Node, dir string) {
+	for _, agent := range agentNodes(m) {
+		for _, key := range []string{"prompt_file", "retry_prompt_file"} {
+			i := mappingIndex(agent.node, key)
+			if i < 0 {
+				continue
+			}
+			if v := agent.node.Content[i+1]; v.Kind == yaml.ScalarNode && v.Value != "" && !filepath.IsAbs(v.Value) {
+				v.Value = filepath.Join(dir, v.Value)
+			}
+		}
+	}
+}
+
+// set merges a single value at the dotted key path. String values are
+// taken as they are; other values (numbers, durations, lists) are parsed
+// as YAML and checked against the schema.
+func (l *Layers) set(key, value, origin string) error {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	if !valueKeys[key] {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+			return fmt.Errorf("%s: invalid value %q: %w", key, value, err)
+		}
+		if len(doc.Content) > 0 {
+			node = doc.Content[0]
+			stripComments(node)
+			blockStyle(node)
+		}
+	}
+	if s := configSchema.lookup(key); s != nil {
+		var problems []string
+		s.check(node, key, func(_ *yaml.Node, format string, args ...any) {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		})
+		if len(problems) > 0 {
+			return fmt.Errorf("%s (got %q)", strings.Join(problems, "; "), value)
+		}
+	}
+	parts := strings.Split(key, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		node = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: parts[i]}, node,
+		}}
+	}
+	l.merge(l.root, node, "", origin)
+	return nil
+}
+
+// merge copies the keys of src into dst. Mappings that are not config
+// values themselves (see configKeys) are merged recursively; anything else
+// replaces what dst had.
+func (l *Layers) merge(dst, src *yaml.Node, prefix, origin string) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		path := prefix + key.Value
+		j := mappingIndex(dst, key.Value)
+		if value.Kind == yaml.MappingNode && !leafKey(path) {
+			if j < 0 || dst.Content[j+1].Kind != yaml.MappingNode {
+				l.forget(path)
+				sub := &yaml.Node{Kind: yaml.MappingNode}
+				if j < 0 {
+					dst.Content = append(dst.Content, key, sub)
+				} else {
+					dst.Content[j+1] = sub
+				}
+				l.merge(sub, value, path+".", origin)
+				continue
+			}
+			l.merge(dst.Content[j+1], value, path+".", origin)
+			continue
+		}
+		l.forget(path)
+		l.Origins[path] = origin
+		if j < 0 {
+			dst.Content = append(dst.Content, key, value)
+		} else {
+			dst.Content[j+1] = value
+		}
+	}
+}
+
+// forget drops the origins of path and everything under it.
+func (l *Layers) forget(path string) {
+	for p := range l.Origins {
+		if p == path || strings.HasPrefix(p, path+".") {
+			delete(l.Origins, p)
+		}
+	}
+}
+
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func stripComments(n *yaml.Node) {
+	n.HeadComment, n.LineComment, n.FootComment = "", "", ""
+	for _, c := range n.Content {
+		stripComments(c)
+	}
+}
+
+// blockStyle renders n like a value written in tatsu.yaml rather than on
+// one line, e.g. a list from an environment variable.
+func blockStyle(n *yaml.Node) {
+	n.Style &^= yaml.FlowStyle
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+// envKeys maps each TATSU_* variable name to the key path it sets.
+func envKeys() map[string]string {
+	vars := make(map[string]string, len(valueKeys))
+	for key := range valueKeys {
+		vars[EnvName(key)] = key
+	}
+	return vars
+}
+
+// unknownEnv describes a TATSU_* variable that sets no config key, with
+// the variable most like it.
+func unknownEnv(name string, keys map[string]string) string {
+	names := make([]string, 0, len(keys))
+	for n := range keys {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	msg := fmt.Sprintf("%s is not a config setting and was ignored", name)
+	if similar := closest(name, names); similar != "" {
+		msg += fmt.Sprintf(" (did you mean %s?)", similar)
+	}
+	return msg
+}
+
+// EnvName returns the environment variable that sets the key path, e.g.
+// TATSU_AGENT_TIMEOUT for agent.timeout.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+func leafKey(path string) bool {
+	_, ok := valueKeys[path]
+	return ok
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// inLayers sets up a global config and a project whose tatsu.yaml is in
+// the parent of the directory fn runs in.
+func inLayers(t *testing.T, global, project string, fn func()) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	if global != "" {
+		require.NoError(t, os.MkdirAll(filepath.Join(home, "tatsu"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(home, "tatsu", "config.yaml"), []byte(global), 0644))
+	}
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, ProjectFile), []byte(project), 0644))
+	sub := filepath.Join(root, "sub")
+	require.NoError(t, os.Mkdir(sub, 0755))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(sub))
+	defer os.Chdir(wd)
+	fn()
+}
+
+const globalYAML = `agent:
+  command: 'opencode run "%s"'
+  timeout: 10m
+timeout: 1h
+patience: 5
+`
+
+const projectYAML = `# project settings
+validate:
+  command: go test ./...
+agent:
+  timeout: 20m
+`
+
+func TestResolve_Layers(t *testing.T) {
+	inLayers(t, globalYAML, projectYAML, func() {
+		l, err := Resolve(Options{
+			Environ: []string{"TATSU_TIMEOUT=2h", "TATSU_AGENT_COMMAND=aider --message %s", "TATSU_UNKNOWN=x", "HOME=/root"},
+			Flags:   []Flag{{Name: "timeout", Key: "timeout", Value: "30m"}},
+		})
+		require.NoError(t, err)
+		cfg, err := l.Config()
+		require.NoError(t, err)
+
+		assert.Equal(t, "aider --message %s", cfg.Agent.Command, "env overrides the global file")
+		assert.Equal(t, 20*time.Minute, cfg.Agent.Timeout, "the project overrides the global file")
+		assert.Equal(t, "go test ./...", cfg.Validate.Command)
+		assert.Equal(t, 30*time.Minute, cfg.Timeout, "flags override env")
+		assert.Equal(t, 5, cfg.Patience)
+
+		global := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "tatsu", "config.yaml")
+		assert.Equal(t, []string{global, filepath.Join("..", ProjectFile)}, l.Files)
+		assert.Equal(t, map[string]string{
+			"agent.command":    "env TATSU_AGENT_COMMAND",
+			"agent.timeout":    filepath.Join("..", ProjectFile),
+			"validate.command": filepath.Join("..", ProjectFile),
+			"timeout":          "flag -timeout",
+			"patience":         global,
+		}, l.Origins)
+		assert.Equal(t, []string{"TATSU_UNKNOWN is not a config setting and was ignored"}, l.Warnings)
+	})
+}
+
+func TestLayers_YAML(t *testing.T) {
+	inLayers(t, "", projectYAML, func() {
+		l, err := Resolve(Options{Environ: []string{"TATSU_VALIDATE_STAGES=[{name: unit, command: go test}]", "TATSU_AGENT_HARNESS=aider"}})
+		require.NoError(t, err)
+
+		data, err := l.YAML(true)
+		require.NoError(t, err)
+		project := filepath.Join("..", ProjectFile)
+		assert.Equal(t, `validate:
+    command: go test ./... # `+project+`
+    stages: # env TATSU_VALIDATE_STAGES
+        - name: unit
+          command: go test
+agent:
+    timeout: 20m # `+project+`
+    harness: aider # env TATSU_AGENT_HARNESS
+`, string(data))
+
+		_, err = l.Config()
+		assert.ErrorContains(t, err, "set either validate.command or validate.stages")
+	})
+}
+
+func TestResolve_Errors(t *testing.T) {
+	inLayers(t, "agent: [", projectYAML, func() {
+		_, err := Resolve(Options{})
+		assert.ErrorContains(t, err, filepath.Join("tatsu", "config.yaml")+": failed to parse YAML")
+	})
+	inLayers(t, "", projectYAML, func() {
+		_, err := Resolve(Options{Environ: []string{"TATSU_PATIENCE=[1"}})
+		assert.ErrorContains(t, err, "TATSU_PATIENCE")
+
+		_, err = Resolve(Options{Environ: []string{"TATSU_MAX_ITERATIONS=abc"}})
+		assert.EqualError(t, err, `TATSU_MAX_ITERATIONS: max_iterations must be a whole number (got "abc")`)
+
+		_, err = Resolve(Options{Environ: []string{"TATSU_AGENT_TIMEOUT=soon"}})
+		assert.ErrorContains(t, err, "TATSU_AGENT_TIMEOUT: agent.timeout must be a duration")
+
+		_, err = Resolve(Options{Flags: []Flag{{Name: "patience", Key: "patience", Value: "[1]"}}})
+		assert.ErrorContains(t, err, "-patience: patience must be a whole number")
+
+		_, err = Resolve(Options{File: "missing.yaml"})
+		assert.ErrorContains(t, err, "missing.yaml")
+
+		require.NoError(t, os.Remove(filepath.Join("..", ProjectFile)))
+		_, err = Resolve(Options{})
+		assert.ErrorContains(t, err, "tatsu.yaml not found")
+	})
+}
+
+func TestResolve_UnknownEnv(t *testing.T) {
+	inLayers(t, "", projectYAML, func() {
+		l, err := Resolve(Options{Environ: []string{
+			"TATSU_VALIDAT_COMMAND=make test",
+			"TATSU_PROMPT=the prompt of an agent tatsu started",
+			"TATSU_PROFILE=",
+		}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"TATSU_VALIDAT_COMMAND is not a config setting and was ignored (did you mean TATSU_VALIDATE_COMMAND?)",
+		}, l.Warnings)
+	})
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "TATSU_AGENT_SESSION_RESET_AFTER", EnvName("agent.session.reset_after"))
+	keys := envKeys()
+	assert.Equal(t, "agent.command", keys["TATSU_AGENT_COMMAND"])
+	assert.Equal(t, "validate.baseline.if_passing", keys["TATSU_VALIDATE_BASELINE_IF_PASSING"])
+	assert.Equal(t, "permissions", keys["TATSU_PERMISSIONS"], "permissions are a single value")
+	assert.NotContains(t, keys, "TATSU_AGENT", "mappings are not values")
+}
+
+const profilesYAML = `agent:
+  command: 'opencode run "%s"'
+validate:
+  command: go test -short ./...
+max_iterations: 5
+profile: fast
+profiles:
+  fast:
+    agent:
+      command: 'opencode run -m cheap "%s"'
+  thorough:
+    max_iterations: 20
+    validate:
+      stages:
+        - name: test
+          command: go test ./...
+        - name: lint
+          command: golangci-lint run
+`
+
+func TestResolve_Profiles(t *testing.T) {
+	inLayers(t, "", profilesYAML, func() {
+		l, err := Resolve(Options{})
+		require.NoError(t, err)
+		cfg, err := l.Config()
+		require.NoError(t, err)
+		assert.Equal(t, "fast", cfg.Profile, "profile in tatsu.yaml")
+		assert.Equal(t, `opencode run -m cheap "%s"`, cfg.Agent.Command)
+		assert.Equal(t, "profile fast", l.Origins["agent.command"])
+		assert.Equal(t, []string{"fast", "thorough"}, l.Profiles())
+
+		l, err = Resolve(Options{Environ: []string{"TATSU_PROFILE=thorough"}})
+		require.NoError(t, err)
+		cfg, err = l.Config()
+		require.NoError(t, err)
+		assert.Equal(t, "thorough", cfg.Profile)
+		assert.Equal(t, "env TATSU_PROFILE", l.Origins["profile"])
+		assert.Equal(t, `opencode run "%s"`, cfg.Agent.Command)
+		assert.Equal(t, 20, cfg.MaxIterations)
+		assert.Empty(t, cfg.Validate.Command, "the profile's stages replace validate.command")
+		assert.Len(t, cfg.Validate.Stages, 2)
+
+		cfg, err = LoadWith(Options{
+			Profile: "thorough",
+			Environ: []string{"TATSU_PROFILE=fast"},
+			Flags:   []Flag{{Name: "max-iterations", Key: "max_iterations", Value: "7"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "thorough", cfg.Profile, "the flag overrides TATSU_PROFILE")
+		assert.Equal(t, 7, cfg.MaxIterations, "flags override the profile")
+
+		_, err = Resolve(Options{Profile: "slow"})
+		assert.ErrorContains(t, err, `unknown profile "slow" (profiles: fast, thorough)`)
+	})
+}
+
+func TestResolve_PromptFilesNextToConfig(t *testing.T) {
+	global := "agent:\n  retry_prompt_file: retry.tmpl\n"
+	project := "validate:\n  command: go test ./...\nagent:\n  command: x\n  prompt_file: prompts/task.tmpl\n" +
+		"profiles:\n  short:\n    agent:\n      prompt_file: prompts/short.tmpl\n"
+	inLayers(t, global, project, func() {
+		root := filepath.Dir(FindProjectFile("."))
+		require.NoError(t, os.Mkdir(filepath.Join(root, "prompts"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "prompts", "task.tmpl"), []byte("do {{.Task}}"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "prompts", "short.tmpl"), []byte("{{.Task}}"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(GlobalFile()), "retry.tmpl"), []byte("again: {{.Task}}"), 0644))
+
+		// Run from a subdirectory of the project: the files are found next
+		// to the config that names them
+		cfg, err := LoadWith(Options{})
+		require.NoError(t, err)
+		assert.Equal(t, "do {{.Task}}", cfg.Agent.Prompt)
+		assert.Equal(t, "again: {{.Task}}", cfg.Agent.RetryPrompt)
+
+		cfg, err = LoadWith(Options{Profile: "short"})
+		require.NoError(t, err)
+		assert.Equal(t, "{{.Task}}", cfg.Agent.Prompt)
+	})
+}
+
+func TestResolve_ProfileErrors(t *testing.T) {
+	inLayers(t, "", projectYAML+"agent:\n  command: x\nprofiles:\n  bad:\n    guard:\n      protected_paths: [a]\n", func() {
+		_, err := Resolve(Options{Profile: "bad"})
+		assert.ErrorContains(t, err, "tatsu.yaml:10:5: unknown key profiles.bad.guard (a profile can only set agent, validate")
+	})
+	inLayers(t, "", projectYAML+"agent:\n  command: x\nprofiles:\n  slow:\n    max_iterations: 500\n", func() {
+		_, err := LoadWith(Options{})
+		assert.ErrorContains(t, err, "profile slow: max_iterations must be between 1 and 100")
+	})
+}
+
+func TestParseProfile(t *testing.T) {
+	inLayers(t, "", profilesYAML, func() {
+		cfg, err := LoadWith(Options{})
+		require.NoError(t, err)
+		snapshot, err := yaml.Marshal(cfg)
+		require.NoError(t, err)
+
+		parsed, err := Parse(snapshot)
+		require.NoError(t, err)
+		assert.Equal(t, "fast", parsed.Profile)
+		assert.Equal(t, cfg.Agent.Command, parsed.Agent.Command)
+
+		thorough, err := ParseProfile(snapshot, "thorough")
+		require.NoError(t, err)
+		assert.Equal(t, "thorough", thorough.Profile)
+		assert.Equal(t, 20, thorough.MaxIterations)
+		assert.Len(t, thorough.Validate.Stages, 2)
+	})
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Permission actions. There is no "ask": nobody is there to answer.
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// Rule allows or denies the shell commands matching Pattern, where *
+// matches anything (e.g. "git push*").
+type Rule struct {
+	Pattern string
+	Action  string
+}
+
+// Permissions is the agent's permission policy: the permissions section of
+// tatsu.yaml, merged over DefaultPermissions by EffectivePermissions.
+//
+//	permissions:
+//	  webfetch: deny          # a tool: edit, write, read, webfetch, ... or "*"
+//	  bash:                   # or a single action for the "*" pattern
+//	    "git push*": allow
+//	    "docker *": deny
+type Permissions struct {
+	// Tools maps an agent tool, or "*" for every tool, to an action.
+	Tools map[string]string
+	// Bash rules apply to shell commands in order; the last matching rule
+	// wins, so "*" comes first.
+	Bash []Rule
+}
+
+// DefaultPermissions is the policy the agent runs with unless tatsu.yaml
+// overrides it: the tools that read and edit the project, and the shell
+// commands that inspect it, build it and run its tests. Everything else is
+// denied. The commands that publish work or destroy it beyond what a
+// checkpoint can restore are denied again last, so that a broader allow
+// rule added by tatsu.yaml does not let them through.
+func DefaultPermissions() Permissions {
+	p := Permissions{
+		Tools: map[string]string{
+			"*":         Deny,
+			"read":      Allow,
+			"edit":      Allow,
+			"write":     Allow,
+			"patch":     Allow,
+			"glob":      Allow,
+			"grep":      Allow,
+			"list":      Allow,
+			"todoread":  Allow,
+			"todowrite": Allow,
+		},
+		Bash: []Rule{
+			{"*", Deny},
+			// Inspect
+			{"ls*", Allow},
+			{"pwd", Allow},
+			{"cat *", Allow},
+			{"head *", Allow},
+			{"tail *", Allow},
+			{"wc *", Allow},
+			{"grep *", Allow},
+			{"rg *", Allow},
+			{"diff *", Allow},
+			{"git status*", Allow},
+			{"git diff*", Allow},
+			{"git log*", Allow},
+			{"git show*", Allow},
+			// Build and test
+			{"make*", Allow},
+			{"go build*", Allow},
+			{"go test*", Allow},
+			{"go vet*", Allow},
+			{"gofmt*", Allow},
+			{"cargo build*", Allow},
+			{"cargo test*", Allow},
+			{"cargo check*", Allow},
+			{"npm test*", Allow},
+			{"npm run *", Allow},
+			{"pytest*", Allow},
+			{"python -m pytest*", Allow},
+		},
+	}
+	p.Bash = append(p.Bash, neverRules()...)
+	return p
+}
+
+// neverRules are the bash rules DefaultPermissions ends with: commands
+// that publish work or destroy it beyond what a checkpoint can restore.
+// EffectivePermissions keeps them last, so only a rule for the same
+// pattern changes them.
+func neverRules() []Rule {
+	return []Rule{
+		{"git push*", Deny},
+		{"git reset --hard*", Deny},
+		{"git clean*", Deny},
+		{"rm -rf*", Deny},
+		{"sudo *", Deny},
+	}
+}
+
+// Override is a default permission rule changed by tatsu.yaml.
+type Override struct {
+	Rule    string // e.g. `bash "git push*"` or `tool webfetch`
+	Default string
+	Action  string
+}
+
+func (o Override) String() string {
+	return fmt.Sprintf("%s: %s → %s", o.Rule, o.Default, o.Action)
+}
+
+// EffectivePermissions returns the policy the agent runs with:
+// DefaultPermissions with the rules of the permissions section applied on
+// top, and the default rules they changed. A bash rule for a pattern the
+// defaults have replaces it in place; other rules are added after the
+// defaults, so they win over them, but before the never rules
+// (neverRules), which stay last so that a broad rule such as "git *" does
+// not let "git push" through.
+func (c *Config) EffectivePermissions() (Permissions, []Override) {
+	p := DefaultPermissions()
+	if c.Permissions == nil {
+		return p, nil
+	}
+	var overrides []Override
+
+	for _, tool := range sortedTools(c.Permissions.Tools) {
+		action := c.Permissions.Tools[tool]
+		if def, ok := p.Tools[tool]; ok && def != action {
+			overrides = append(overrides, Override{Rule: "tool " + tool, Default: def, Action: action})
+		}
+		p.Tools[tool] = action
+	}
+
+	var added []Rule
+	for _, rule := range c.Permissions.Bash {
+		replaced := false
+		for i, def := range p.Bash {
+			if def.Pattern != rule.Pattern {
+				continue
+			}
+			if def.Action != rule.Action {
+				overrides = append(overrides, Override{Rule: fmt.Sprintf("bash %q", rule.Pattern), Default: def.Action, Action: rule.Action})
+			}
+			p.Bash[i].Action = rule.Action
+			replaced = true
+			break
+		}
+		if !replaced {
+			added = append(added, rule)
+		}
+	}
+	at := len(p.Bash) - len(neverRules())
+	p.Bash = append(p.Bash[:at:at], append(added, p.Bash[at:]...)...)
+	return p, overrides
+}
+
+// ToolNames returns the tools the policy has an action for, sorted with "*"
+// first.
+func (p Permissions) ToolNames() []string {
+	return sortedTools(p.Tools)
+}
+
+// sortedTools returns the tool names with "*" first.
+func sortedTools(tools map[string]string) []string {
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "*") != (names[j] == "*") {
+			return names[i] == "*"
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// UnmarshalYAML reads the permissions section, keeping the order of bash
+// rules.
+func (p *Permissions) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: permissions must be a mapping of tools to allow or deny", node.Line)
+	}
+	p.Tools = make(map[string]string)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value != "bash" {
+			action, err := decodeAction(value, "permissions."+key.Value)
+			if err != nil {
+				return err
+			}
+			p.Tools[key.Value] = action
+			continue
+		}
+
+		switch value.Kind {
+		case yaml.ScalarNode:
+			action, err := decodeAction(value, "permissions.bash")
+			if err != nil {
+				return err
+			}
+			p.Bash = append(p.Bash, Rule{"*", action})
+		case yaml.MappingNode:
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				pattern := value.Content[j].Value
+				action, err := decodeAction(value.Content[j+1], fmt.Sprintf("permissions.bash[%q]", pattern))
+				if err != nil {
+					return err
+				}
+				p.Bash = append(p.Bash, Rule{pattern, action})
+			}
+		default:
+			return fmt.Errorf("line %d: permissions.bash must be allow, deny or a mapping of command patterns", value.Line)
+		}
+	}
+	return nil
+}
+
+func decodeAction(node *yaml.Node, name string) (string, error) {
+	if node.Kind != yaml.ScalarNode || (node.Value != Allow && node.Value != Deny) {
+		return "", fmt.Errorf("line %d: %s must be %s or %s", node.Line, name, Allow, Deny)
+	}
+	return node.Value, nil
+}
+
+// MarshalYAML writes the permissions section back in the form
+// UnmarshalYAML reads.
+func (p Permissions) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	scalar := func(s string) *yaml.Node { return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s} }
+	for _, tool := range sortedTools(p.Tools) {
+		node.Content = append(node.Content, scalar(tool), scalar(p.Tools[tool]))
+	}
+	if len(p.Bash) > 0 {
+		bash := &yaml.Node{Kind: yaml.MappingNode}
+		for _, rule := range p.Bash {
+			bash.Content = append(bash.Content, scalar(rule.Pattern), scalar(rule.Action))
+		}
+		node.Content = append(node.Content, scalar("bash"), bash)
+	}
+	return node, nil
+}
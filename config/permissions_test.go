@@ -0,0 +1,90 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestEffectivePermissions_Defaults(t *testing.T) {
+	p, overrides := (&Config{}).EffectivePermissions()
+	assert.Equal(t, DefaultPermissions(), p)
+	assert.Empty(t, overrides)
+	assert.Equal(t, Deny, p.Tools["*"], "tools not named are denied")
+	assert.Equal(t, Allow, p.Tools["edit"])
+	assert.Equal(t, Rule{"*", Deny}, p.Bash[0], "commands not named are denied")
+	assert.Contains(t, p.Bash, Rule{"go test*", Allow})
+	assert.Equal(t, []Rule{{"git push*", Deny}, {"git reset --hard*", Deny}, {"git clean*", Deny}, {"rm -rf*", Deny}, {"sudo *", Deny}},
+		p.Bash[len(p.Bash)-5:], "the deny list comes last")
+}
+
+func TestEffectivePermissions_Overrides(t *testing.T) {
+	cfg, err := Parse([]byte(`agent:
+  command: agent
+validate:
+  command: go test ./...
+permissions:
+  webfetch: deny
+  "*": allow
+  bash:
+    "git push*": allow
+    "rm -rf*": deny
+    "docker *": deny
+`))
+	require.NoError(t, err)
+
+	p, overrides := cfg.EffectivePermissions()
+	assert.Equal(t, Allow, p.Tools["*"])
+	assert.Equal(t, Deny, p.Tools["webfetch"])
+	defaults := DefaultPermissions().Bash
+	assert.Len(t, p.Bash, len(defaults)+1)
+	assert.Equal(t, Rule{"docker *", Deny}, p.Bash[len(defaults)-5], "added after the defaults, before the never rules")
+	assert.Equal(t, []Rule{{"git push*", Allow}, {"git reset --hard*", Deny}, {"git clean*", Deny}, {"rm -rf*", Deny}, {"sudo *", Deny}},
+		p.Bash[len(p.Bash)-5:], "replaced in place")
+	require.Len(t, overrides, 2)
+	assert.Equal(t, `tool *: deny → allow`, overrides[0].String())
+	assert.Equal(t, `bash "git push*": deny → allow`, overrides[1].String())
+}
+
+func TestEffectivePermissions_BroadRulesKeepNeverRules(t *testing.T) {
+	cfg := &Config{Permissions: &Permissions{Bash: []Rule{{"git *", Allow}, {"rm *", Allow}}}}
+
+	p, overrides := cfg.EffectivePermissions()
+	assert.Empty(t, overrides, "no default rule was changed")
+	n := len(p.Bash)
+	assert.Equal(t, []Rule{{"git *", Allow}, {"rm *", Allow}}, p.Bash[n-7:n-5])
+	assert.Equal(t, neverRules(), p.Bash[n-5:], "git push and rm -rf stay denied: the last match wins")
+}
+
+func TestPermissions_YAML(t *testing.T) {
+	tests := []struct {
+		yaml string
+		err  string
+	}{
+		{"bash: deny", ""},
+		{"edit: ask", "permissions.edit must be allow or deny"},
+		{"bash: {'git *': maybe}", `permissions.bash["git *"] must be allow or deny`},
+		{"bash: [a]", "permissions.bash must be allow, deny or a mapping"},
+		{"[edit]", "permissions must be a mapping"},
+	}
+	for _, tt := range tests {
+		var p Permissions
+		err := yaml.Unmarshal([]byte(tt.yaml), &p)
+		if tt.err == "" {
+			assert.NoError(t, err, tt.yaml)
+		} else {
+			assert.ErrorContains(t, err, tt.err, tt.yaml)
+		}
+	}
+
+	// Round trip keeps the order of bash rules
+	p := DefaultPermissions()
+	p.Tools["webfetch"] = Deny
+	data, err := yaml.Marshal(p)
+	require.NoError(t, err)
+	var got Permissions
+	require.NoError(t, yaml.Unmarshal(data, &got), string(data))
+	assert.Equal(t, p, got)
+}
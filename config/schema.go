@@ -0,0 +1,428 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jack/tatsu/testresult"
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config format this tatsu reads. A file without
+// version is version 1; older files are migrated when they are read (see
+// migrations).
+const CurrentVersion = 1
+
+// Problem is a key or value of a config file that does not fit the schema.
+type Problem struct {
+	File    string // empty for content without a file (Parse)
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, p.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+}
+
+// SchemaError lists the problems found in a config file.
+type SchemaError struct {
+	Problems []Problem
+}
+
+func (e *SchemaError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Kinds of config values.
+const (
+	kindObject      = "object" // a struct: only its keys are allowed
+	kindMap         = "map"    // any keys, values of elem
+	kindArray       = "array"  // a list of elem
+	kindString      = "string" // any scalar
+	kindInteger     = "integer"
+	kindBoolean     = "boolean"
+	kindDuration    = "duration"    // a string such as 10m
+	kindCommand     = "command"     // agent.command: a string or a list of strings
+	kindPermissions = "permissions" // checked by Permissions.UnmarshalYAML
+	kindAny         = "any"         // a raw YAML node
+)
+
+// schema describes a config value: its kind and, for objects, its keys.
+type schema struct {
+	kind   string
+	keys   []string // object keys, in struct order
+	fields map[string]*schema
+	elem   *schema  // array items and map values
+	enum   []string // allowed strings, for the JSON Schema
+	hint   string   // explains an unknown key of an object
+}
+
+// enums are the allowed values of string keys, by key path; list items
+// share the path of their list.
+var enums = map[string][]string{
+	"agent.prompt_via":                 {PromptViaArgv, PromptViaStdin, PromptViaFile, PromptViaEnv, PromptViaShell},
+	"validate.parser":                  testresult.Formats,
+	"validate.stages.parser":           testresult.Formats,
+	"validate.baseline.if_passing":     {IfPassingRun, IfPassingSkip, IfPassingAsk},
+	"validate.baseline.known_failures": {KnownFailuresIgnore, KnownFailuresFail},
+	"guard.on_violation":               {GuardRevert, GuardFail},
+}
+
+// configSchema is the schema of tatsu.yaml.
+var configSchema = buildSchema()
+
+// buildSchema derives the schema from Config's YAML tags. agent.command,
+// read by Agent.UnmarshalYAML, is added by hand, and each profile is the
+// part of the config under ProfileKeys.
+func buildSchema() *schema {
+	root := schemaOf(reflect.TypeOf(Config{}), "")
+	profile := &schema{
+		kind:   kindObject,
+		fields: make(map[string]*schema),
+		hint:   "a profile can only set " + strings.Join(ProfileKeys, ", "),
+	}
+	for _, key := range ProfileKeys {
+		profile.keys = append(profile.keys, key)
+		profile.fields[key] = root.fields[key]
+	}
+	root.fields["profiles"] = &schema{kind: kindMap, elem: profile}
+	return root
+}
+
+func schemaOf(t reflect.Type, path string) *schema {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)):
+		return &schema{kind: kindDuration}
+	case t == reflect.TypeOf(Permissions{}):
+		return &schema{kind: kindPermissions}
+	case t == reflect.TypeOf(yaml.Node{}):
+		return &schema{kind: kindAny}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		s := &schema{kind: kindObject, fields: make(map[string]*schema)}
+		if t == reflect.TypeOf(Agent{}) {
+			s.keys = append(s.keys, "command")
+			s.fields["command"] = &schema{kind: kindCommand}
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			s.keys = append(s.keys, name)
+			s.fields[name] = schemaOf(f.Type, join(path, name))
+		}
+		return s
+	case reflect.Map:
+		return &schema{kind: kindMap, elem: schemaOf(t.Elem(), path)}
+	case reflect.Slice:
+		return &schema{kind: kindArray, elem: schemaOf(t.Elem(), path)}
+	case reflect.Int:
+		return &schema{kind: kindInteger}
+	case reflect.Bool:
+		return &schema{kind: kindBoolean}
+	default:
+		return &schema{kind: kindString, enum: enums[path]}
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// check reports the keys of n that the schema does not have and values of
+// the wrong kind, e.g. a list where a string belongs.
+func (s *schema) check(n *yaml.Node, path string, report func(n *yaml.Node, format string, args ...any)) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return
+	}
+	switch s.kind {
+	case kindObject:
+		if n.Kind != yaml.MappingNode {
+			if path == "" {
+				path = "the config"
+			}
+			report(n, "%s must be a mapping", path)
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			field, ok := s.fields[key]
+			if !ok {
+				msg := fmt.Sprintf("unknown key %s", join(path, key))
+				if similar := closest(key, s.keys); similar != "" {
+					msg += fmt.Sprintf(" (did you mean %s?)", join(path, similar))
+				} else if s.hint != "" {
+					msg += " (" + s.hint + ")"
+				}
+				report(n.Content[i], "%s", msg)
+				continue
+			}
+			field.check(n.Content[i+1], join(path, key), report)
+		}
+	case kindMap:
+		if n.Kind != yaml.MappingNode {
+			report(n, "%s must be a mapping", path)
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			s.elem.check(n.Content[i+1], join(path, n.Content[i].Value), report)
+		}
+	case kindArray:
+		if n.Kind != yaml.SequenceNode {
+			report(n, "%s must be a list", path)
+			return
+		}
+		for i, item := range n.Content {
+			s.elem.check(item, fmt.Sprintf("%s[%d]", path, i), report)
+		}
+	case kindString:
+		if n.Kind != yaml.ScalarNode {
+			report(n, "%s must be a string", path)
+		}
+	case kindInteger:
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!int" {
+			report(n, "%s must be a whole number", path)
+		}
+	case kindBoolean:
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!bool" {
+			report(n, "%s must be true or false", path)
+		}
+	case kindDuration:
+		if _, err := time.ParseDuration(n.Value); n.Kind != yaml.ScalarNode || n.Tag != "!!str" || err != nil {
+			report(n, "%s must be a duration such as 30s, 10m or 1h", path)
+		}
+	}
+}
+
+// lookup returns the schema of the value at the dotted key path, nil if
+// there is none.
+func (s *schema) lookup(key string) *schema {
+	for _, part := range strings.Split(key, ".") {
+		if s.kind != kindObject || s.fields[part] == nil {
+			return nil
+		}
+		s = s.fields[part]
+	}
+	return s
+}
+
+// closest returns the key most like key, if one is within two edits of it.
+func closest(key string, keys []string) string {
+	best, bestDist := "", 3
+	for _, k := range keys {
+		if d := editDistance(key, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// checkFile checks a config file's top-level mapping against the schema
+// and its version, migrates it to CurrentVersion and returns a note for
+// each change made.
+func checkFile(m *yaml.Node, file string) ([]string, error) {
+	var problems []Problem
+	report := func(n *yaml.Node, format string, args ...any) {
+		problems = append(problems, Problem{File: file, Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)})
+	}
+
+	version := 1
+	if i := mappingIndex(m, "version"); i >= 0 {
+		n := m.Content[i+1]
+		v, err := strconv.Atoi(n.Value)
+		switch {
+		case n.Kind != yaml.ScalarNode || err != nil || v < 1:
+			report(n, "version must be a number from 1 to %d", CurrentVersion)
+		case v > CurrentVersion:
+			report(n, "version %d is newer than this tatsu supports (%d); upgrade tatsu", v, CurrentVersion)
+		default:
+			version = v
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &SchemaError{problems}
+	}
+
+	notes := migrate(m, version)
+	configSchema.check(m, "", report)
+	if len(problems) > 0 {
+		return nil, &SchemaError{problems}
+	}
+	return notes, nil
+}
+
+// migration upgrades a config from version from to from+1 and describes
+// each change.
+type migration struct {
+	from  int
+	apply func(m *yaml.Node) []string
+}
+
+// migrations upgrade older configs, in order: migrations[i] upgrades
+// version i+1, so CurrentVersion is len(migrations)+1.
+var migrations = []migration{}
+
+// migrate upgrades the config mapping m from version to CurrentVersion and
+// sets its version key, if it has one, to CurrentVersion.
+func migrate(m *yaml.Node, version int) []string {
+	var notes []string
+	for _, mg := range migrations {
+		if mg.from >= version {
+			for _, note := range mg.apply(m) {
+				notes = append(notes, fmt.Sprintf("version %d: %s", mg.from, note))
+			}
+		}
+	}
+	if i := mappingIndex(m, "version"); i >= 0 {
+		m.Content[i+1].Value = strconv.Itoa(CurrentVersion)
+	}
+	return notes
+}
+
+type pathNode struct {
+	path string
+	node *yaml.Node
+}
+
+// agentNodes returns the agent mappings of a config: the top-level one and
+// those of the profiles.
+func agentNodes(m *yaml.Node) []pathNode {
+	var out []pathNode
+	if i := mappingIndex(m, "agent"); i >= 0 && m.Content[i+1].Kind == yaml.MappingNode {
+		out = append(out, pathNode{"agent", m.Content[i+1]})
+	}
+	if i := mappingIndex(m, "profiles"); i >= 0 {
+		profiles := m.Content[i+1]
+		for j := 0; j+1 < len(profiles.Content); j += 2 {
+			p := profiles.Content[j+1]
+			if k := mappingIndex(p, "agent"); k >= 0 && p.Content[k+1].Kind == yaml.MappingNode {
+				out = append(out, pathNode{"profiles." + profiles.Content[j].Value + ".agent", p.Content[k+1]})
+			}
+		}
+	}
+	return out
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// JSONSchema returns the JSON Schema of tatsu.yaml, for editors that
+// complete and check YAML against one.
+func JSONSchema() ([]byte, error) {
+	doc := configSchema.jsonSchema()
+	doc["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	doc["title"] = "tatsu.yaml"
+	properties := doc["properties"].(map[string]any)
+	properties["version"] = map[string]any{"type": "integer", "minimum": 1, "maximum": CurrentVersion}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (s *schema) jsonSchema() map[string]any {
+	switch s.kind {
+	case kindObject:
+		properties := make(map[string]any, len(s.keys))
+		for _, key := range s.keys {
+			properties[key] = s.fields[key].jsonSchema()
+		}
+		return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	case kindMap:
+		return map[string]any{"type": "object", "additionalProperties": s.elem.jsonSchema()}
+	case kindArray:
+		return map[string]any{"type": "array", "items": s.elem.jsonSchema()}
+	case kindInteger, kindBoolean:
+		return map[string]any{"type": s.kind}
+	case kindDuration:
+		return map[string]any{"type": "string", "pattern": `^([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`}
+	case kindCommand:
+		return map[string]any{"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "minItems": 1},
+		}}
+	case kindPermissions:
+		action := map[string]any{"enum": []string{Allow, Deny}}
+		return map[string]any{"type": "object", "additionalProperties": map[string]any{"oneOf": []any{
+			action,
+			map[string]any{"type": "object", "additionalProperties": action},
+		}}}
+	case kindString:
+		if len(s.enum) > 0 {
+			return map[string]any{"type": "string", "enum": s.enum}
+		}
+		return map[string]any{"type": "string"}
+	default:
+		return map[string]any{}
+	}
+}
+
+// valueKeys maps the key path of every config value to whether it is a
+// string.
+var valueKeys = configKeys()
+
+// configKeys lists the key path of every config value, with whether it is
+// a string: the leaves of the schema's objects. Profiles are a single
+// value.
+func configKeys() map[string]bool {
+	keys := make(map[string]bool)
+	var walk func(s *schema, prefix string)
+	walk = func(s *schema, prefix string) {
+		for _, key := range s.keys {
+			field := s.fields[key]
+			if field.kind == kindObject {
+				walk(field, prefix+key+".")
+				continue
+			}
+			keys[prefix+key] = field.kind == kindString || field.kind == kindCommand
+		}
+	}
+	walk(configSchema, "")
+	return keys
+}
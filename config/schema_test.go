@@ -0,0 +1,130 @@
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestResolve_UnknownKeys(t *testing.T) {
+	project := `agent:
+  command: x
+validat:
+  command: go test ./...
+  stages:
+    - name: unit
+      comand: go test
+patience: three
+timeout: 5
+`
+	inLayers(t, "", project, func() {
+		_, err := Resolve(Options{})
+		var schemaErr *SchemaError
+		require.ErrorAs(t, err, &schemaErr)
+		file := filepath.Join("..", ProjectFile)
+		assert.Equal(t, []Problem{
+			{file, 3, 1, "unknown key validat (did you mean validate?)"},
+			{file, 8, 11, "patience must be a whole number"},
+			{file, 9, 10, "timeout must be a duration such as 30s, 10m or 1h"},
+		}, schemaErr.Problems)
+		assert.Equal(t, file+":3:1: unknown key validat (did you mean validate?)\n"+
+			file+":8:11: patience must be a whole number\n"+
+			file+":9:10: timeout must be a duration such as 30s, 10m or 1h", err.Error())
+	})
+}
+
+func TestParse_Strict(t *testing.T) {
+	_, err := Parse([]byte("agent: {comand: x}\nvalidate:\n  stages:\n    - {name: unit, comand: go test}\n"))
+	assert.EqualError(t, err, "line 1, column 9: unknown key agent.comand (did you mean agent.command?)\n"+
+		"line 4, column 20: unknown key validate.stages[0].comand (did you mean validate.stages[0].command?)")
+
+	_, err = Parse([]byte("- agent\n"))
+	assert.EqualError(t, err, "line 1, column 1: the config must be a mapping")
+
+	cfg, err := Parse([]byte("agent: {command: x, env: {set: {A: b}}}\nvalidate: {command: y, timeout: 5m}\npermissions: {webfetch: deny}\n"))
+	require.NoError(t, err)
+	assert.Equal(t, CurrentVersion, cfg.Version)
+}
+
+func TestVersion(t *testing.T) {
+	_, err := Parse([]byte("version: 2\nagent: {command: x}\nvalidate: {command: y}\n"))
+	assert.EqualError(t, err, "line 1, column 10: version 2 is newer than this tatsu supports (1); upgrade tatsu")
+
+	_, err = Parse([]byte("version: one\n"))
+	assert.EqualError(t, err, "line 1, column 10: version must be a number from 1 to 1")
+
+	cfg, err := Parse([]byte("version: 1\nagent: {command: x, feedback: {max_lines: 20}}\nvalidate: {command: y}\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 20, cfg.Agent.Feedback.MaxLines)
+
+	assert.Len(t, migrations, CurrentVersion-1, "one migration per older version")
+}
+
+func TestMigrate(t *testing.T) {
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	// A synthetic migration from version 1: agent.old_command is now
+	// agent.command
+	migrations = []migration{{1, func(m *yaml.Node) []string {
+		var notes []string
+		for _, agent := range agentNodes(m) {
+			if i := mappingIndex(agent.node, "old_command"); i >= 0 {
+				agent.node.Content[i].Value = "command"
+				notes = append(notes, agent.path+".old_command is now "+agent.path+".command")
+			}
+		}
+		return notes
+	}}}
+
+	project := `version: 1
+agent:
+  old_command: x
+validate:
+  command: go test ./...
+profiles:
+  fast:
+    agent:
+      old_command: y
+`
+	inLayers(t, "", project, func() {
+		l, err := Resolve(Options{Profile: "fast"})
+		require.NoError(t, err)
+		file := filepath.Join("..", ProjectFile)
+		assert.Equal(t, []string{
+			file + ": version 1: agent.old_command is now agent.command",
+			file + ": version 1: profiles.fast.agent.old_command is now profiles.fast.agent.command",
+		}, l.Notes)
+
+		cfg, err := l.Config()
+		require.NoError(t, err)
+		assert.Equal(t, "y", cfg.Agent.Command)
+		assert.Equal(t, CurrentVersion, cfg.Version)
+		assert.Equal(t, "profile fast", l.Origins["agent.command"])
+	})
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := JSONSchema()
+	require.NoError(t, err)
+	var doc struct {
+		Properties           map[string]json.RawMessage `json:"properties"`
+		AdditionalProperties bool                       `json:"additionalProperties"`
+	}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.False(t, doc.AdditionalProperties)
+	for _, key := range []string{"version", "agent", "validate", "max_iterations", "profiles", "permissions", "guard"} {
+		assert.Contains(t, doc.Properties, key)
+	}
+
+	var agent struct {
+		Properties map[string]map[string]any `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(doc.Properties["agent"], &agent))
+	assert.Contains(t, agent.Properties["command"], "oneOf")
+	assert.Equal(t, []any{"argv", "stdin", "file", "env", "shell"}, agent.Properties["prompt_via"]["enum"])
+	assert.Equal(t, "string", agent.Properties["timeout"]["type"])
+}
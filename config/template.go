@@ -0,0 +1,190 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/jack/tatsu/proc"
+)
+
+// PromptVars are the variables available to agent.prompt and
+// agent.retry_prompt.
+var PromptVars = []string{
+	"Task",                 // the task title
+	"Iteration",            // 1-based iteration number
+	"MaxIterations",        // iteration budget of the task
+	"LastValidationOutput", // trimmed output of the previous validation
+	"FailedStages",         // failed validation stages, comma separated
+	"PRDTitle",             // title of the PRD the task comes from
+	"PRDSection",           // heading of the PRD section containing the task
+	"ChangedFiles",         // files changed since the task started, one per line
+}
+
+// CommandVars are the variables available to a templated agent.command:
+// PromptVars plus the rendered Prompt, with prompt_via file the PromptFile
+// path and, for harnesses that keep sessions, the SessionID to continue
+// (empty for a new session).
+var CommandVars = append(append([]string(nil), PromptVars...), "Prompt", "PromptFile", "SessionID")
+
+// IsTemplate reports whether a command is a text/template (contains "{{")
+// rather than a %s command.
+func IsTemplate(command string) bool {
+	return strings.Contains(command, "{{")
+}
+
+// ParseTemplate parses a prompt or command template. Unknown variables
+// are an error when the template is executed, and the quote function
+// quotes a value for use as a single shell word: {{quote .Prompt}}.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"quote": shellQuote}).
+		Parse(text)
+}
+
+func shellQuote(s string) string {
+	return proc.JoinArgs([]string{s})
+}
+
+// shellSafeVars are the command variables a shell string template may
+// use unquoted: numbers, the temporary prompt file and an agent session ID.
+var shellSafeVars = map[string]bool{"Iteration": true, "MaxIterations": true, "PromptFile": true, "SessionID": true}
+
+// CheckShellTemplate reports an error if a command template that runs
+// with bash -c outputs a variable holding text (the prompt, the task,
+// validation output, ...) without passing it through quote, so that
+// nothing in it is run by the shell.
+func CheckShellTemplate(text string) error {
+	tmpl, err := ParseTemplate("agent.command", text)
+	if err != nil {
+		return fmt.Errorf("agent.command is not a valid template: %w", err)
+	}
+	return checkQuoted(tmpl.Tree.Root)
+}
+
+func checkQuoted(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkQuoted(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		if quoted(n.Pipe) {
+			return nil
+		}
+		for _, cmd := range n.Pipe.Cmds {
+			for _, arg := range cmd.Args {
+				switch a := arg.(type) {
+				case *parse.FieldNode:
+					if shellSafeVars[a.Ident[0]] {
+						continue
+					}
+				case *parse.IdentifierNode, *parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.NilNode:
+					continue
+				}
+				return fmt.Errorf("agent.command puts %s into a shell command unquoted; write it with quote (e.g. {{quote .Prompt}}) or make agent.command a list", n)
+			}
+		}
+	case *parse.IfNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkBranch(&n.BranchNode)
+	}
+	return nil
+}
+
+func checkBranch(n *parse.BranchNode) error {
+	if err := checkQuoted(n.List); err != nil {
+		return err
+	}
+	return checkQuoted(n.ElseList)
+}
+
+// quoted reports whether a pipeline ends in the quote function.
+func quoted(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Cmds) == 0 {
+		return false
+	}
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	ident, ok := last.Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == "quote"
+}
+
+// checkTemplate parses text and executes it against sample values of vars,
+// so a misspelt variable is reported when the config is loaded rather than
+// in the middle of a run.
+func checkTemplate(name, text string, vars []string) error {
+	tmpl, err := ParseTemplate(name, text)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid template: %w", name, err)
+	}
+	sample := make(map[string]interface{}, len(vars))
+	for _, v := range vars {
+		sample[v] = ""
+	}
+	sample["Iteration"], sample["MaxIterations"] = 1, 1
+	// Only unknown variables are reported: other errors may depend on the
+	// values (e.g. slicing an empty output)
+	if err := tmpl.Execute(&strings.Builder{}, sample); err != nil && strings.Contains(err.Error(), "map has no entry for key") {
+		return fmt.Errorf("%s: %w (available: %s)", name, err, strings.Join(vars, ", "))
+	}
+	return nil
+}
+
+// loadTemplates reads agent.prompt_file and agent.retry_prompt_file into
+// agent.prompt and agent.retry_prompt, and checks every template.
+func loadTemplates(a *Agent) error {
+	for _, f := range []struct {
+		name string
+		file *string
+		text *string
+	}{
+		{"agent.prompt", &a.PromptFile, &a.Prompt},
+		{"agent.retry_prompt", &a.RetryPromptFile, &a.RetryPrompt},
+	} {
+		if *f.file == "" {
+			continue
+		}
+		if *f.text != "" {
+			return fmt.Errorf("set either %s or %s_file in tatsu.yaml, not both", f.name, f.name)
+		}
+		data, err := os.ReadFile(*f.file)
+		if err != nil {
+			return fmt.Errorf("%s_file: %w", f.name, err)
+		}
+		// Inlined so the config snapshot saved with a run is self-contained
+		*f.text, *f.file = string(data), ""
+	}
+
+	if a.Prompt != "" {
+		if err := checkTemplate("agent.prompt", a.Prompt, PromptVars); err != nil {
+			return err
+		}
+	}
+	if a.RetryPrompt != "" {
+		if err := checkTemplate("agent.retry_prompt", a.RetryPrompt, PromptVars); err != nil {
+			return err
+		}
+	}
+	for _, arg := range append([]string{a.Command}, a.Argv...) {
+		if IsTemplate(arg) {
+			if err := checkTemplate("agent.command", arg, CommandVars); err != nil {
+				return err
+			}
+		}
+	}
+	if len(a.Argv) == 0 && IsTemplate(a.Command) && a.PromptMode() != PromptViaArgv {
+		return CheckShellTemplate(a.Command)
+	}
+	return nil
+}
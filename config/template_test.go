@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParse_Templates(t *testing.T) {
+	tests := []struct {
+		agent string
+		err   string
+	}{
+		{`command: 'opencode run "%s"'`, ""},
+		{`command: 'agent --message {{quote .Prompt}} --note "100%"'`, ""},
+		{"command: [agent, --message, '{{.Prompt}}', --title, '{{.PRDTitle}}']", ""},
+		{"command: [agent, '{{.Promt}}']", `map has no entry for key "Promt"`},
+		{`command: 'agent {{.Prompt'`, "agent.command is not a valid template"},
+		{"command: agent\n  prompt: '{{.Task}} in {{.PRDSection}}, changed: {{.ChangedFiles}}'", ""},
+		{"command: agent\n  prompt: '{{.Prompt}}'", "agent.prompt: "},
+		{"command: agent\n  retry_prompt: '{{if gt .Iteration 2}}again{{end}} {{.LastValidationOutput}}'", ""},
+		{"command: agent\n  retry_prompt: '{{.Tsk}}'", "available: Task, Iteration"},
+		{"command: [cat, '{{.Prompt}}']\n  prompt_via: stdin", ""},
+		{`command: 'agent --message {{.Prompt}}'`, "puts {{.Prompt}} into a shell command unquoted"},
+		{`command: 'agent -m "{{.LastValidationOutput}}"'`, "puts {{.LastValidationOutput}} into a shell command unquoted"},
+		{`command: 'agent {{printf "%s" .Task}}'`, "unquoted"},
+		{`command: 'agent {{if .PRDTitle}}--title {{.PRDTitle}}{{end}} {{quote .Prompt}}'`, "puts {{.PRDTitle}}"},
+		{`command: 'agent {{with .Task}}{{.}}{{end}}'`, "puts {{.}}"},
+		{`command: 'agent {{.Task | quote}} {{if .SessionID}}--session {{.SessionID}}{{end}} -n {{.Iteration}}'`, ""},
+		{"command: 'agent {{.Prompt}}'\n  prompt_via: argv", ""},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte("agent:\n  " + tt.agent + "\nvalidate:\n  command: go test ./...\n"))
+		if tt.err == "" {
+			assert.NoError(t, err, tt.agent)
+		} else if assert.Error(t, err, tt.agent) {
+			assert.Contains(t, err.Error(), tt.err, tt.agent)
+		}
+	}
+}
+
+func TestParse_TemplateFiles(t *testing.T) {
+	dir := t.TempDir()
+	prompt := filepath.Join(dir, "prompt.tmpl")
+	retry := filepath.Join(dir, "retry.tmpl")
+	require.NoError(t, os.WriteFile(prompt, []byte("Task: {{.Task}}\n"), 0644))
+	require.NoError(t, os.WriteFile(retry, []byte("Again: {{.Task}}\n"), 0644))
+
+	data := "agent:\n  command: agent\n  prompt_file: " + prompt + "\n  retry_prompt_file: " + retry + "\nvalidate:\n  command: go test ./...\n"
+	cfg, err := Parse([]byte(data))
+	require.NoError(t, err)
+	assert.Equal(t, "Task: {{.Task}}\n", cfg.Agent.Prompt)
+	assert.Equal(t, "Again: {{.Task}}\n", cfg.Agent.RetryPrompt)
+	assert.Empty(t, cfg.Agent.PromptFile)
+
+	// The snapshot of the parsed config no longer needs the files
+	out, err := yaml.Marshal(cfg)
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "prompt_file")
+	_, err = Parse([]byte(strings.Replace(data, "command: agent", "command: agent\n  retry_prompt: x", 1)))
+	assert.ErrorContains(t, err, "set either agent.retry_prompt or agent.retry_prompt_file")
+
+	require.NoError(t, os.Remove(prompt))
+	_, err = Parse(out)
+	require.NoError(t, err)
+
+	_, err = Parse([]byte(data))
+	assert.ErrorContains(t, err, "agent.prompt_file")
+}
@@ -0,0 +1,136 @@
+package harness
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jack/tatsu/config"
+)
+
+// cliHarness runs an agent CLI that takes the prompt on its command line.
+// agent.command overrides the default command template.
+type cliHarness struct {
+	name           string
+	defaultCommand string   // %s is the prompt
+	env            []string // added to the inherited environment
+	installURL     string
+	// usage parses a usage report from an output line; nil if the line is
+	// not one. The last report wins.
+	usage func(line string) *Usage
+	cfg   *config.Config
+}
+
+func (h *cliHarness) Name() string {
+	return h.name
+}
+
+// IsAvailable reports whether the command's program is on PATH.
+func (h *cliHarness) IsAvailable() bool {
+	return h.command().available(h.cfg)
+}
+
+// Run runs the command and picks up the usage the agent reports.
+func (h *cliHarness) Run(ctx context.Context, p Prompt) (Result, error) {
+	var usage *Usage
+	var onLine func(string)
+	if h.usage != nil {
+		onLine = func(line string) {
+			if u := h.usage(line); u != nil {
+				usage = u
+			}
+		}
+	}
+	result, err := runAgent(ctx, h.cfg, h.command(), append(baseEnv(p), h.env...), p, onLine)
+	result.Usage = usage
+	return result, err
+}
+
+func (h *cliHarness) InstallURL() string {
+	return h.installURL
+}
+
+func (h *cliHarness) command() command {
+	return agentCommand(h.cfg, h.defaultCommand)
+}
+
+// newAider runs aider with every confirmation auto-accepted. tatsu
+// checkpoints the tree itself, so aider's own commits are turned off.
+func newAider(cfg *config.Config) Harness {
+	return &cliHarness{
+		name:           "aider",
+		defaultCommand: `aider --yes-always --no-auto-commits --message "%s"`,
+		env:            []string{"AIDER_YES_ALWAYS=true", "AIDER_CHECK_UPDATE=false", "AIDER_PRETTY=false"},
+		installURL:     "https://aider.chat/docs/install.html",
+		usage:          aiderUsage,
+		cfg:            cfg,
+	}
+}
+
+// newCodex runs the codex CLI non-interactively with edits and commands
+// allowed inside the workspace.
+func newCodex(cfg *config.Config) Harness {
+	return &cliHarness{
+		name:           "codex",
+		defaultCommand: `codex exec --full-auto "%s"`,
+		env:            []string{"CI=true"},
+		installURL:     "https://github.com/openai/codex",
+		usage:          codexUsage,
+		cfg:            cfg,
+	}
+}
+
+// newGoose runs a single goose session without approval prompts.
+func newGoose(cfg *config.Config) Harness {
+	return &cliHarness{
+		name:           "goose",
+		defaultCommand: `goose run --text "%s"`,
+		env:            []string{"GOOSE_MODE=auto", "CI=true"},
+		installURL:     "https://block.github.io/goose/docs/getting-started/installation",
+		cfg:            cfg,
+	}
+}
+
+var (
+	// aiderTokens matches "Tokens: 2.3k sent, 150 received. Cost: $0.01 message, $0.05 session."
+	// (cache columns may appear between sent and received).
+	aiderTokens = regexp.MustCompile(`Tokens: ([\d.,]+k?) sent,.*?([\d.,]+k?) received\.(?:\s*Cost: \$([\d.]+) message)?`)
+	// codexTokens matches "tokens used: 12,345".
+	codexTokens = regexp.MustCompile(`(?i)^\s*tokens used:?\s*([\d.,]+k?)\s*$`)
+)
+
+func aiderUsage(line string) *Usage {
+	m := aiderTokens.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	u := &Usage{InputTokens: parseCount(m[1]), OutputTokens: parseCount(m[2])}
+	u.TotalTokens = u.InputTokens + u.OutputTokens
+	if m[3] != "" {
+		u.CostUSD, _ = strconv.ParseFloat(m[3], 64)
+	}
+	return u
+}
+
+func codexUsage(line string) *Usage {
+	m := codexTokens.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	return &Usage{TotalTokens: parseCount(m[1])}
+}
+
+// parseCount parses token counts like "150", "12,345" or "2.3k".
+func parseCount(s string) int {
+	s = strings.ReplaceAll(s, ",", "")
+	scale := 1.0
+	if strings.HasSuffix(s, "k") {
+		s, scale = strings.TrimSuffix(s, "k"), 1000
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int(n*scale + 0.5)
+}
@@ -0,0 +1,293 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/proc"
+)
+
+// PromptEnv is the environment variable holding the prompt when
+// agent.prompt_via is env.
+const PromptEnv = config.PromptEnv
+
+// command is an agent command line: a shell string (template, with %s for
+// the prompt) or an argument list run without a shell.
+type command struct {
+	shell string
+	argv  []string
+}
+
+// agentCommand returns agent.command, or the shell template fallback when it
+// is not set.
+func agentCommand(cfg *config.Config, fallback string) command {
+	if cfg != nil && len(cfg.Agent.Argv) > 0 {
+		return command{argv: cfg.Agent.Argv}
+	}
+	if cfg != nil && cfg.Agent.Command != "" {
+		return command{shell: cfg.Agent.Command}
+	}
+	return command{shell: fallback}
+}
+
+// executable returns the program the command runs, without any directory.
+func (c command) executable() string {
+	if len(c.argv) > 0 {
+		return filepath.Base(c.argv[0])
+	}
+	return executable(c.shell)
+}
+
+// available reports whether the program the command runs can be found,
+// reading a string command the way runAgent will run it with cfg.
+func (c command) available(cfg *config.Config) bool {
+	argv := c.argv
+	if argv == nil && c.mode(cfg) == config.PromptViaArgv {
+		var err error
+		if argv, err = c.split(); err != nil {
+			return false
+		}
+	}
+	if len(argv) > 0 {
+		_, err := exec.LookPath(argv[0])
+		return err == nil
+	}
+	return lookPath(c.shell)
+}
+
+// mode returns how runAgent passes the prompt to c: agent.prompt_via, or
+// argv. Empty means a string template, rendered into a shell string.
+func (c command) mode(cfg *config.Config) string {
+	switch {
+	case cfg != nil && cfg.Agent.PromptVia != "":
+		return cfg.Agent.PromptVia
+	case c.argv == nil && c.isTemplate():
+		return ""
+	default:
+		return config.PromptViaArgv
+	}
+}
+
+// split splits a string command into the arguments the argv mode runs,
+// refusing shell syntax that would be passed on as literal words.
+func (c command) split() ([]string, error) {
+	if err := config.CheckArgvCommand(c.shell); err != nil {
+		return nil, err
+	}
+	argv, err := proc.SplitArgs(c.shell)
+	if err == nil && len(argv) == 0 {
+		err = fmt.Errorf("agent.command is empty")
+	}
+	return argv, err
+}
+
+// runAgent runs c, passing the prompt as agent.prompt_via says; see
+// runCommand. Without prompt_via the prompt is passed as an argument: a
+// string command is split into words and run without a shell. Only with
+// prompt_via shell does a %s command get the escaped prompt substituted
+// for %s and run with bash -c. A templated command is rendered with p's
+// variables instead; in argv mode each argument is rendered on its own, so
+// the prompt never passes through a shell.
+func runAgent(ctx context.Context, cfg *config.Config, c command, env []string, p Prompt, onLine func(string)) (Result, error) {
+	mode := c.mode(cfg)
+	if mode == config.PromptViaShell && !c.isTemplate() {
+		return runShell(ctx, expand(c.shell, p.Text), env, p, onLine)
+	}
+
+	vars := templateVars(p)
+	var stdin io.Reader
+	var arg string // substituted for %s, or appended
+	switch mode {
+	case config.PromptViaArgv:
+		arg = p.Text
+	case config.PromptViaStdin:
+		stdin = strings.NewReader(p.Text)
+	case config.PromptViaEnv:
+		env = append(env, PromptEnv+"="+p.Text)
+	case config.PromptViaFile:
+		path, err := writePromptFile(p.Text)
+		if err != nil {
+			return Result{ExitCode: -1}, err
+		}
+		defer os.Remove(path)
+		arg = path
+		vars["PromptFile"] = path
+	}
+
+	argv := c.argv
+	if argv == nil && mode == config.PromptViaArgv {
+		var err error
+		if argv, err = c.split(); err != nil {
+			return Result{ExitCode: -1}, err
+		}
+	}
+
+	var cmd *exec.Cmd
+	switch {
+	case len(argv) > 0 && c.isTemplate():
+		rendered := make([]string, len(argv))
+		for i, a := range argv {
+			var err error
+			if rendered[i], err = render(a, vars); err != nil {
+				return Result{ExitCode: -1}, err
+			}
+		}
+		cmd = proc.Command(ctx, rendered[0], rendered[1:]...)
+	case len(argv) > 0:
+		argv = substituteArgs(argv, arg)
+		cmd = proc.Command(ctx, argv[0], argv[1:]...)
+	case c.isTemplate():
+		if err := config.CheckShellTemplate(c.shell); err != nil {
+			return Result{ExitCode: -1}, err
+		}
+		shell, err := render(c.shell, vars)
+		if err != nil {
+			return Result{ExitCode: -1}, err
+		}
+		cmd = proc.Shell(ctx, shell)
+	default:
+		// Only a temp file path is ever substituted into a shell string
+		shell, found := substitute(c.shell, arg)
+		if !found && arg != "" {
+			shell += " " + arg
+		}
+		cmd = proc.Shell(ctx, shell)
+	}
+	cmd.Env = env
+	cmd.Stdin = stdin
+	return runCommand(cmd, p, onLine)
+}
+
+// withArgs returns the command with args inserted after the first argument
+// equal to after (e.g. a "run" subcommand), or appended if there is none.
+// In a shell string the args are quoted.
+func (c command) withArgs(after string, args ...string) command {
+	if len(c.argv) > 0 {
+		argv := append([]string(nil), c.argv...)
+		at := len(argv)
+		for i, a := range argv {
+			if a == after {
+				at = i + 1
+				break
+			}
+		}
+		return command{argv: append(argv[:at], append(args, argv[at:]...)...)}
+	}
+	word := regexp.MustCompile(`(^|\s)` + regexp.QuoteMeta(after) + `(\s|$)`)
+	if loc := word.FindStringIndex(c.shell); loc != nil {
+		at := loc[0] + strings.Index(c.shell[loc[0]:], after) + len(after)
+		return command{shell: c.shell[:at] + " " + proc.JoinArgs(args) + c.shell[at:]}
+	}
+	return command{shell: c.shell + " " + proc.JoinArgs(args)}
+}
+
+// isTemplate reports whether the command is a text/template rather than a
+// %s command.
+func (c command) isTemplate() bool {
+	if config.IsTemplate(c.shell) {
+		return true
+	}
+	for _, a := range c.argv {
+		if config.IsTemplate(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateVars returns the variables for a command template: p.Vars, the
+// prompt, and empty values for anything the caller did not set.
+func templateVars(p Prompt) map[string]interface{} {
+	vars := make(map[string]interface{}, len(config.CommandVars))
+	for _, name := range config.CommandVars {
+		vars[name] = ""
+	}
+	vars["Iteration"], vars["MaxIterations"] = p.Iteration, 0
+	vars["Task"] = p.Task
+	for name, v := range p.Vars {
+		vars[name] = v
+	}
+	vars["Prompt"] = p.Text
+	vars["SessionID"] = p.SessionID
+	return vars
+}
+
+// render executes a command template.
+func render(text string, vars map[string]interface{}) (string, error) {
+	tmpl, err := config.ParseTemplate("agent.command", text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// substituteArgs substitutes arg in each argument, or appends arg as a
+// final argument if no argument contains %s. An empty arg is not appended.
+func substituteArgs(argv []string, arg string) []string {
+	out := make([]string, len(argv))
+	found := false
+	for i, a := range argv {
+		var ok bool
+		out[i], ok = substitute(a, arg)
+		found = found || ok
+	}
+	if !found && arg != "" {
+		out = append(out, arg)
+	}
+	return out
+}
+
+// substitute replaces %s in s with arg and %% with %, like fmt.Sprintf with
+// a single string but without formatting arg. It reports whether s
+// contained %s.
+func substitute(s, arg string) (string, bool) {
+	var b strings.Builder
+	found := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+1 < len(s) {
+			switch s[i+1] {
+			case 's':
+				b.WriteString(arg)
+				found = true
+				i++
+				continue
+			case '%':
+				b.WriteByte('%')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), found
+}
+
+// writePromptFile writes the prompt to a new temporary file and returns its
+// path. The caller removes it.
+func writePromptFile(prompt string) (string, error) {
+	f, err := os.CreateTemp("", "tatsu-prompt-*.md")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(prompt); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
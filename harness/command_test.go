@@ -0,0 +1,204 @@
+package harness
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hostilePrompt would run commands if it reached a shell unquoted.
+const hostilePrompt = "it's $(touch pwned) `touch pwned` $HOME !! \"quoted\"\nline 2"
+
+func runPrompt(t *testing.T, cfg *config.Config) string {
+	t.Helper()
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(cwd)
+
+	var stdout bytes.Buffer
+	_, err = NewCustom(cfg).Run(context.Background(), Prompt{Text: hostilePrompt, Stdout: &stdout})
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "pwned"))
+	return stdout.String()
+}
+
+func TestRunAgent_PromptVia(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		argv    []string
+		via     string
+	}{
+		{"default string", `printf "%%s" "%s"`, nil, ""},
+		{"shell string", `printf "%%s" "%s" | cat`, nil, config.PromptViaShell},
+		{"argv list", "", []string{"printf", "%s", "%s"}, ""},
+		{"argv string", `printf "%%s" "%s"`, nil, config.PromptViaArgv},
+		{"argv appended", "", []string{"printf", "%%s"}, config.PromptViaArgv},
+		{"stdin list", "", []string{"cat"}, config.PromptViaStdin},
+		{"stdin shell", "cat | cat", nil, config.PromptViaStdin},
+		{"file list", "", []string{"cat", "%s"}, config.PromptViaFile},
+		{"file shell", "cat", nil, config.PromptViaFile},
+		{"env shell", `printf %%s "$TATSU_PROMPT"`, nil, config.PromptViaEnv},
+		{"env list", "", []string{"printenv", "TATSU_PROMPT"}, config.PromptViaEnv},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Agent.Command = tt.command
+			cfg.Agent.Argv = tt.argv
+			cfg.Agent.PromptVia = tt.via
+
+			out := runPrompt(t, cfg)
+			if tt.name == "env list" {
+				out = out[:len(out)-1] // printenv adds a newline
+			}
+			assert.Equal(t, hostilePrompt, out)
+		})
+	}
+}
+
+func TestRunAgent_FileRemoved(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Argv = []string{"echo", "%s"}
+	cfg.Agent.PromptVia = config.PromptViaFile
+
+	path := runPrompt(t, cfg)
+	assert.Contains(t, path, "tatsu-prompt-")
+	assert.NoFileExists(t, path[:len(path)-1])
+}
+
+func TestCommand_Executable(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Argv = []string{"/usr/bin/aider", "--message", "%s"}
+	assert.Equal(t, "aider", agentCommand(cfg, "").executable())
+
+	h, err := New(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "aider", h.Name())
+
+	cfg.Agent.Argv = []string{"sh", "-c", "exit 0"}
+	assert.True(t, agentCommand(cfg, "").available(cfg))
+	assert.Equal(t, "goose", agentCommand(nil, `goose run --text "%s"`).executable())
+}
+
+func TestCommand_ShellSyntax(t *testing.T) {
+	for _, command := range []string{`FOO=1 echo "%s"`, `cd /tmp && echo "%s"`, `echo "%s" 2>&1 | cat`} {
+		cfg := agentConfig(NameCustom, command)
+		assert.False(t, agentCommand(cfg, "").available(cfg), "argv mode cannot run %s", command)
+		_, err := NewCustom(cfg).Run(context.Background(), Prompt{Text: "task"})
+		assert.ErrorContains(t, err, "only works with agent.prompt_via: shell", command)
+
+		cfg.Agent.PromptVia = config.PromptViaShell
+		assert.True(t, agentCommand(cfg, "").available(cfg), command)
+		assert.Equal(t, "task\n", run(t, NewCustom(cfg), "task"), command)
+	}
+}
+
+func TestSubstituteArgs(t *testing.T) {
+	assert.Equal(t, []string{"a", "--m=x y"}, substituteArgs([]string{"a", "--m=%s"}, "x y"))
+	assert.Equal(t, []string{"a", "x"}, substituteArgs([]string{"a"}, "x"))
+	assert.Equal(t, []string{"a"}, substituteArgs([]string{"a"}, ""))
+	assert.Equal(t, []string{"100%s", "x"}, substituteArgs([]string{"100%%s"}, "x"))
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{`echo "%s"`, `echo "hi"`},
+		{`echo "100% %s %s"`, `echo "100% hi hi"`},
+		{`printf "%%s\n" "%s"`, `printf "%s\n" "hi"`},
+		{`echo 50%`, `echo 50% "hi"`},
+		{`my-agent`, `my-agent "hi"`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, expand(tt.command, "hi"), tt.command)
+	}
+}
+
+func TestRunAgent_CommandTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		argv     []string
+		via      string
+		expected string
+	}{
+		{"shell quote", `printf '%s|' {{quote .Prompt}} {{.Iteration}} 100%`, nil, "", hostilePrompt + "|2|100%|"},
+		{"argv list", "", []string{"printf", "%s|", "{{.Prompt}}", "{{.PRDTitle}}"}, "", hostilePrompt + "|Shop|"},
+		{"argv string", `printf "%s|" "{{.Prompt}}" "{{.Task}}"`, nil, config.PromptViaArgv, hostilePrompt + "|task|"},
+		{"file", "", []string{"cat", "{{.PromptFile}}"}, config.PromptViaFile, hostilePrompt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Agent.Command = tt.command
+			cfg.Agent.Argv = tt.argv
+			cfg.Agent.PromptVia = tt.via
+
+			var stdout bytes.Buffer
+			_, err := NewCustom(cfg).Run(context.Background(), Prompt{
+				Text:      hostilePrompt,
+				Task:      "task",
+				Iteration: 2,
+				Vars:      map[string]interface{}{"PRDTitle": "Shop"},
+				Stdout:    &stdout,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, stdout.String())
+		})
+	}
+}
+
+func TestRunAgent_ShellTemplateInjection(t *testing.T) {
+	dir := t.TempDir()
+	pwned := filepath.Join(dir, "pwned")
+	output := "FAIL: $(touch " + pwned + "); `touch " + pwned + "`; touch " + pwned
+
+	cfg := &config.Config{}
+	cfg.Agent.Command = `echo {{.LastValidationOutput}}`
+	_, err := NewCustom(cfg).Run(context.Background(), Prompt{Text: "x", Vars: map[string]interface{}{"LastValidationOutput": output}})
+	assert.ErrorContains(t, err, "unquoted")
+
+	cfg.Agent.Command = `printf '%s\n' {{quote .LastValidationOutput}}`
+	var stdout bytes.Buffer
+	_, err = NewCustom(cfg).Run(context.Background(), Prompt{Text: "x", Vars: map[string]interface{}{"LastValidationOutput": output}, Stdout: &stdout})
+	require.NoError(t, err)
+	assert.Equal(t, output+"\n", stdout.String())
+	assert.NoFileExists(t, pwned)
+}
+
+func TestRunAgent_CommandTemplateError(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Argv = []string{"echo", "{{.Nope}}"}
+
+	result, err := NewCustom(cfg).Run(context.Background(), Prompt{Text: "x"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Nope")
+	assert.Equal(t, -1, result.ExitCode)
+}
+
+func TestCommand_WithArgs(t *testing.T) {
+	tests := []struct {
+		in       command
+		expected command
+	}{
+		{command{shell: `opencode run "%s"`}, command{shell: `opencode run --session ses_1 "%s"`}},
+		{command{shell: `opencode  run  -m x  "%s"`}, command{shell: `opencode  run --session ses_1  -m x  "%s"`}},
+		{command{shell: `my-wrapper "%s"`}, command{shell: `my-wrapper "%s" --session ses_1`}},
+		{command{argv: []string{"opencode", "run", "%s"}}, command{argv: []string{"opencode", "run", "--session", "ses_1", "%s"}}},
+		{command{argv: []string{"oc", "%s"}}, command{argv: []string{"oc", "%s", "--session", "ses_1"}}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.in.withArgs("run", "--session", "ses_1"))
+	}
+}
@@ -0,0 +1,37 @@
+package harness
+
+import (
+	"context"
+
+	"github.com/jack/tatsu/config"
+)
+
+// Custom runs agent.command as is, for agents without a dedicated adapter.
+// It adds nothing to the environment.
+type Custom struct {
+	cfg *config.Config
+}
+
+// NewCustom creates a harness running cfg.Agent.Command.
+func NewCustom(cfg *config.Config) *Custom {
+	return &Custom{cfg: cfg}
+}
+
+// Name returns the program agent.command runs.
+func (h *Custom) Name() string {
+	if exe := agentCommand(h.cfg, "").executable(); exe != "" {
+		return exe
+	}
+	return NameCustom
+}
+
+// IsAvailable reports whether the program agent.command runs is on PATH
+// (or is a shell builtin).
+func (h *Custom) IsAvailable() bool {
+	return agentCommand(h.cfg, "").available(h.cfg)
+}
+
+// Run runs agent.command, passing the prompt as agent.prompt_via says.
+func (h *Custom) Run(ctx context.Context, p Prompt) (Result, error) {
+	return runAgent(ctx, h.cfg, agentCommand(h.cfg, ""), baseEnv(p), p, nil)
+}
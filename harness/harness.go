@@ -1,6 +1,195 @@
+// Package harness adapts coding-agent CLIs (OpenCode, aider, codex, goose or
+// any shell command) to tatsu. Each adapter owns its availability check,
+// the environment the agent runs with and how the agent command is built.
 package harness
 
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/proc"
+)
+
 type Harness interface {
 	Name() string
 	IsAvailable() bool
+	// Run sends the prompt to the agent and waits for it to finish,
+	// streaming its output to p.Stdout and p.Stderr. The error is non-nil if
+	// the agent could not be started, exited non-zero or was killed because
+	// ctx was done; Result is filled in as far as possible either way.
+	Run(ctx context.Context, p Prompt) (Result, error)
+}
+
+// Factory creates a harness for the agent section of cfg. The harness
+// should read cfg when called rather than copy it, so later overrides apply.
+type Factory func(cfg *config.Config) Harness
+
+// Built-in harness names accepted in agent.harness.
+const (
+	NameOpenCode = "opencode"
+	NameAider    = "aider"
+	NameCodex    = "codex"
+	NameGoose    = "goose"
+	NameCustom   = "custom"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		NameOpenCode: func(cfg *config.Config) Harness { return newOpenCode(cfg) },
+		NameAider:    newAider,
+		NameCodex:    newCodex,
+		NameGoose:    newGoose,
+		NameCustom:   func(cfg *config.Config) Harness { return NewCustom(cfg) },
+	}
+)
+
+// Register adds or replaces the harness factory for name.
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = f
+}
+
+// Names returns the registered harness names, sorted.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the harness selected by agent.harness, or detected from the
+// executable of agent.command when agent.harness is empty.
+func New(cfg *config.Config) (Harness, error) {
+	name := cfg.Agent.Harness
+	if name == "" {
+		name = detect(agentCommand(cfg, "").executable())
+	}
+	registryMu.RLock()
+	f, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown agent.harness %q (expected one of %s)", name, strings.Join(Names(), ", "))
+	}
+	return f(cfg), nil
+}
+
+// Detect returns the registered harness named like the executable of
+// command (e.g. "aider" for `aider --message "%s"`), or NameCustom.
+func Detect(command string) string {
+	return detect(executable(command))
+}
+
+func detect(exe string) string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if _, ok := registry[exe]; ok && exe != NameCustom {
+		return exe
+	}
+	return NameCustom
+}
+
+// InstallHint returns where to get the agent CLI, if the harness knows.
+func InstallHint(h Harness) string {
+	if i, ok := h.(interface{ InstallURL() string }); ok {
+		return i.InstallURL()
+	}
+	return ""
+}
+
+// EnforcesPermissions reports whether the harness passes the permissions
+// section of tatsu.yaml on to the agent.
+func EnforcesPermissions(h Harness) bool {
+	e, ok := h.(interface{ EnforcesPermissions() bool })
+	return ok && e.EnforcesPermissions()
+}
+
+// PolicyNotes describes the permission policy h runs the agent with, for
+// showing at startup: each default rule tatsu.yaml overrides, or that no
+// policy applies at all because the agent has no way to enforce one.
+func PolicyNotes(h Harness, cfg *config.Config) []string {
+	if !EnforcesPermissions(h) {
+		return []string{fmt.Sprintf("permissions are not enforced by the %s harness; the agent runs with its own settings", h.Name())}
+	}
+	if cfg == nil {
+		return nil
+	}
+	_, overrides := cfg.EffectivePermissions()
+	notes := make([]string, 0, len(overrides))
+	for _, o := range overrides {
+		notes = append(notes, "permission override: "+o.String())
+	}
+	return notes
+}
+
+// taskEscaper escapes the characters a shell still interprets inside
+// double quotes. ! is left alone: commands run with bash -c, which does
+// no history expansion.
+var taskEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	`$`, `\$`,
+	"`", "\\`",
+)
+
+// EscapeTask escapes a prompt for use inside double quotes in a shell
+// command, so nothing in it (e.g. validation output in a retry prompt) is
+// expanded or run by the shell.
+func EscapeTask(task string) string {
+	return taskEscaper.Replace(task)
+}
+
+// expand substitutes the escaped prompt for each %s in a shell command
+// and turns %% into %; see substitute. Without %s the prompt is appended
+// in double quotes.
+func expand(command, prompt string) string {
+	escaped := EscapeTask(prompt)
+	out, found := substitute(command, escaped)
+	if !found {
+		out += ` "` + escaped + `"`
+	}
+	return out
+}
+
+// executable returns the program a shell command runs: its first word,
+// skipping leading VAR=value assignments, without any directory.
+func executable(command string) string {
+	for _, field := range strings.Fields(command) {
+		if strings.Contains(field, "=") && !strings.ContainsAny(field, `/"'`) {
+			continue
+		}
+		field = strings.Trim(field, `"'`)
+		if i := strings.LastIndexByte(field, '/'); i >= 0 {
+			field = field[i+1:]
+		}
+		return field
+	}
+	return ""
+}
+
+// lookPath reports whether the program command runs can be found.
+func lookPath(command string) bool {
+	fields := strings.Fields(command)
+	for len(fields) > 0 && strings.Contains(fields[0], "=") && !strings.ContainsAny(fields[0], `/"'`) {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return false
+	}
+	program := strings.Trim(fields[0], `"'`)
+	if proc.IsBuiltin(program) {
+		return true
+	}
+	_, err := exec.LookPath(program)
+	return err == nil
 }
@@ -0,0 +1,155 @@
+package harness
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func agentConfig(harness, command string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Agent.Harness = harness
+	cfg.Agent.Command = command
+	return cfg
+}
+
+// fakeAgents puts scripts named like the agents on PATH that print each
+// argument on a line of its own.
+func fakeAgents(t *testing.T, names ...string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		script := "#!/bin/sh\nprintf '%s\\n' \"$@\"\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0755))
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// run runs h with prompt and returns what the agent printed.
+func run(t *testing.T, h Harness, prompt string) string {
+	t.Helper()
+	var stdout bytes.Buffer
+	_, err := h.Run(context.Background(), Prompt{Text: prompt, Stdout: &stdout})
+	require.NoError(t, err)
+	return stdout.String()
+}
+
+// shellConfig is agentConfig for a command that needs bash -c.
+func shellConfig(harness, command string) *config.Config {
+	cfg := agentConfig(harness, command)
+	cfg.Agent.PromptVia = config.PromptViaShell
+	return cfg
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{`opencode run "%s"`, NameOpenCode},
+		{`/usr/local/bin/aider --message "%s"`, NameAider},
+		{`OPENAI_API_KEY=x codex exec "%s"`, NameCodex},
+		{`goose run -t "%s"`, NameGoose},
+		{`./my-agent.sh "%s"`, NameCustom},
+		{`custom "%s"`, NameCustom},
+		{``, NameCustom},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Detect(tt.command))
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	h, err := New(agentConfig("", `aider --message "%s"`))
+	require.NoError(t, err)
+	assert.Equal(t, "aider", h.Name())
+
+	fakeAgents(t, "goose")
+	h, err = New(agentConfig("goose", ""))
+	require.NoError(t, err)
+	assert.Equal(t, "run\n--text\nfix it\n", run(t, h, "fix it"))
+
+	h, err = New(agentConfig("", `opencode run "%s"`))
+	require.NoError(t, err)
+	assert.IsType(t, &OpenCodeHarness{}, h)
+
+	_, err = New(agentConfig("claude-code", ""))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown agent.harness "claude-code" (expected one of aider, codex, custom, goose, opencode)`)
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-agent", func(cfg *config.Config) Harness { return NewCustom(cfg) })
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "test-agent")
+		registryMu.Unlock()
+	}()
+
+	assert.Contains(t, Names(), "test-agent")
+	assert.Equal(t, "test-agent", Detect(`test-agent "%s"`))
+}
+
+func TestCLIHarness_PromptIsOneArgument(t *testing.T) {
+	fakeAgents(t, "codex")
+	h, err := New(agentConfig("codex", ""))
+	require.NoError(t, err)
+	assert.Equal(t, "exec\n--full-auto\nsay \"hi\" $(id)\n", run(t, h, `say "hi" $(id)`))
+}
+
+func TestCLIHarness_CommandOverride(t *testing.T) {
+	fakeAgents(t, "aider")
+	h, err := New(agentConfig("aider", `aider --model sonnet -m "%s"`))
+	require.NoError(t, err)
+	assert.Equal(t, "--model\nsonnet\n-m\ntask\n", run(t, h, "task"))
+	assert.Equal(t, "https://aider.chat/docs/install.html", InstallHint(h))
+
+	// The agent runs with the harness's non-interactive settings
+	h, err = New(shellConfig("aider", "printenv AIDER_YES_ALWAYS AIDER_CHECK_UPDATE # %s"))
+	require.NoError(t, err)
+	assert.Equal(t, "true\nfalse\n", run(t, h, "task"))
+}
+
+func TestCustom(t *testing.T) {
+	h := NewCustom(agentConfig("", `sh -c 'echo "%s"'`))
+	assert.Equal(t, "sh", h.Name())
+	assert.True(t, h.IsAvailable())
+	assert.Equal(t, "task\n", run(t, h, "task"))
+	assert.Empty(t, InstallHint(h))
+
+	assert.False(t, NewCustom(agentConfig("", `tatsu-no-such-agent "%s"`)).IsAvailable())
+	assert.True(t, NewCustom(shellConfig("", `cd sub && make "%s"`)).IsAvailable())
+	assert.False(t, NewCustom(agentConfig("", `cd sub && make "%s"`)).IsAvailable(), "needs prompt_via: shell")
+}
+
+func TestPolicyNotes(t *testing.T) {
+	cfg := agentConfig(NameOpenCode, "")
+	assert.Empty(t, PolicyNotes(newOpenCode(cfg), cfg), "nothing to say about the defaults")
+
+	cfg.Permissions = &config.Permissions{Bash: []config.Rule{{Pattern: "git push*", Action: config.Allow}}}
+	assert.Equal(t, []string{`permission override: bash "git push*": deny → allow`}, PolicyNotes(newOpenCode(cfg), cfg))
+
+	custom := agentConfig(NameCustom, "my-agent %s")
+	custom.Permissions = cfg.Permissions
+	notes := PolicyNotes(NewCustom(custom), custom)
+	require.Len(t, notes, 1)
+	assert.Contains(t, notes[0], "not enforced")
+
+	for _, name := range []string{NameAider, NameCodex, NameGoose, NameCustom} {
+		cfg := agentConfig(name, "my-agent %s")
+		h, err := New(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, []string{fmt.Sprintf("permissions are not enforced by the %s harness; the agent runs with its own settings", h.Name())},
+			PolicyNotes(h, cfg), "%s without a permissions section", name)
+	}
+}
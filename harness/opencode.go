@@ -1,35 +1,147 @@
 package harness
 
 import (
+	"context"
+	"encoding/json"
 	"os"
-	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/jack/tatsu/config"
 )
 
-// AgentEnv returns environment variables for non-interactive OpenCode runs.
-// OPENCODE_CONFIG_CONTENT with explicit permission rules ensures edit, write,
-// bash, etc. run without approval. CI=true signals headless/automated mode.
+// OpenCodeCommand is the agent command used when agent.command is empty.
+const OpenCodeCommand = `opencode run "%s"`
+
+// AgentEnv returns environment variables for non-interactive OpenCode runs
+// with config.DefaultPermissions; see OpenCodeEnv.
 func AgentEnv() []string {
-	return append(os.Environ(),
-		`OPENCODE_CONFIG_CONTENT={"permission":{"*":"allow","edit":"allow","write":"allow","bash":"allow","read":"allow","list":"allow","glob":"allow"}}`,
+	return OpenCodeEnv(config.DefaultPermissions())
+}
+
+// OpenCodeEnv returns environment variables for non-interactive OpenCode
+// runs. OPENCODE_CONFIG_CONTENT carries the permission policy, so allowed
+// tools run without approval and denied ones are refused instead of
+// prompting. CI=true signals headless/automated mode.
+func OpenCodeEnv(p config.Permissions) []string {
+	return openCodeEnv(os.Environ(), p)
+}
+
+func openCodeEnv(base []string, p config.Permissions) []string {
+	return append(base,
+		"OPENCODE_CONFIG_CONTENT="+openCodePermissions(p),
 		"CI=true",
 	)
 }
 
+// openCodePermissions renders the policy as OpenCode config:
+// {"permission":{"*":"allow",...,"bash":{"*":"allow","git push*":"deny"}}}.
+// Bash rules keep their order, which OpenCode uses to pick the last match.
+func openCodePermissions(p config.Permissions) string {
+	var b strings.Builder
+	str := func(s string) {
+		data, _ := json.Marshal(s)
+		b.Write(data)
+	}
+	b.WriteString(`{"permission":{`)
+	first := true
+	sep := func() {
+		if !first {
+			b.WriteByte(',')
+		}
+		first = false
+	}
+	for _, tool := range p.ToolNames() {
+		if tool == "bash" {
+			continue // the bash rules below decide
+		}
+		sep()
+		str(tool)
+		b.WriteByte(':')
+		str(p.Tools[tool])
+	}
+	sep()
+	b.WriteString(`"bash":{`)
+	for i, rule := range p.Bash {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		str(rule.Pattern)
+		b.WriteByte(':')
+		str(rule.Action)
+	}
+	b.WriteString("}}}")
+	return b.String()
+}
+
 type OpenCodeHarness struct {
-	command string
+	cfg *config.Config // nil means OpenCodeCommand
 }
 
 func NewOpenCodeHarness() *OpenCodeHarness {
-	return &OpenCodeHarness{
-		command: "opencode",
-	}
+	return &OpenCodeHarness{}
+}
+
+func newOpenCode(cfg *config.Config) *OpenCodeHarness {
+	return &OpenCodeHarness{cfg: cfg}
 }
 
 func (h *OpenCodeHarness) Name() string {
 	return "OpenCode"
 }
 
+// IsAvailable reports whether the program agent.command runs (opencode by
+// default) is on PATH.
 func (h *OpenCodeHarness) IsAvailable() bool {
-	cmd := exec.Command(h.command, "--version")
-	return cmd.Run() == nil
+	return agentCommand(h.cfg, OpenCodeCommand).available(h.cfg)
+}
+
+// env adds the OpenCode settings for the effective permission policy to
+// base.
+func (h *OpenCodeHarness) env(base []string) []string {
+	if h.cfg == nil {
+		return openCodeEnv(base, config.DefaultPermissions())
+	}
+	p, _ := h.cfg.EffectivePermissions()
+	return openCodeEnv(base, p)
+}
+
+// EnforcesPermissions reports that OpenCode applies the permission policy.
+func (h *OpenCodeHarness) EnforcesPermissions() bool {
+	return true
+}
+
+func (h *OpenCodeHarness) InstallURL() string {
+	return "https://github.com/EmbeddedLLM/opencode"
+}
+
+// openCodeSession matches an OpenCode session ID ("ses_..."), as printed
+// in its output and in the sessionID field of --format json events.
+var openCodeSession = regexp.MustCompile(`\bses_[0-9A-Za-z]+\b`)
+
+// Run runs the OpenCode command, passing the prompt as agent.prompt_via says.
+// With p.SessionID set, `--session <id>` is added after `run` (a templated
+// command uses {{.SessionID}} instead) so the agent continues where the
+// previous iteration left off. A session is only ever taken from this
+// run's own output: OpenCode's newest session may belong to another
+// project or another run, so without one in the output the next iteration
+// starts a new session.
+func (h *OpenCodeHarness) Run(ctx context.Context, p Prompt) (Result, error) {
+	c := agentCommand(h.cfg, OpenCodeCommand)
+	if p.SessionID != "" && !c.isTemplate() {
+		c = c.withArgs("run", "--session", p.SessionID)
+	}
+	var session string
+	onLine := func(line string) {
+		if session == "" {
+			session = openCodeSession.FindString(line)
+		}
+	}
+	env := h.env(baseEnv(p))
+	result, err := runAgent(ctx, h.cfg, c, env, p, onLine)
+	result.SessionID = session
+	if session == "" {
+		result.SessionID = p.SessionID
+	}
+	return result, err
 }
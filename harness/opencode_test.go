@@ -1,9 +1,14 @@
 package harness
 
 import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/jack/tatsu/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -11,7 +16,7 @@ import (
 func TestNewOpenCodeHarness(t *testing.T) {
 	h := NewOpenCodeHarness()
 	require.NotNil(t, h)
-	assert.Equal(t, "opencode", h.command)
+	assert.Nil(t, h.cfg)
 }
 
 func TestOpenCodeHarness_Name(t *testing.T) {
@@ -20,17 +25,13 @@ func TestOpenCodeHarness_Name(t *testing.T) {
 }
 
 func TestOpenCodeHarness_IsAvailable(t *testing.T) {
-	h := NewOpenCodeHarness()
-
-	// Note: This test will pass or fail based on whether opencode is actually installed
-	// We're just testing that the method runs without panic
-	available := h.IsAvailable()
+	t.Setenv("PATH", t.TempDir())
+	assert.False(t, NewOpenCodeHarness().IsAvailable())
 
-	// Log the result for debugging
-	t.Logf("OpenCode available: %v", available)
-
-	// The test passes regardless - we're just checking it doesn't crash
-	// In a real test suite, you might mock the exec.Command call
+	fakeAgents(t, "opencode", "my-opencode")
+	assert.True(t, NewOpenCodeHarness().IsAvailable())
+	assert.True(t, newOpenCode(agentConfig(NameOpenCode, `my-opencode run "%s"`)).IsAvailable(), "the configured program is checked")
+	assert.False(t, newOpenCode(agentConfig(NameOpenCode, `tatsu-no-such-opencode run "%s"`)).IsAvailable())
 }
 
 func TestOpenCodeHarness_ImplementsInterface(t *testing.T) {
@@ -52,3 +53,78 @@ func TestAgentEnv(t *testing.T) {
 	assert.True(t, hasConfig, "AgentEnv should set OPENCODE_CONFIG_CONTENT with permission")
 	assert.True(t, hasCI, "AgentEnv should set CI=true")
 }
+
+func TestOpenCodeEnv_Permissions(t *testing.T) {
+	assert.Equal(t,
+		`{"permission":{"*":"allow","edit":"deny","bash":{"*":"allow","git push*":"deny"}}}`,
+		openCodePermissions(config.Permissions{
+			Tools: map[string]string{"edit": config.Deny, "*": config.Allow},
+			Bash:  []config.Rule{{Pattern: "*", Action: config.Allow}, {Pattern: "git push*", Action: config.Deny}},
+		}))
+	defaults := openCodePermissions(config.DefaultPermissions())
+	assert.True(t, strings.HasPrefix(defaults, `{"permission":{"*":"deny","edit":"allow",`), defaults)
+	assert.Contains(t, defaults, `"bash":{"*":"deny",`)
+	assert.True(t, strings.HasSuffix(defaults, `"git push*":"deny","git reset --hard*":"deny","git clean*":"deny","rm -rf*":"deny","sudo *":"deny"}}}`),
+		"the deny list comes last: %s", defaults)
+
+	cfg := agentConfig(NameOpenCode, "")
+	cfg.Permissions = &config.Permissions{
+		Tools: map[string]string{"webfetch": config.Deny},
+		Bash:  []config.Rule{{Pattern: "git push*", Action: config.Allow}, {Pattern: "docker *", Action: config.Deny}},
+	}
+	cfg.Agent.Argv = []string{"printenv", "OPENCODE_CONFIG_CONTENT", "CI"}
+	cfg.Agent.PromptVia = config.PromptViaEnv
+	p, _ := cfg.EffectivePermissions()
+	assert.Equal(t, openCodePermissions(p)+"\ntrue\n", run(t, newOpenCode(cfg), "task"))
+	assert.Contains(t, openCodePermissions(p), `"webfetch":"deny"`)
+	assert.True(t, strings.HasSuffix(openCodePermissions(p), `"docker *":"deny","git push*":"allow","git reset --hard*":"deny","git clean*":"deny","rm -rf*":"deny","sudo *":"deny"}}}`),
+		openCodePermissions(p))
+}
+
+func TestOpenCodeHarness_Run(t *testing.T) {
+	fakeAgents(t, "opencode")
+	assert.Equal(t, "run\nfix \"it\"\n", run(t, NewOpenCodeHarness(), `fix "it"`))
+
+	cfg := &config.Config{}
+	cfg.Agent.Command = `opencode run --model x "%s"`
+	assert.Equal(t, "run\n--model\nx\ntask\n", run(t, newOpenCode(cfg), "task"))
+}
+
+func TestOpenCodeHarness_Session(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = `echo "Session ses_01JNEW started"; echo run "%s"`
+	cfg.Agent.PromptVia = config.PromptViaShell
+	h := newOpenCode(cfg)
+
+	// A new session is picked up from the output
+	var out bytes.Buffer
+	result, err := h.Run(context.Background(), Prompt{Text: "task", Stdout: &out})
+	require.NoError(t, err)
+	assert.Equal(t, "ses_01JNEW", result.SessionID)
+	assert.Equal(t, "Session ses_01JNEW started\nrun task\n", out.String())
+
+	// Continuing passes --session after run
+	cfg.Agent.Command = `echo run "%s"`
+	out.Reset()
+	result, err = h.Run(context.Background(), Prompt{Text: "again", SessionID: "ses_01JOLD", Stdout: &out})
+	require.NoError(t, err)
+	assert.Equal(t, "ses_01JOLD", result.SessionID)
+	assert.Equal(t, "run --session ses_01JOLD again\n", out.String())
+
+	// Without a session in this run's output none is continued, not even
+	// OpenCode's newest
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "opencode"), []byte("#!/bin/sh\necho ses_01JGLOBAL\n"), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	result, err = h.Run(context.Background(), Prompt{Text: "task", Stdout: &out})
+	require.NoError(t, err)
+	assert.Empty(t, result.SessionID)
+
+	// A template places the session itself
+	cfg.Agent.PromptVia = ""
+	cfg.Agent.Argv = []string{"echo", "{{if .SessionID}}-s {{.SessionID}} {{end}}{{.Prompt}}"}
+	out.Reset()
+	_, err = h.Run(context.Background(), Prompt{Text: "x", SessionID: "ses_1", Stdout: &out})
+	require.NoError(t, err)
+	assert.Equal(t, "-s ses_1 x\n", out.String())
+}
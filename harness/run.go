@@ -0,0 +1,126 @@
+package harness
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/jack/tatsu/proc"
+)
+
+// Prompt is one request to the agent.
+type Prompt struct {
+	Text string
+	// Task and Iteration identify the request, for harnesses that keep
+	// state (e.g. a session) per task.
+	Task      string
+	Iteration int
+	// Vars are the template variables for a templated agent.command
+	// besides Prompt, PromptFile and SessionID (see config.CommandVars).
+	Vars map[string]interface{}
+	// SessionID is the agent session to continue, for harnesses that keep
+	// sessions. Empty starts a new one.
+	SessionID string
+	// Env is the environment the agent inherits, before the harness adds
+	// its own settings. Nil means os.Environ().
+	Env []string
+	// Stdout and Stderr receive the agent's output as it is produced. Nil
+	// discards it.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Result describes a finished agent run.
+type Result struct {
+	ExitCode int // -1 if the agent could not be started or was killed
+	Duration time.Duration
+	Usage    *Usage // nil unless the agent reported it
+	// SessionID is the agent session the run used, if the harness keeps
+	// sessions and could tell.
+	SessionID string
+}
+
+// Usage is the token usage and cost an agent reported for a run. Fields the
+// agent does not report are zero.
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+	TotalTokens  int
+	CostUSD      float64
+}
+
+// runCommand runs c with the prompt's output writers. Unless c.Stdin is
+// set, stdin is closed so an agent waiting for input fails instead of
+// hanging. onLine, if set, sees
+// every complete stdout line (e.g. to pick up usage reports). The error is
+// non-nil if the process could not be started or exited non-zero.
+func runCommand(c *exec.Cmd, p Prompt, onLine func(string)) (Result, error) {
+	c.Stdout = discardIfNil(p.Stdout)
+	c.Stderr = discardIfNil(p.Stderr)
+	if onLine != nil {
+		c.Stdout = &lineTap{w: c.Stdout, fn: onLine}
+	}
+
+	start := time.Now()
+	err := c.Run()
+	if tap, ok := c.Stdout.(*lineTap); ok {
+		tap.flush()
+	}
+	return Result{ExitCode: proc.ExitCode(err), Duration: time.Since(start)}, err
+}
+
+// runShell runs command with bash -c; see runCommand.
+func runShell(ctx context.Context, command string, env []string, p Prompt, onLine func(string)) (Result, error) {
+	c := proc.Shell(ctx, command)
+	c.Env = env
+	return runCommand(c, p, onLine)
+}
+
+// baseEnv returns p.Env, or the inherited environment if it is nil, with
+// room for the harness's own settings.
+func baseEnv(p Prompt) []string {
+	if p.Env == nil {
+		return os.Environ()
+	}
+	return append([]string(nil), p.Env...)
+}
+
+func discardIfNil(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+	return w
+}
+
+// lineTap forwards writes to w and calls fn with every complete line.
+type lineTap struct {
+	w   io.Writer
+	fn  func(string)
+	buf []byte
+}
+
+func (t *lineTap) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	for {
+		i := bytes.IndexByte(t.buf, '\n')
+		if i < 0 {
+			break
+		}
+		t.fn(string(bytes.TrimRight(t.buf[:i], "\r")))
+		t.buf = t.buf[i+1:]
+	}
+	if len(t.buf) > 64*1024 {
+		t.buf = t.buf[:0] // an unterminated line this long is not a usage report
+	}
+	return t.w.Write(p)
+}
+
+func (t *lineTap) flush() {
+	if len(t.buf) > 0 {
+		t.fn(string(t.buf))
+		t.buf = nil
+	}
+}
@@ -0,0 +1,74 @@
+package harness
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustom_Run(t *testing.T) {
+	h := NewCustom(shellConfig("", `echo "out: %s"; echo err >&2; exit 3`))
+
+	var stdout, stderr bytes.Buffer
+	result, err := h.Run(context.Background(), Prompt{Text: "task", Stdout: &stdout, Stderr: &stderr})
+
+	require.Error(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Positive(t, result.Duration)
+	assert.Nil(t, result.Usage)
+	assert.Equal(t, "out: task\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+}
+
+func TestCustom_RunEnv(t *testing.T) {
+	t.Setenv("TATSU_TEST_INHERITED", "inherited")
+	h := NewCustom(shellConfig("", `echo "[$TATSU_TEST_INHERITED] [$ONLY]" # %s`))
+
+	var stdout bytes.Buffer
+	_, err := h.Run(context.Background(), Prompt{Text: "task", Env: []string{"PATH=" + os.Getenv("PATH"), "ONLY=set"}, Stdout: &stdout})
+	require.NoError(t, err)
+	assert.Equal(t, "[] [set]\n", stdout.String(), "Prompt.Env replaces the inherited environment")
+}
+
+func TestCustom_RunCancelled(t *testing.T) {
+	h := NewCustom(shellConfig("", `sleep 10 # %s`))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := h.Run(ctx, Prompt{Text: "task"})
+	require.Error(t, err)
+	assert.Equal(t, -1, result.ExitCode)
+}
+
+func TestCLIHarness_RunReportsUsage(t *testing.T) {
+	h, err := New(shellConfig("aider", `echo "%s"; echo "Tokens: 2.3k sent, 1.1k cache write, 150 received. Cost: \$0.01 message, \$0.05 session."`))
+	require.NoError(t, err)
+
+	var stdout bytes.Buffer
+	result, err := h.Run(context.Background(), Prompt{Text: "task", Stdout: &stdout})
+	require.NoError(t, err)
+	assert.Equal(t, &Usage{InputTokens: 2300, OutputTokens: 150, TotalTokens: 2450, CostUSD: 0.01}, result.Usage)
+	assert.Contains(t, stdout.String(), "Tokens: 2.3k sent", "output is still streamed")
+}
+
+func TestCodexUsage(t *testing.T) {
+	assert.Equal(t, &Usage{TotalTokens: 12345}, codexUsage("tokens used: 12,345"))
+	assert.Nil(t, codexUsage("used tokens wisely"))
+}
+
+func TestLineTap(t *testing.T) {
+	var out bytes.Buffer
+	var lines []string
+	tap := &lineTap{w: &out, fn: func(line string) { lines = append(lines, line) }}
+
+	_, _ = tap.Write([]byte("one\r\ntw"))
+	_, _ = tap.Write([]byte("o\nthree"))
+	tap.flush()
+
+	assert.Equal(t, []string{"one", "two", "three"}, lines)
+	assert.Equal(t, "one\r\ntwo\nthree", out.String())
+}
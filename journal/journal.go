@@ -0,0 +1,577 @@
+// Package journal records every run to .tatsu/runs/<run-id>/: a manifest
+// (task or PRD, config snapshot, git SHA, timing, outcome) and, per
+// iteration, the prompt, agent output, exit code, validation output and
+// durations. It is a runner.Sink, so the CLI and the TUI record runs the
+// same way.
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/runner"
+	"github.com/jack/tatsu/testresult"
+)
+
+// DefaultDir is where runs are recorded, relative to the project directory.
+const DefaultDir = ".tatsu/runs"
+
+// File names inside a run directory and its iteration directories.
+const (
+	ManifestFile   = "manifest.json"
+	IterationFile  = "iteration.json"
+	PromptFile     = "prompt.txt"
+	StdoutFile     = "agent.stdout.log"
+	StderrFile     = "agent.stderr.log"
+	ValidationFile = "validation.log"
+	FeedbackFile   = "feedback.log"
+	BaselineFile   = "baseline.json" // in the task directory
+	ProtectedDir   = "protected"     // copies of the protected files, in task and iteration directories
+)
+
+// Outcomes recorded for runs and tasks.
+const (
+	OutcomeRunning     = "running"
+	OutcomePassed      = "passed"
+	OutcomeFailed      = "failed"
+	OutcomeNoProgress  = "no_progress"
+	OutcomeTimeout     = "timeout"
+	OutcomeInterrupted = "interrupted"
+)
+
+// Manifest describes a run. It is rewritten as the run progresses, so a run
+// that was killed is left with Outcome "running".
+type Manifest struct {
+	ID            string     `json:"id"`
+	Task          string     `json:"task,omitempty"` // single-task runs
+	PRD           string     `json:"prd,omitempty"`  // PRD runs
+	Dir           string     `json:"dir"`            // project directory
+	Config        string     `json:"config"`         // effective tatsu.yaml (see config.Snapshot)
+	MaxIterations int        `json:"max_iterations,omitempty"`
+	Profile       string     `json:"profile,omitempty"` // profile of Config
+	GitSHA        string     `json:"git_sha,omitempty"`
+	Started       time.Time  `json:"started"`
+	Ended         *time.Time `json:"ended,omitempty"`
+	Outcome       string     `json:"outcome"`
+	Error         string     `json:"error,omitempty"`
+	Tasks         []Task     `json:"tasks"`
+	// Resumed lists when `tatsu resume` continued the run.
+	Resumed []time.Time `json:"resumed,omitempty"`
+}
+
+// Task is one task of a run.
+type Task struct {
+	Number     int    `json:"number"` // 1-based, matches the task-NN directory
+	Title      string `json:"title"`
+	Iterations int    `json:"iterations"`
+	Outcome    string `json:"outcome"`
+	Error      string `json:"error,omitempty"`
+	// Profile is the profile the task ran with, if any.
+	Profile string `json:"profile,omitempty"`
+	// Session is the agent session the task's iterations continue, and
+	// SessionStarted the iteration that started it.
+	Session        string `json:"session,omitempty"`
+	SessionStarted int    `json:"session_started,omitempty"`
+	// Baseline is the test summary (or passed/failed) of the validation
+	// run before the task, with validate.baseline or validate.integrity.
+	// Its test results are saved in BaselineFile.
+	Baseline string `json:"baseline,omitempty"`
+	// StartTree is the git tree of the working tree before the task's
+	// first iteration.
+	StartTree string `json:"start_tree,omitempty"`
+	// Skipped is set when validation already passed before the task and
+	// the agent was not run (validate.baseline.if_passing).
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Iteration is the iteration.json of one agent call and its validation.
+type Iteration struct {
+	Task               int        `json:"task"`
+	Iteration          int        `json:"iteration"`
+	Started            time.Time  `json:"started"`
+	AgentExitCode      int        `json:"agent_exit_code"`
+	AgentError         string     `json:"agent_error,omitempty"`
+	AgentDuration      string     `json:"agent_duration"`
+	Usage              *Usage     `json:"usage,omitempty"`
+	Checkpoint         string     `json:"checkpoint,omitempty"`
+	ProtectedChanges   []string   `json:"protected_changes,omitempty"`
+	IntegrityIssues    []string   `json:"integrity_issues,omitempty"`
+	IntegrityAccepted  bool       `json:"integrity_accepted,omitempty"`
+	ValidationSuccess  bool       `json:"validation_success"`
+	ValidationError    string     `json:"validation_error,omitempty"`
+	ValidationDuration string     `json:"validation_duration,omitempty"`
+	Tests              string     `json:"tests,omitempty"`
+	Stages             []Stage    `json:"stages,omitempty"`
+	Ended              *time.Time `json:"ended,omitempty"`
+}
+
+// Usage is the token usage the agent reported for an iteration.
+type Usage struct {
+	InputTokens  int     `json:"input_tokens,omitempty"`
+	OutputTokens int     `json:"output_tokens,omitempty"`
+	TotalTokens  int     `json:"total_tokens,omitempty"`
+	CostUSD      float64 `json:"cost_usd,omitempty"`
+}
+
+// Stage is the result of one validation stage.
+type Stage struct {
+	Name     string `json:"name"`
+	Success  bool   `json:"success"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	ExitCode int    `json:"exit_code"`
+	Duration string `json:"duration"`
+}
+
+// Journal writes a run to disk. Create it with Open and subscribe it to the
+// runner. Write errors do not stop the run; the first one is kept and
+// returned by Err.
+type Journal struct {
+	dir string
+
+	mu       sync.Mutex
+	manifest Manifest
+	task     int // index into manifest.Tasks of the running task, -1 if none
+	next     int // number of the next task to start
+	iter     *Iteration
+	iterDir  string
+	stdout   *os.File
+	stderr   *os.File
+	err      error
+}
+
+// Open creates the directory for run runID under root (DefaultDir if empty)
+// and writes the initial manifest with a snapshot of cfg.
+func Open(root, runID string, cfg *config.Config) (*Journal, error) {
+	if root == "" {
+		root = DefaultDir
+	}
+	dir := filepath.Join(root, runID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create run directory: %w", err)
+	}
+	ignoreTatsuDir(root)
+
+	snapshot, err := config.Snapshot(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot config: %w", err)
+	}
+	wd, _ := os.Getwd()
+	j := &Journal{
+		dir:  dir,
+		task: -1,
+		next: 1,
+		manifest: Manifest{
+			ID:      runID,
+			Dir:     wd,
+			Config:  string(snapshot),
+			Profile: cfg.Profile,
+			GitSHA:  gitHead(),
+			Started: time.Now(),
+			Outcome: OutcomeRunning,
+			Tasks:   []Task{},
+		},
+	}
+	if err := j.writeManifest(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Dir returns the run directory.
+func (j *Journal) Dir() string {
+	return j.dir
+}
+
+// Err returns the first error encountered while writing the journal.
+func (j *Journal) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Handle implements runner.Sink.
+func (j *Journal) Handle(e runner.Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch e := e.(type) {
+	case runner.RunStart:
+		j.manifest.PRD = e.PRD
+		j.manifest.Profile = e.Profile
+		j.save(j.writeManifest())
+
+	case runner.TaskStart:
+		j.startTask(e.Title)
+		j.manifest.Tasks[j.task].Profile = e.Profile
+		j.save(j.writeManifest())
+
+	case runner.IterationStart:
+		j.finishIteration()
+		if j.task < 0 {
+			// Runner used without TaskStart (RunTask called directly)
+			j.startTask(e.Task)
+		}
+		task := &j.manifest.Tasks[j.task]
+		j.manifest.MaxIterations = e.MaxIterations
+		task.Iterations = e.Iteration
+		if e.StartTree != "" {
+			task.StartTree = e.StartTree
+		}
+		j.iter = &Iteration{Task: task.Number, Iteration: e.Iteration, Started: time.Now()}
+		j.iterDir = filepath.Join(j.dir, IterationDir(task.Number, e.Iteration))
+		if err := os.MkdirAll(j.iterDir, 0755); err != nil {
+			j.save(err)
+			return
+		}
+		// A resumed run repeats the iteration it was killed in
+		for _, name := range []string{StdoutFile, StderrFile, ValidationFile, FeedbackFile, IterationFile} {
+			_ = os.Remove(filepath.Join(j.iterDir, name))
+		}
+		j.save(j.writeFile(PromptFile, e.Prompt))
+		if e.StartProtected != nil {
+			j.save(writeProtected(filepath.Join(j.dir, TaskDir(task.Number), ProtectedDir), e.StartProtected))
+		}
+		if e.Protected != nil {
+			j.save(writeProtected(filepath.Join(j.iterDir, ProtectedDir), e.Protected))
+		}
+		j.save(j.writeManifest())
+
+	case runner.CheckpointCreated:
+		if j.iter != nil {
+			j.iter.Checkpoint = e.Name
+		}
+
+	case runner.AgentLine:
+		j.appendLine(e)
+
+	case runner.AgentExit:
+		j.closeOutput()
+		if j.iter == nil {
+			return
+		}
+		j.iter.AgentExitCode = e.ExitCode
+		j.iter.AgentDuration = e.Duration.Round(time.Millisecond).String()
+		if u := e.Usage; u != nil {
+			j.iter.Usage = &Usage{InputTokens: u.InputTokens, OutputTokens: u.OutputTokens, TotalTokens: u.TotalTokens, CostUSD: u.CostUSD}
+		}
+		if e.Err != nil {
+			j.iter.AgentError = e.Err.Error()
+		}
+
+	case runner.Baseline:
+		if j.task >= 0 {
+			baseline := "failed"
+			if e.Result.Success {
+				baseline = "passed"
+			}
+			if line := e.Result.TestSummary(); line != "" {
+				baseline = line
+			}
+			j.manifest.Tasks[j.task].Baseline = baseline
+			j.manifest.Tasks[j.task].Skipped = e.Skipped
+			j.save(j.writeBaseline(j.manifest.Tasks[j.task].Number, e.Result))
+			j.save(j.writeManifest())
+		}
+
+	case runner.IntegrityViolation:
+		if j.iter != nil {
+			j.iter.IntegrityIssues = e.Issues
+			j.iter.IntegrityAccepted = e.Accepted
+			if !e.Accepted {
+				// The iteration passed validation but still counts as failed
+				j.save(j.writeFile(FeedbackFile, e.Feedback))
+			}
+		}
+
+	case runner.GuardViolation:
+		if j.iter != nil {
+			j.iter.ProtectedChanges = e.Changes
+		}
+
+	case runner.SessionStarted:
+		if j.task >= 0 {
+			task := &j.manifest.Tasks[j.task]
+			task.Session, task.SessionStarted = e.SessionID, e.Iteration
+			j.save(j.writeManifest())
+		}
+
+	case runner.ValidationResult:
+		if j.iter == nil {
+			return
+		}
+		j.iter.ValidationSuccess = e.Success
+		j.iter.ValidationDuration = e.Duration.Round(time.Millisecond).String()
+		j.iter.Tests = e.TestSummary()
+		if e.Err != nil {
+			j.iter.ValidationError = e.Err.Error()
+		}
+		for _, s := range e.Stages {
+			j.iter.Stages = append(j.iter.Stages, Stage{
+				Name:     s.Name,
+				Success:  s.Success,
+				Skipped:  s.Skipped,
+				ExitCode: s.ExitCode,
+				Duration: s.Duration.Round(time.Millisecond).String(),
+			})
+		}
+		j.save(j.writeFile(ValidationFile, e.Output))
+		if !e.Success {
+			j.save(j.writeFile(FeedbackFile, e.Feedback))
+		}
+
+	case runner.TaskComplete:
+		j.finishIteration()
+		if j.task >= 0 {
+			task := &j.manifest.Tasks[j.task]
+			task.Iterations = e.Iterations
+			task.Outcome, task.Error = outcome(e.Err)
+			j.task = -1
+		}
+		j.save(j.writeManifest())
+
+	case runner.RunComplete:
+		j.finishIteration()
+		now := time.Now()
+		j.manifest.Ended = &now
+		j.manifest.Outcome, j.manifest.Error = outcome(e.Err)
+		j.save(j.writeManifest())
+	}
+}
+
+// startTask records the start of the next task. A resumed run continues the
+// entry of its interrupted task.
+func (j *Journal) startTask(title string) {
+	number := j.next
+	j.next++
+	j.task = -1
+	for i, task := range j.manifest.Tasks {
+		if task.Number == number {
+			j.task = i
+		}
+	}
+	if j.task < 0 {
+		j.manifest.Tasks = append(j.manifest.Tasks, Task{Number: number})
+		j.task = len(j.manifest.Tasks) - 1
+	}
+	j.manifest.Tasks[j.task].Title = title
+	j.manifest.Tasks[j.task].Outcome = OutcomeRunning
+	j.manifest.Tasks[j.task].Error = ""
+	if j.manifest.PRD == "" {
+		j.manifest.Task = title
+	}
+}
+
+// TaskDir is the directory of a task relative to the run directory.
+func TaskDir(task int) string {
+	return fmt.Sprintf("task-%02d", task)
+}
+
+// IterationDir is the directory of an iteration relative to the run
+// directory, named like the git checkpoint of the same iteration.
+func IterationDir(task, iteration int) string {
+	return filepath.Join(TaskDir(task), fmt.Sprintf("iter-%03d", iteration))
+}
+
+// savedBaseline is the BaselineFile of a task: what a resumed task needs
+// of its baseline validation. Test messages are left out; the names and
+// counts are enough to compare with.
+type savedBaseline struct {
+	Success bool               `json:"success"`
+	Report  *testresult.Report `json:"report,omitempty"`
+}
+
+func (j *Journal) writeBaseline(task int, result runner.ValidationResult) error {
+	saved := savedBaseline{Success: result.Success}
+	if result.Report != nil {
+		report := *result.Report
+		report.Tests = make([]testresult.Test, len(result.Report.Tests))
+		for i, t := range result.Report.Tests {
+			report.Tests[i] = testresult.Test{Name: t.Name, Status: t.Status}
+		}
+		saved.Report = &report
+	}
+	dir := filepath.Join(j.dir, TaskDir(task))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, BaselineFile), saved)
+}
+
+// writeProtected replaces dir with copies of the protected files, so a
+// resumed task can still tell what the agent changed.
+func writeProtected(dir string, files map[string]runner.ProtectedFile) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, f.Data, f.Mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *Journal) appendLine(e runner.AgentLine) {
+	if j.iter == nil {
+		return
+	}
+	f := &j.stdout
+	name := StdoutFile
+	if e.Stream == runner.Stderr {
+		f, name = &j.stderr, StderrFile
+	}
+	if *f == nil {
+		file, err := os.OpenFile(filepath.Join(j.iterDir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			j.save(err)
+			return
+		}
+		*f = file
+	}
+	_, err := fmt.Fprintln(*f, e.Line)
+	j.save(err)
+}
+
+func (j *Journal) closeOutput() {
+	for _, f := range []**os.File{&j.stdout, &j.stderr} {
+		if *f != nil {
+			j.save((*f).Close())
+			*f = nil
+		}
+	}
+}
+
+// finishIteration writes iteration.json for the current iteration, if any.
+func (j *Journal) finishIteration() {
+	j.closeOutput()
+	if j.iter == nil {
+		return
+	}
+	now := time.Now()
+	j.iter.Ended = &now
+	j.save(writeJSON(filepath.Join(j.iterDir, IterationFile), j.iter))
+	j.iter = nil
+}
+
+func (j *Journal) writeFile(name, content string) error {
+	return os.WriteFile(filepath.Join(j.iterDir, name), []byte(content), 0644)
+}
+
+func (j *Journal) writeManifest() error {
+	return writeJSON(filepath.Join(j.dir, ManifestFile), &j.manifest)
+}
+
+// save keeps the first error.
+func (j *Journal) save(err error) {
+	if err != nil && j.err == nil {
+		j.err = err
+	}
+}
+
+// outcome classifies the error of a task or run.
+func outcome(err error) (string, string) {
+	var stall *runner.StallError
+	switch {
+	case err == nil:
+		return OutcomePassed, ""
+	case errors.Is(err, context.Canceled):
+		return OutcomeInterrupted, err.Error()
+	case errors.As(err, &stall):
+		return OutcomeNoProgress, err.Error()
+	case runner.IsTimeout(err):
+		return OutcomeTimeout, err.Error()
+	default:
+		return OutcomeFailed, err.Error()
+	}
+}
+
+// writeJSON writes v atomically, so a killed run never leaves a truncated file.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// gitHead returns the commit checked out in the current directory, or "".
+func gitHead() string {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// ignoreTatsuDir keeps run records out of `git status` by dropping a
+// .gitignore into the .tatsu directory (the parent of root) if it has none.
+func ignoreTatsuDir(root string) {
+	tatsuDir := filepath.Dir(root)
+	if filepath.Base(tatsuDir) != ".tatsu" {
+		return
+	}
+	path := filepath.Join(tatsuDir, ".gitignore")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		_ = os.WriteFile(path, []byte("*\n"), 0644)
+	}
+}
+
+// Load reads the manifest of the run in dir.
+func Load(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", ManifestFile, err)
+	}
+	return &m, nil
+}
+
+// List returns the manifests of the runs under root (DefaultDir if empty),
+// oldest first. Directories without a readable manifest are skipped.
+func List(root string) ([]*Manifest, error) {
+	if root == "" {
+		root = DefaultDir
+	}
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var runs []*Manifest
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if m, err := Load(filepath.Join(root, entry.Name())); err == nil {
+			runs = append(runs, m)
+		}
+	}
+	sort.Slice(runs, func(a, b int) bool { return runs[a].ID < runs[b].ID })
+	return runs, nil
+}
@@ -0,0 +1,183 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/harness"
+	"github.com/jack/tatsu/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// mockHarness runs agent.command like the custom harness but is always
+// available.
+type mockHarness struct {
+	*harness.Custom
+}
+
+func newMockHarness(cfg *config.Config) *mockHarness {
+	return &mockHarness{harness.NewCustom(cfg)}
+}
+
+func (m *mockHarness) Name() string      { return "MockHarness" }
+func (m *mockHarness) IsAvailable() bool { return true }
+
+func TestJournal_RecordsRun(t *testing.T) {
+	root := filepath.Join(t.TempDir(), ".tatsu", "runs")
+	marker := filepath.Join(t.TempDir(), "attempts")
+
+	cfg := &config.Config{Profile: "fast"}
+	cfg.Agent.Command = "echo \"agent: %s\"; echo oops >&2; echo x >> " + marker
+	cfg.Agent.PromptVia = config.PromptViaShell
+	// Fails on the first attempt, passes on the second
+	cfg.Validate.Command = "test $(wc -l < " + marker + ") -ge 2 || { echo not yet; exit 1; }"
+
+	r := runner.NewWithMaxIterations(cfg, newMockHarness(cfg), 3)
+	j, err := Open(root, r.RunID(), cfg)
+	require.NoError(t, err)
+	r.Subscribe(j)
+
+	require.NoError(t, r.Run(context.Background(), "do it"))
+	require.NoError(t, j.Err())
+
+	m, err := Load(j.Dir())
+	require.NoError(t, err)
+	assert.Equal(t, r.RunID(), m.ID)
+	assert.Equal(t, "do it", m.Task)
+	assert.Equal(t, OutcomePassed, m.Outcome)
+	assert.Equal(t, 3, m.MaxIterations)
+	assert.Equal(t, "fast", m.Profile)
+	assert.NotNil(t, m.Ended)
+	require.Len(t, m.Tasks, 1)
+	// The start tree is that of the checkout the test runs in
+	assert.Equal(t, Task{Number: 1, Title: "do it", Iterations: 2, Outcome: OutcomePassed, Profile: "fast", StartTree: m.Tasks[0].StartTree}, m.Tasks[0])
+
+	var snapshot config.Config
+	require.NoError(t, yaml.Unmarshal([]byte(m.Config), &snapshot))
+	assert.Equal(t, cfg.Validate.Command, snapshot.Validate.Command)
+
+	iter1 := filepath.Join(j.Dir(), IterationDir(1, 1))
+	assertFile(t, filepath.Join(iter1, PromptFile), "do it")
+	assertFile(t, filepath.Join(iter1, StdoutFile), "agent: do it\n")
+	assertFile(t, filepath.Join(iter1, StderrFile), "oops\n")
+	assertFile(t, filepath.Join(iter1, ValidationFile), "not yet\n")
+	assertFile(t, filepath.Join(iter1, FeedbackFile), "not yet\n")
+
+	var it Iteration
+	data, err := os.ReadFile(filepath.Join(iter1, IterationFile))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &it))
+	assert.Equal(t, 1, it.Iteration)
+	assert.False(t, it.ValidationSuccess)
+	assert.Equal(t, 0, it.AgentExitCode)
+	require.Len(t, it.Stages, 1)
+	assert.Equal(t, 1, it.Stages[0].ExitCode)
+
+	iter2 := filepath.Join(j.Dir(), IterationDir(1, 2))
+	assert.FileExists(t, filepath.Join(iter2, IterationFile))
+	assert.NoFileExists(t, filepath.Join(iter2, FeedbackFile))
+
+	assertFile(t, filepath.Join(root, "..", ".gitignore"), "*\n")
+}
+
+func TestJournal_ScrubsSecrets(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("TATSU_TEST_API_KEY", "sk-passed-0123456789")
+	cfg := &config.Config{}
+	cfg.Agent.Command = `echo "key=$TATSU_TEST_API_KEY token=$SET_TOKEN" # %s`
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Agent.Env.Set = map[string]string{"SET_TOKEN": "set-token-0123456789"}
+	cfg.Validate.Command = `echo "$TATSU_TEST_API_KEY $SET_TOKEN"; exit 1`
+	cfg.Patience = -1
+
+	r := runner.NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+	j, err := Open(root, r.RunID(), cfg)
+	require.NoError(t, err)
+	r.Subscribe(j)
+	require.Error(t, r.Run(context.Background(), "task"))
+	require.NoError(t, j.Err())
+
+	files := 0
+	require.NoError(t, filepath.Walk(j.Dir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		files++
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "sk-passed-0123456789", path)
+		assert.NotContains(t, string(data), "set-token-0123456789", path)
+		return nil
+	}))
+	assert.Greater(t, files, 5)
+	assertFile(t, filepath.Join(j.Dir(), IterationDir(1, 1), StdoutFile), "key=[REDACTED] token=[REDACTED]\n")
+}
+
+func TestJournal_FailedRun(t *testing.T) {
+	root := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Agent.Command = "true %s"
+	cfg.Validate.Command = "exit 1"
+	cfg.Patience = -1
+
+	r := runner.NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+	j, err := Open(root, r.RunID(), cfg)
+	require.NoError(t, err)
+	r.Subscribe(j)
+	require.Error(t, r.Run(context.Background(), "task"))
+
+	m, err := Load(j.Dir())
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeFailed, m.Outcome)
+	assert.Equal(t, "max iterations reached", m.Error)
+	assert.Equal(t, OutcomeFailed, m.Tasks[0].Outcome)
+}
+
+func TestOutcome(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{nil, OutcomePassed},
+		{context.Canceled, OutcomeInterrupted},
+		{&runner.TimeoutError{Step: "task"}, OutcomeTimeout},
+		{&runner.StallError{Iterations: 3}, OutcomeNoProgress},
+		{runner.ErrMaxIterations, OutcomeFailed},
+	}
+	for _, tt := range tests {
+		got, _ := outcome(tt.err)
+		assert.Equal(t, tt.expected, got)
+	}
+}
+
+func TestList(t *testing.T) {
+	root := t.TempDir()
+	for _, id := range []string{"20261017-120000-bbbbbb", "20261016-120000-aaaaaa"} {
+		_, err := Open(root, id, &config.Config{})
+		require.NoError(t, err)
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(root, "junk"), 0755))
+
+	runs, err := List(root)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, "20261016-120000-aaaaaa", runs[0].ID)
+	assert.Equal(t, OutcomeRunning, runs[1].Outcome)
+
+	runs, err = List(filepath.Join(root, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
+
+func assertFile(t *testing.T, path, expected string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(data))
+}
@@ -0,0 +1,158 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jack/tatsu/runner"
+)
+
+// Resumable reports whether a run can be continued with `tatsu resume`:
+// it was interrupted or killed before finishing.
+func (m *Manifest) Resumable() bool {
+	return m.Outcome == OutcomeRunning || m.Outcome == OutcomeInterrupted
+}
+
+// LatestResumable returns the most recent resumable run under root
+// (DefaultDir if empty).
+func LatestResumable(root string) (*Manifest, error) {
+	runs, err := List(root)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Resumable() {
+			return runs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no interrupted run found in %s", rootDir(root))
+}
+
+// Resume reads where the run in dir left off: the task that was running (or
+// the next one, if the run stopped between tasks), how many of its
+// iterations completed validation, the feedback the next iteration should
+// be given, the tree and baseline validation the task started from, and
+// the protected files from before the task and the interrupted iteration.
+func Resume(dir string) (*Manifest, runner.ResumeState, error) {
+	m, err := Load(dir)
+	if err != nil {
+		return nil, runner.ResumeState{}, err
+	}
+	if !m.Resumable() {
+		return nil, runner.ResumeState{}, fmt.Errorf("run %s is %s, nothing to resume", m.ID, m.Outcome)
+	}
+
+	state := runner.ResumeState{RunID: m.ID, Task: len(m.Tasks) + 1, Title: m.Task}
+	for _, task := range m.Tasks {
+		if task.Outcome == OutcomeRunning || task.Outcome == OutcomeInterrupted {
+			state.Task, state.Title = task.Number, task.Title
+			state.Iteration, state.LastValidationOutput, state.FailedStages = lastFailure(dir, task)
+			state.SessionID, state.SessionStart = task.Session, task.SessionStarted
+			state.StartTree = task.StartTree
+			state.Baseline = loadBaseline(dir, task)
+			state.StartProtected = loadProtected(filepath.Join(dir, TaskDir(task.Number), ProtectedDir))
+			state.Protected = loadProtected(filepath.Join(dir, IterationDir(task.Number, state.Iteration+1), ProtectedDir))
+			break
+		}
+	}
+	return m, state, nil
+}
+
+// lastFailure finds the last iteration of task whose validation completed
+// and failed, or passed with test changes the integrity check rejected. An
+// iteration cut off before its validation finished is run again.
+func lastFailure(dir string, task Task) (iteration int, feedback string, failedStages []string) {
+	for i := task.Iterations; i >= 1; i-- {
+		iterDir := filepath.Join(dir, IterationDir(task.Number, i))
+		data, err := os.ReadFile(filepath.Join(iterDir, FeedbackFile))
+		if err != nil {
+			continue
+		}
+		var it Iteration
+		if raw, err := os.ReadFile(filepath.Join(iterDir, IterationFile)); err == nil && json.Unmarshal(raw, &it) == nil && len(it.Stages) > 1 {
+			for _, s := range it.Stages {
+				if !s.Success && !s.Skipped {
+					failedStages = append(failedStages, s.Name)
+				}
+			}
+		}
+		return i, string(data), failedStages
+	}
+	return 0, "", nil
+}
+
+// loadBaseline reads the baseline validation saved for task, or nil if
+// there is none.
+func loadBaseline(dir string, task Task) *runner.ValidationResult {
+	data, err := os.ReadFile(filepath.Join(dir, TaskDir(task.Number), BaselineFile))
+	if err != nil {
+		return nil
+	}
+	var saved savedBaseline
+	if json.Unmarshal(data, &saved) != nil {
+		return nil
+	}
+	return &runner.ValidationResult{Success: saved.Success, Report: saved.Report}
+}
+
+// loadProtected reads the protected files saved in dir, or nil if there
+// are none.
+func loadProtected(dir string) map[string]runner.ProtectedFile {
+	if _, err := os.Stat(dir); err != nil {
+		return nil
+	}
+	files := make(map[string]runner.ProtectedFile)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(name)] = runner.ProtectedFile{Data: data, Mode: info.Mode().Perm()}
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+	return files
+}
+
+// Reopen continues recording the run in dir after `tatsu resume`. The
+// interrupted task's entry is reused and new iterations are added next to
+// the old ones.
+func Reopen(dir string) (*Journal, error) {
+	m, state, err := Resume(dir)
+	if err != nil {
+		return nil, err
+	}
+	m.Outcome = OutcomeRunning
+	m.Ended = nil
+	m.Error = ""
+	m.Resumed = append(m.Resumed, time.Now())
+	j := &Journal{dir: dir, manifest: *m, task: -1, next: state.Task}
+	if err := j.writeManifest(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func rootDir(root string) string {
+	if root == "" {
+		return DefaultDir
+	}
+	return root
+}
@@ -0,0 +1,164 @@
+package journal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/runner"
+	"github.com/jack/tatsu/testresult"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interruptedRun records a run whose first iteration failed validation and
+// that was killed during its second iteration.
+func interruptedRun(t *testing.T, root string) *Journal {
+	t.Helper()
+	start := map[string]runner.ProtectedFile{"a_test.go": {Data: []byte("orig\n"), Mode: 0644}}
+	j, err := Open(root, "20261017-120000-abcdef", &config.Config{})
+	require.NoError(t, err)
+	for _, e := range []runner.Event{
+		runner.RunStart{Total: 1, Pending: 1},
+		runner.TaskStart{Index: 1, Total: 1, Title: "task"},
+		runner.Baseline{Task: "task", Result: runner.ValidationResult{Report: &testresult.Report{
+			Tests:  []testresult.Test{{Name: "TestA", Status: testresult.Passed}, {Name: "TestB", Status: testresult.Failed, Message: "FAIL: secret detail"}},
+			Passed: 1,
+			Failed: 1,
+		}}},
+		runner.IterationStart{Task: "task", Iteration: 1, MaxIterations: 5, Prompt: "task", StartTree: "tree-before", Protected: start, StartProtected: start},
+		runner.AgentExit{},
+		runner.SessionStarted{Task: "task", Iteration: 1, SessionID: "ses_1"},
+		runner.ValidationResult{
+			Output:   "full output",
+			Feedback: "boom",
+			Stages: []runner.StageResult{
+				{Name: "build", Success: true},
+				{Name: "test", ExitCode: 1},
+			},
+		},
+		runner.IterationStart{Task: "task", Iteration: 2, MaxIterations: 5, Prompt: "retry", StartTree: "tree-before", Protected: protectedBeforeIteration2},
+		runner.AgentLine{Stream: runner.Stdout, Line: "working..."},
+	} {
+		j.Handle(e)
+	}
+	require.NoError(t, j.Err())
+	return j
+}
+
+// protectedBeforeIteration2 are the protected files interruptedRun's
+// iteration 1 left.
+var protectedBeforeIteration2 = map[string]runner.ProtectedFile{
+	"a_test.go":       {Data: []byte("changed\n"), Mode: 0644},
+	"tests/b_test.go": {Data: []byte("new\n"), Mode: 0600},
+}
+
+func TestResume(t *testing.T) {
+	j := interruptedRun(t, t.TempDir())
+
+	m, state, err := Resume(j.Dir())
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeRunning, m.Outcome)
+	assert.Equal(t, runner.ResumeState{
+		RunID:                "20261017-120000-abcdef",
+		Task:                 1,
+		Title:                "task",
+		Iteration:            1,
+		LastValidationOutput: "boom",
+		FailedStages:         []string{"test"},
+		SessionID:            "ses_1",
+		SessionStart:         1,
+		StartTree:            "tree-before",
+		Baseline: &runner.ValidationResult{Report: &testresult.Report{
+			Tests:  []testresult.Test{{Name: "TestA", Status: testresult.Passed}, {Name: "TestB", Status: testresult.Failed}},
+			Passed: 1,
+			Failed: 1,
+		}},
+		StartProtected: map[string]runner.ProtectedFile{"a_test.go": {Data: []byte("orig\n"), Mode: 0644}},
+		Protected:      protectedBeforeIteration2,
+	}, state, "the baseline is saved without test messages")
+	assert.Equal(t, "ses_1", m.Tasks[0].Session)
+}
+
+func TestResume_IntegrityFeedback(t *testing.T) {
+	j, err := Open(t.TempDir(), "run", &config.Config{})
+	require.NoError(t, err)
+	for _, e := range []runner.Event{
+		runner.TaskStart{Index: 1, Total: 1, Title: "task"},
+		runner.IterationStart{Task: "task", Iteration: 1, MaxIterations: 3, Prompt: "task"},
+		runner.ValidationResult{Success: true, Output: "ok"},
+		runner.IntegrityViolation{Task: "task", Iteration: 1, Issues: []string{"TestA is missing"}, Feedback: "Restore TestA"},
+		runner.IterationStart{Task: "task", Iteration: 2, MaxIterations: 3, Prompt: "Restore TestA"},
+	} {
+		j.Handle(e)
+	}
+	require.NoError(t, j.Err())
+
+	_, state, err := Resume(j.Dir())
+	require.NoError(t, err)
+	assert.Equal(t, 1, state.Iteration, "an iteration whose test changes were rejected counts as failed")
+	assert.Equal(t, "Restore TestA", state.LastValidationOutput)
+	assert.Empty(t, state.FailedStages)
+}
+
+func TestResume_NotResumable(t *testing.T) {
+	root := t.TempDir()
+	j, err := Open(root, "run", &config.Config{})
+	require.NoError(t, err)
+	j.Handle(runner.RunComplete{})
+
+	_, _, err = Resume(j.Dir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "run run is passed, nothing to resume")
+}
+
+func TestReopen_ContinuesRun(t *testing.T) {
+	root := t.TempDir()
+	j := interruptedRun(t, root)
+
+	_, state, err := Resume(j.Dir())
+	require.NoError(t, err)
+	reopened, err := Reopen(j.Dir())
+	require.NoError(t, err)
+
+	cfg := &config.Config{}
+	cfg.Agent.Command = "true %s"
+	cfg.Validate.Command = "true"
+	r := runner.NewWithMaxIterations(cfg, newMockHarness(cfg), 5)
+	r.Resume(state)
+	r.Subscribe(reopened)
+	require.NoError(t, r.Run(context.Background(), "task"))
+	require.NoError(t, reopened.Err())
+
+	m, err := Load(j.Dir())
+	require.NoError(t, err)
+	assert.Equal(t, OutcomePassed, m.Outcome)
+	assert.Len(t, m.Resumed, 1)
+	require.Len(t, m.Tasks, 1, "the interrupted task's entry is reused")
+	assert.Equal(t, Task{Number: 1, Title: "task", Iterations: 2, Outcome: OutcomePassed, Session: "ses_1", SessionStarted: 1,
+		Baseline: "1 passed, 1 failed, 0 skipped", StartTree: "tree-before"}, m.Tasks[0], "the resumed task keeps its start tree")
+
+	// Iteration 2 was run again; iteration 1's records are kept
+	assertFile(t, filepath.Join(j.Dir(), IterationDir(1, 1), FeedbackFile), "boom")
+	prompt, err := os.ReadFile(filepath.Join(j.Dir(), IterationDir(1, 2), PromptFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(prompt), "boom")
+	assert.NoFileExists(t, filepath.Join(j.Dir(), IterationDir(1, 2), StdoutFile), "output of the killed attempt is dropped")
+}
+
+func TestLatestResumable(t *testing.T) {
+	root := t.TempDir()
+	interruptedRun(t, root)
+	done, err := Open(root, "20261018-120000-ffffff", &config.Config{})
+	require.NoError(t, err)
+	done.Handle(runner.RunComplete{})
+
+	m, err := LatestResumable(root)
+	require.NoError(t, err)
+	assert.Equal(t, "20261017-120000-abcdef", m.ID)
+
+	_, err = LatestResumable(t.TempDir())
+	assert.Error(t, err)
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
-	"flag"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
+	"github.com/jack/tatsu/checkpoint"
 	"github.com/jack/tatsu/config"
 	"github.com/jack/tatsu/harness"
+	"github.com/jack/tatsu/journal"
 	"github.com/jack/tatsu/prd"
 	"github.com/jack/tatsu/runner"
 	"github.com/jack/tatsu/tui"
@@ -14,229 +23,569 @@ import (
 
 const Version = "0.1.0"
 
+// Exit codes for failed runs
 const (
-	maxIterationsLimit = 100 // Maximum allowed iterations for safety
+	exitFailure          = 1
+	exitUsage            = 2   // bad command line, as for flag parse errors
+	exitMaxIterations    = 3   // the task gave up: max iterations or no progress
+	exitConfig           = 4   // tatsu.yaml is missing, invalid or unreadable
+	exitAgentUnavailable = 5   // unknown harness or agent CLI not installed
+	exitTimeout          = 124 // same as coreutils timeout(1)
+	exitInterrupted      = 130 // 128 + SIGINT
 )
 
+// out receives human-readable progress: stdout, or stderr with
+// --output=json so that stdout carries only JSON events (see jsonOut).
+var out io.Writer = os.Stdout
+
+// jsonOut writes the run's events as NDJSON to stdout with --output=json.
+var jsonOut *runner.JSONPrinter
+
 func main() {
-	// Parse flags
-	maxIterFlag := flag.Int("max-iterations", runner.DefaultMaxIterations, "Maximum number of retry iterations")
-	dirFlag := flag.String("C", "", "Run in directory (load tatsu.yaml and run commands there)")
-	flag.Parse()
+	dispatch(os.Args[1:])
+}
 
-	// Change to target directory if set
-	if *dirFlag != "" {
-		if err := os.Chdir(*dirFlag); err != nil {
-			fmt.Printf("❌ Error: %v\n", err)
-			os.Exit(1)
-		}
+// runTUI opens the TUI; everything runs inside it, q to quit.
+func runTUI(opts runFlags) {
+	if jsonOut != nil {
+		fatal(exitUsage, "Error: -output json needs a command (the TUI has no JSON output)")
 	}
-
-	// Validate max iterations
-	if *maxIterFlag < 1 {
-		fmt.Printf("❌ Error: max-iterations must be at least 1\n")
-		os.Exit(1)
+	findConfig(false)
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		fatal(exitConfig, "%v", err)
 	}
-	if *maxIterFlag > maxIterationsLimit {
-		fmt.Printf("❌ Error: max-iterations cannot exceed %d (got %d)\n", maxIterationsLimit, *maxIterFlag)
+	h := newHarness(cfg)
+	if err := tui.Run(cfg, h, maxIterations(cfg), profileLoader(opts)); err != nil {
+		fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	// Get remaining args after flag parsing
-	args := flag.Args()
+func runTask(task string, opts runFlags) {
+	fmt.Fprintf(out, "🎯 Task: %s\n\n", task)
 
-	// No args: open TUI (everything runs inside TUI; q to quit)
-	if len(args) < 1 {
-		if _, err := os.Stat("tatsu.yaml"); os.IsNotExist(err) {
-			fmt.Println("📝 No tatsu.yaml found. Generating configuration...")
-			if err := config.Generate(false); err != nil {
-				fmt.Printf("❌ Failed to generate config: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Println("✅ Created tatsu.yaml")
-		}
-		cfg, err := config.Load()
-		if err != nil {
-			fmt.Printf("❌ %v\n", err)
-			os.Exit(1)
-		}
-		h := harness.NewOpenCodeHarness()
-		if !h.IsAvailable() {
-			fmt.Printf("❌ %s is not installed or not in PATH\n", h.Name())
-			os.Exit(1)
+	// Find the project config, generate one if there is none
+	findConfig(true)
+
+	// Load config
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		fatal(exitConfig, "%v", err)
+	}
+
+	fmt.Fprintln(out, "✅ Configuration loaded successfully")
+	if cfg.Profile != "" {
+		fmt.Fprintf(out, "   Profile: %s\n", cfg.Profile)
+	}
+	if cfg.Agent.HasCommand() {
+		fmt.Fprintf(out, "   Agent: %s\n", cfg.Agent.CommandLine())
+	} else {
+		fmt.Fprintf(out, "   Agent: %s (default command)\n", cfg.Agent.Harness)
+	}
+	for _, stage := range cfg.ValidationStages() {
+		if stage.Name == config.DefaultStageName {
+			fmt.Fprintf(out, "   Validate: %s\n", stage.Command)
+		} else {
+			fmt.Fprintf(out, "   Validate [%s]: %s\n", stage.Name, stage.Command)
 		}
-		if err := tui.Run(cfg, *maxIterFlag); err != nil {
-			fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
-			os.Exit(1)
+	}
+	if cfg.MaxIterations != 0 && cfg.MaxIterations != runner.DefaultMaxIterations {
+		fmt.Fprintf(out, "   Max iterations: %d\n", cfg.MaxIterations)
+	}
+	fmt.Fprintln(out)
+
+	// Check harness availability
+	h := newHarness(cfg)
+
+	fmt.Fprintf(out, "✅ %s is available\n\n", h.Name())
+
+	// Run task with runner (Ctrl+C cancels and kills the agent/validation)
+	ctx, stop := signalContext()
+	defer stop()
+	r := runner.NewWithMaxIterations(cfg, h, maxIterations(cfg))
+	r.SetConfirm(confirmOnTerminal)
+	subscribeOutput(r)
+	j := recordRun(r, cfg)
+	err = r.Run(ctx, task)
+	closeJournal(j)
+	if err != nil {
+		fmt.Fprintf(out, "⚠️  %v\n", err)
+		stop()
+		os.Exit(exitCode(err))
+	}
+}
+
+// newHarness creates the harness selected by agent.harness (or detected from
+// agent.command) and exits if it is unknown or its CLI is not installed.
+func newHarness(cfg *config.Config) harness.Harness {
+	h, err := harness.New(cfg)
+	if err != nil {
+		fatal(exitAgentUnavailable, "%v", err)
+	}
+	if !h.IsAvailable() {
+		msg := h.Name() + " is not installed or not in PATH"
+		if hint := harness.InstallHint(h); hint != "" {
+			msg += "\n   Install from: " + hint
 		}
-		return
+		fatal(exitAgentUnavailable, "%s", msg)
 	}
+	for _, note := range harness.PolicyNotes(h, cfg) {
+		fmt.Fprintf(out, "⚠️  %s\n", note)
+	}
+	return h
+}
 
-	command := args[0]
-
-	switch command {
-	case "run":
-		if len(args) < 2 {
-			fmt.Println("❌ Error: task description required")
-			printUsage()
-			os.Exit(1)
-		}
-		task := args[1]
-		runTask(task, *maxIterFlag)
-	case "generate", "gen":
-		force := false
-		if len(args) > 1 {
-			for _, arg := range args[1:] {
-				if arg == "--force" || arg == "-f" {
-					force = true
-					break
-				}
-			}
-		}
-		generateConfig(force)
-	case "prd":
-		if len(args) < 2 {
-			fmt.Println("❌ Error: PRD file required")
-			printUsage()
-			os.Exit(1)
-		}
-		prdFile := args[1]
-		runPRD(prdFile, *maxIterFlag)
-	case "version", "--version", "-v":
-		fmt.Printf("tatsu v%s\n", Version)
-	default:
-		fmt.Printf("❌ Unknown command: %s\n\n", command)
-		printUsage()
-		os.Exit(1)
+// subscribeOutput subscribes the sink selected by -output: the progress
+// printer, or the JSON event writer.
+func subscribeOutput(r *runner.Runner) {
+	if jsonOut != nil {
+		r.Subscribe(jsonOut)
+	} else {
+		r.Subscribe(runner.NewPrinter(os.Stdout, os.Stderr))
 	}
 }
 
-func runTask(task string, maxIter int) {
-	fmt.Printf("🎯 Task: %s\n\n", task)
+// recordRun subscribes a journal that records the run under .tatsu/runs.
+// Failing to create it only warns: the run itself is not affected.
+func recordRun(r *runner.Runner, cfg *config.Config) *journal.Journal {
+	j, err := journal.Open("", r.RunID(), cfg)
+	if err != nil {
+		fmt.Fprintf(out, "⚠️  Run journal disabled: %v\n", err)
+		return nil
+	}
+	r.Subscribe(j)
+	return j
+}
 
-	// Check if config exists, generate if not
-	if _, err := os.Stat("tatsu.yaml"); os.IsNotExist(err) {
-		fmt.Println("📝 No tatsu.yaml found. Generating configuration...")
-		if err := config.Generate(false); err != nil {
-			fmt.Printf("❌ Failed to generate config: %v\n", err)
-			os.Exit(1)
+// closeJournal reports where the run was recorded and any write error.
+func closeJournal(j *journal.Journal) {
+	if j == nil {
+		return
+	}
+	if err := j.Err(); err != nil {
+		fmt.Fprintf(out, "⚠️  Run journal incomplete: %v\n", err)
+	}
+	fmt.Fprintf(out, "📓 Run recorded in %s\n", j.Dir())
+}
+
+// findConfig locates the project config. Unless -config names one, it is
+// the tatsu.yaml in the current directory or the nearest parent, and tatsu
+// runs in that directory. Without one, tatsu.yaml is generated here; hint
+// mentions how to regenerate it.
+func findConfig(hint bool) {
+	if configFlag != "" {
+		return
+	}
+	if enterProject() {
+		return
+	}
+	fmt.Fprintln(out, "📝 No tatsu.yaml found. Generating configuration...")
+	if err := config.Generate(false); err != nil {
+		fatal(exitConfig, "Failed to generate config: %v", err)
+	}
+	fmt.Fprintln(out, "✅ Created tatsu.yaml")
+	if hint {
+		fmt.Fprintln(out, "   (Run 'tatsu generate --force' to regenerate)")
+	}
+}
+
+// enterProject changes to the directory of the project tatsu.yaml found
+// from the current directory, and reports whether there is one.
+func enterProject() bool {
+	path := config.FindProjectFile(".")
+	if path == "" {
+		return false
+	}
+	if dir := filepath.Dir(path); relativePath(dir) != "." {
+		if err := os.Chdir(dir); err != nil {
+			fatal(exitFailure, "Error: %v", err)
 		}
-		fmt.Println("✅ Created tatsu.yaml")
-		fmt.Println("   (Run 'tatsu generate --force' to regenerate)")
+		fmt.Fprintf(out, "📁 Using %s\n", path)
 	}
+	return true
+}
 
-	// Load config
-	cfg, err := config.Load()
+// relativePath returns path relative to the current directory if it can.
+func relativePath(path string) string {
+	wd, err := os.Getwd()
 	if err != nil {
-		fmt.Printf("❌ %v\n", err)
-		os.Exit(1)
+		return path
 	}
-
-	fmt.Println("✅ Configuration loaded successfully")
-	fmt.Printf("   Agent: %s\n", cfg.Agent.Command)
-	fmt.Printf("   Validate: %s\n", cfg.Validate.Command)
-	if maxIter != runner.DefaultMaxIterations {
-		fmt.Printf("   Max iterations: %d\n", maxIter)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, abs); err == nil {
+		return rel
 	}
-	fmt.Println()
+	return path
+}
 
-	// Check harness availability
-	h := harness.NewOpenCodeHarness()
-	if !h.IsAvailable() {
-		fmt.Printf("❌ %s is not installed or not in PATH\n", h.Name())
-		fmt.Println("   Install from: https://github.com/EmbeddedLLM/opencode")
-		os.Exit(1)
+// loadConfig reads the config layers (global, project, TATSU_* variables)
+// and applies the command-line overrides.
+func loadConfig(opts runFlags) (*config.Config, error) {
+	l, err := config.Resolve(opts.options())
+	if err != nil {
+		return nil, err
 	}
+	if len(l.Notes) > 0 {
+		fmt.Fprintln(out, "⚠️  Config written for an older version of tatsu (see tatsu config validate):")
+		for _, note := range l.Notes {
+			fmt.Fprintf(out, "   %s\n", note)
+		}
+	}
+	for _, warning := range l.Warnings {
+		fmt.Fprintf(out, "⚠️  %s\n", warning)
+	}
+	return l.Config()
+}
 
-	fmt.Printf("✅ %s is available\n\n", h.Name())
+// profileLoader loads the config with another profile, for PRD tasks that
+// ask for one.
+func profileLoader(opts runFlags) runner.ProfileLoader {
+	return func(name string) (*config.Config, error) {
+		o := opts.options()
+		o.Profile = name
+		return config.LoadWith(o)
+	}
+}
 
-	// Run task with runner
-	r := runner.NewWithMaxIterations(cfg, h, maxIter)
-	if err := r.Run(task); err != nil {
-		fmt.Printf("⚠️  %v\n", err)
-		os.Exit(1)
+// maxIterations is the iteration budget of cfg: max_iterations, or the
+// runner's default.
+func maxIterations(cfg *config.Config) int {
+	if cfg.MaxIterations > 0 {
+		return cfg.MaxIterations
 	}
+	return runner.DefaultMaxIterations
 }
 
 func generateConfig(force bool) {
 	if force {
-		fmt.Println("🔧 Generating tatsu.yaml (overwriting existing file)...")
+		fmt.Fprintln(out, "🔧 Generating tatsu.yaml (overwriting existing file)...")
 	} else {
-		fmt.Println("🔧 Generating tatsu.yaml...")
+		fmt.Fprintln(out, "🔧 Generating tatsu.yaml...")
 	}
 
 	if err := config.Generate(force); err != nil {
-		fmt.Printf("❌ %v\n", err)
-		os.Exit(1)
+		fatal(exitFailure, "%v", err)
 	}
 
-	fmt.Println("✅ Created tatsu.yaml")
-	fmt.Println("\n📝 Review and update the configuration as needed:")
-	fmt.Println("   - agent.command: Your AI agent command")
-	fmt.Println("   - validate.command: Your test/validation command")
+	fmt.Fprintln(out, "✅ Created tatsu.yaml")
+	fmt.Fprintln(out, "\n📝 Review and update the configuration as needed:")
+	fmt.Fprintln(out, "   - agent.command: Your AI agent command")
+	fmt.Fprintln(out, "   - validate: The detected test and lint commands (see the comments)")
 }
 
-func runPRD(prdFile string, maxIter int) {
-	fmt.Printf("📄 Loading PRD: %s\n\n", prdFile)
+func runPRD(prdFile string, opts runFlags) {
+	fmt.Fprintf(out, "📄 Loading PRD: %s\n\n", prdFile)
 
-	// Check if config exists, generate if not
-	if _, err := os.Stat("tatsu.yaml"); os.IsNotExist(err) {
-		fmt.Println("📝 No tatsu.yaml found. Generating configuration...")
-		if err := config.Generate(false); err != nil {
-			fmt.Printf("❌ Failed to generate config: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Println("✅ Created tatsu.yaml")
-		fmt.Println("   (Run 'tatsu generate --force' to regenerate)")
+	// Find the project config, generate one if there is none; the PRD
+	// path stays relative to where tatsu was started
+	abs, absErr := filepath.Abs(prdFile)
+	findConfig(true)
+	if absErr == nil {
+		prdFile = relativePath(abs)
 	}
 
 	// Load config
-	cfg, err := config.Load()
+	cfg, err := loadConfig(opts)
 	if err != nil {
-		fmt.Printf("❌ %v\n", err)
-		os.Exit(1)
+		fatal(exitConfig, "%v", err)
 	}
 
 	// Check harness availability
-	h := harness.NewOpenCodeHarness()
-	if !h.IsAvailable() {
-		fmt.Printf("❌ %s is not installed or not in PATH\n", h.Name())
-		fmt.Println("   Install from: https://github.com/EmbeddedLLM/opencode")
-		os.Exit(1)
-	}
+	h := newHarness(cfg)
 
 	// Load PRD
 	prdDoc, err := prd.LoadPRD(prdFile)
 	if err != nil {
-		fmt.Printf("❌ Failed to load PRD: %v\n", err)
-		os.Exit(1)
+		fatal(exitFailure, "Failed to load PRD: %v", err)
 	}
 
 	// Execute PRD
-	r := runner.NewWithMaxIterations(cfg, h, maxIter)
+	ctx, stop := signalContext()
+	defer stop()
+	r := runner.NewWithMaxIterations(cfg, h, maxIterations(cfg))
+	r.SetConfirm(confirmOnTerminal)
+	r.SetProfiles(profileLoader(opts))
+	subscribeOutput(r)
+	j := recordRun(r, cfg)
 	executor := prd.NewExecutor(r)
-	if err := executor.ExecutePRD(prdDoc, prdFile); err != nil {
-		fmt.Printf("⚠️  %v\n", err)
-		os.Exit(1)
+	err = executor.ExecutePRD(ctx, prdDoc, prdFile)
+	closeJournal(j)
+	if err != nil {
+		fmt.Fprintf(out, "⚠️  %v\n", err)
+		stop()
+		os.Exit(exitCode(err))
 	}
 }
 
-func printUsage() {
-	fmt.Println("tatsu v" + Version)
-	fmt.Println("\nUsage:")
-	fmt.Println("  tatsu                          Open TUI (Tab to switch Task / PRD)")
-	fmt.Println("  tatsu run \"task description\"  Run a task")
-	fmt.Println("  tatsu prd <file>                Execute tasks from PRD file")
-	fmt.Println("  tatsu generate [--force]       Generate tatsu.yaml")
-	fmt.Println("  tatsu version                  Show version")
-	fmt.Println("\nFlags:")
-	fmt.Printf("  -max-iterations N              Maximum retry iterations (default: %d, max: %d)\n", runner.DefaultMaxIterations, maxIterationsLimit)
-	fmt.Println("\nExamples:")
-	fmt.Println("  tatsu run \"add unit tests to the parser\"")
-	fmt.Println("  tatsu run -max-iterations 5 \"quick test\"")
-	fmt.Println("  tatsu prd PRD.example.md")
-	fmt.Println("  tatsu prd -max-iterations 10 PRD.example.md")
-	fmt.Println("  tatsu generate")
-	fmt.Println("  tatsu generate --force")
-	fmt.Println("\nNote: tatsu.yaml will be auto-generated on first run if it doesn't exist")
+// runResume continues an interrupted run (the latest one if runID is empty)
+// with the config, iteration budget and validation feedback it was recorded
+// with.
+func runResume(runID string) {
+	// Runs are recorded in the project directory
+	enterProject()
+	if runID == "" {
+		m, err := journal.LatestResumable("")
+		if err != nil {
+			fatal(exitFailure, "%v", err)
+		}
+		runID = m.ID
+	}
+	dir, err := filepath.Abs(filepath.Join(journal.DefaultDir, runID))
+	if err != nil {
+		fatal(exitFailure, "%v", err)
+	}
+
+	m, state, err := journal.Resume(dir)
+	if err != nil {
+		fatal(exitFailure, "%v", err)
+	}
+	if m.PRD == "" && m.Task == "" && state.Title == "" {
+		fatal(exitFailure, "Run %s stopped before its task was recorded", m.ID)
+	}
+	// The agent, validation and PRD path work relative to where the run
+	// was started
+	if m.Dir != "" {
+		if _, err := os.Stat(m.Dir); err != nil {
+			fmt.Fprintf(out, "⚠️  Run %s was started in %s, which is gone; resuming in the current directory\n", m.ID, m.Dir)
+		} else if err := os.Chdir(m.Dir); err != nil {
+			fatal(exitFailure, "Error: %v", err)
+		}
+	}
+	cfg, err := config.Parse([]byte(m.Config))
+	if err != nil {
+		fatal(exitConfig, "Saved config of run %s: %v", m.ID, err)
+	}
+	// The snapshot does not keep secret agent.env.set values; take them
+	// from the config as it is now
+	current, err := config.Load()
+	if err != nil {
+		current = &config.Config{}
+	}
+	restoreSecrets := func(cfg *config.Config) {
+		if missing := cfg.Agent.Env.Restore(current.Agent.Env); len(missing) > 0 {
+			fmt.Fprintf(out, "⚠️  agent.env.set no longer sets %s; resuming with them redacted\n", strings.Join(missing, ", "))
+		}
+	}
+	restoreSecrets(cfg)
+	maxIter := cfg.MaxIterations
+	if maxIter == 0 {
+		maxIter = m.MaxIterations // runs recorded before max_iterations
+	}
+	if maxIter == 0 {
+		maxIter = runner.DefaultMaxIterations
+	}
+
+	fmt.Fprintf(out, "⏯️  Resuming run %s\n", m.ID)
+	if m.PRD != "" {
+		fmt.Fprintf(out, "   PRD: %s\n", m.PRD)
+	}
+	if state.Title != "" {
+		fmt.Fprintf(out, "   Task %d: %s\n", state.Task, state.Title)
+	}
+	fmt.Fprintf(out, "   Iterations done: %d/%d\n\n", state.Iteration, maxIter)
+
+	h := newHarness(cfg)
+
+	var prdDoc *prd.PRD
+	if m.PRD != "" {
+		if prdDoc, err = prd.LoadPRD(m.PRD); err != nil {
+			fatal(exitFailure, "Failed to load PRD: %v", err)
+		}
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	r := runner.NewWithMaxIterations(cfg, h, maxIter)
+	r.Resume(state)
+	r.SetConfirm(confirmOnTerminal)
+	r.SetProfiles(func(name string) (*config.Config, error) {
+		cfg, err := config.ParseProfile([]byte(m.Config), name)
+		if err == nil {
+			restoreSecrets(cfg)
+		}
+		return cfg, err
+	})
+	subscribeOutput(r)
+	j, err := journal.Reopen(dir)
+	if err != nil {
+		fmt.Fprintf(out, "⚠️  Run journal disabled: %v\n", err)
+	} else {
+		r.Subscribe(j)
+	}
+	if prdDoc != nil {
+		err = prd.NewExecutor(r).ExecutePRD(ctx, prdDoc, m.PRD)
+	} else {
+		err = r.Run(ctx, m.Task)
+	}
+	closeJournal(j)
+	if err != nil {
+		fmt.Fprintf(out, "⚠️  %v\n", err)
+		stop()
+		os.Exit(exitCode(err))
+	}
+}
+
+// showConfig prints the config merged from all layers, and with origin the
+// source of each value.
+func showConfig(opts runFlags, origin bool) {
+	l, err := config.Resolve(opts.options())
+	if err != nil {
+		fatal(exitConfig, "%v", err)
+	}
+	data, err := l.YAML(origin)
+	if err != nil {
+		fatal(exitFailure, "%v", err)
+	}
+	if origin {
+		fmt.Println("# Config files, lowest precedence first:")
+		for _, file := range l.Files {
+			fmt.Printf("#   %s\n", file)
+		}
+		fmt.Println("# then TATSU_* environment variables and flags")
+	}
+	os.Stdout.Write(data)
+	for _, warning := range l.Warnings {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n", warning)
+	}
+	if _, err := l.Config(); err != nil {
+		fatal(exitConfig, "Invalid config:\n   %s", strings.ReplaceAll(err.Error(), "\n", "\n   "))
+	}
+}
+
+// validateConfig checks the config layers, including every profile, and
+// lists each problem or migrated key.
+func validateConfig(opts runFlags) {
+	l, err := config.Resolve(opts.options())
+	if err == nil {
+		_, err = l.Config()
+	}
+	if err != nil {
+		fatal(exitConfig, "Invalid config:\n   %s", strings.ReplaceAll(err.Error(), "\n", "\n   "))
+	}
+	for _, note := range l.Notes {
+		fmt.Printf("⚠️  %s\n", note)
+	}
+	if len(l.Notes) > 0 {
+		fmt.Printf("   Move these keys and set version: %d to use the current format.\n", config.CurrentVersion)
+	}
+	for _, warning := range l.Warnings {
+		fmt.Printf("⚠️  %s\n", warning)
+	}
+	fmt.Printf("✅ Config is valid: %s\n", strings.Join(l.Files, ", "))
+	if profiles := l.Profiles(); len(profiles) > 0 {
+		fmt.Printf("   Profiles: %s\n", strings.Join(profiles, ", "))
+	}
+}
+
+// printSchema prints the JSON Schema of tatsu.yaml.
+func printSchema() {
+	data, err := config.JSONSchema()
+	if err != nil {
+		fatal(exitFailure, "%v", err)
+	}
+	os.Stdout.Write(data)
+}
+
+// runCheckpoints lists checkpoints (optionally for one run) or restores one.
+func runCheckpoints(args []string) {
+	ctx := context.Background()
+	repo, err := checkpoint.Open(".")
+	if err != nil {
+		fatal(exitFailure, "%v", err)
+	}
+
+	sub := "list"
+	if len(args) > 0 {
+		sub = args[0]
+		args = args[1:]
+	}
+
+	switch sub {
+	case "list", "ls":
+		prefix := ""
+		if len(args) > 0 {
+			prefix = strings.TrimSuffix(args[0], "/") + "/"
+		}
+		checkpoints, err := repo.List(ctx, prefix)
+		if err != nil {
+			fatal(exitFailure, "%v", err)
+		}
+		if len(checkpoints) == 0 {
+			fmt.Fprintln(out, "No checkpoints found. Enable them with git.checkpoints: true in tatsu.yaml")
+			return
+		}
+		for _, cp := range checkpoints {
+			fmt.Fprintf(out, "%s  %s  %s  %s\n", cp.Name, cp.SHA[:8], cp.Created.Format("2006-01-02 15:04:05"), cp.Message)
+		}
+	case "restore":
+		if len(args) < 1 {
+			fatal(exitUsage, "Error: checkpoint name required (see 'tatsu checkpoints list')")
+		}
+		if err := repo.Restore(ctx, args[0]); err != nil {
+			fatal(exitFailure, "%v", err)
+		}
+		fmt.Fprintf(out, "✅ Restored working tree to checkpoint %s\n", args[0])
+	default:
+		printCommandHelp(findCommand("checkpoints"))
+		fatal(exitUsage, "Unknown checkpoints command: %s", sub)
+	}
+}
+
+// confirmOnTerminal asks a yes/no question on the terminal. Without a
+// terminal on stdin (CI, pipes) the answer is no.
+func confirmOnTerminal(ctx context.Context, question string) bool {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	fmt.Fprintf(out, "❓ %s [y/N] ", question)
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer <- line
+	}()
+	select {
+	case line := <-answer:
+		line = strings.ToLower(strings.TrimSpace(line))
+		return line == "y" || line == "yes"
+	case <-ctx.Done():
+		fmt.Fprintln(out)
+		return false
+	}
+}
+
+// signalContext returns a context cancelled on SIGINT/SIGTERM so running
+// agent and validation process groups are killed before tatsu exits.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// exitCode maps a run error to the process exit status.
+func exitCode(err error) int {
+	var stall *runner.StallError
+	switch {
+	case runner.IsTimeout(err):
+		return exitTimeout
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, runner.ErrMaxIterations), errors.As(err, &stall):
+		return exitMaxIterations
+	default:
+		return exitFailure
+	}
+}
+
+// fatal reports an error that stops tatsu before or outside a run and exits
+// with code: a ❌ line, or an error event with -output json.
+func fatal(code int, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if jsonOut != nil {
+		jsonOut.Error(msg, code)
+	} else {
+		fmt.Fprintf(out, "❌ %s\n", msg)
+	}
+	os.Exit(code)
 }
@@ -1,6 +1,7 @@
 package prd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/jack/tatsu/runner"
@@ -20,38 +21,55 @@ func NewExecutor(r *runner.Runner) *Executor {
 
 // ExecutePRD executes all incomplete tasks from a PRD sequentially.
 // If filename is non-empty, the PRD file is updated to mark each task complete as it succeeds.
-func (e *Executor) ExecutePRD(prd *PRD, filename string) error {
-	incomplete := prd.IncompleteTasks()
+// Cancelling ctx stops the current task and kills its child processes.
+// Progress is reported through the runner's event sinks.
+func (e *Executor) ExecutePRD(ctx context.Context, prd *PRD, filename string) error {
+	err := e.execute(ctx, prd, filename)
+	e.runner.Emit(runner.RunComplete{Err: err})
+	return err
+}
 
-	if len(incomplete) == 0 {
-		fmt.Println("✅ All tasks are already completed!")
-		return nil
-	}
+func (e *Executor) execute(ctx context.Context, prd *PRD, filename string) error {
+	incomplete := prd.IncompleteTasks()
 
-	fmt.Printf("📋 PRD Summary:\n")
-	fmt.Printf("   Total tasks: %d\n", prd.TotalCount())
-	fmt.Printf("   Completed: %d\n", prd.CompletedCount())
-	fmt.Printf("   Remaining: %d\n\n", len(incomplete))
+	e.runner.Emit(runner.RunStart{
+		PRD:       prdName(filename),
+		Profile:   e.runner.Profile(),
+		Total:     prd.TotalCount(),
+		Completed: prd.CompletedCount(),
+		Pending:   len(incomplete),
+	})
 
 	// Execute each incomplete task
 	for i, task := range incomplete {
-		fmt.Printf("📌 Task %d/%d: %s\n\n", i+1, len(incomplete), task.Title)
+		profile := task.Profile
+		if profile == "" {
+			profile = e.runner.Profile()
+		}
+		e.runner.Emit(runner.TaskStart{Index: i + 1, Total: len(incomplete), Title: task.Title, Profile: profile})
 
 		// Execute task using runner
-		if err := e.runner.Run(task.Title); err != nil {
+		if err := e.runner.RunPRDTask(ctx, task.Title, runner.PRDContext{Title: prd.Title, Section: task.Section, Profile: task.Profile}); err != nil {
 			return fmt.Errorf("task '%s' failed: %w", task.Title, err)
 		}
 
-		// Mark task complete in PRD file
-		if filename != "" && task.LineNum > 0 {
+		// Mark task complete in PRD file, unless the agent was not run
+		// because validation already passed
+		if filename != "" && task.LineNum > 0 && !e.runner.TaskSkipped() {
 			if err := MarkTaskCompleteInFile(filename, task.LineNum); err != nil {
-				fmt.Printf("⚠️  Failed to update PRD file: %v\n", err)
+				e.runner.Emit(runner.Warning{Message: fmt.Sprintf("Failed to update PRD file: %v", err)})
 			}
 		}
-
-		fmt.Println()
 	}
 
-	fmt.Println("✅ All PRD tasks completed successfully!")
 	return nil
 }
+
+// prdName is the PRD identifier reported in RunStart; in-memory PRDs (no
+// file) still need a non-empty name so sinks know this is a PRD run.
+func prdName(filename string) string {
+	if filename == "" {
+		return "(in-memory)"
+	}
+	return filename
+}
@@ -1,10 +1,13 @@
 package prd
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/harness"
 	"github.com/jack/tatsu/runner"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -28,14 +31,22 @@ func quietTest(t *testing.T, fn func()) {
 	fn()
 }
 
-type mockHarness struct{}
+// mockHarness runs agent.command like the custom harness but is always
+// available.
+type mockHarness struct {
+	*harness.Custom
+}
+
+func newMockHarness(cfg *config.Config) *mockHarness {
+	return &mockHarness{harness.NewCustom(cfg)}
+}
 
 func (m *mockHarness) Name() string      { return "MockHarness" }
 func (m *mockHarness) IsAvailable() bool { return true }
 
 func TestNewExecutor(t *testing.T) {
 	cfg := &config.Config{}
-	h := &mockHarness{}
+	h := newMockHarness(cfg)
 	r := runner.New(cfg, h)
 
 	executor := NewExecutor(r)
@@ -48,7 +59,7 @@ func TestExecutePRD_AllCompleted(t *testing.T) {
 	cfg.Agent.Command = "echo 'Agent: %s' >/dev/null"
 	cfg.Validate.Command = "exit 0"
 
-	r := runner.New(cfg, &mockHarness{})
+	r := runner.New(cfg, newMockHarness(cfg))
 	executor := NewExecutor(r)
 
 	prd := &PRD{
@@ -60,7 +71,7 @@ func TestExecutePRD_AllCompleted(t *testing.T) {
 
 	var err error
 	quietTest(t, func() {
-		err = executor.ExecutePRD(prd, "")
+		err = executor.ExecutePRD(context.Background(), prd, "")
 	})
 	require.NoError(t, err)
 }
@@ -70,7 +81,7 @@ func TestExecutePRD_ExecuteIncompleteTasks(t *testing.T) {
 	cfg.Agent.Command = "echo 'Agent: %s' >/dev/null"
 	cfg.Validate.Command = "exit 0" // Always pass validation
 
-	r := runner.New(cfg, &mockHarness{})
+	r := runner.New(cfg, newMockHarness(cfg))
 	executor := NewExecutor(r)
 
 	prd := &PRD{
@@ -83,7 +94,7 @@ func TestExecutePRD_ExecuteIncompleteTasks(t *testing.T) {
 
 	var err error
 	quietTest(t, func() {
-		err = executor.ExecutePRD(prd, "")
+		err = executor.ExecutePRD(context.Background(), prd, "")
 	})
 	require.NoError(t, err)
 }
@@ -93,7 +104,7 @@ func TestExecutePRD_SkipsCompletedTasks(t *testing.T) {
 	cfg.Agent.Command = "echo 'Agent: %s' >/dev/null"
 	cfg.Validate.Command = "exit 0"
 
-	r := runner.New(cfg, &mockHarness{})
+	r := runner.New(cfg, newMockHarness(cfg))
 	executor := NewExecutor(r)
 
 	prd := &PRD{
@@ -108,7 +119,7 @@ func TestExecutePRD_SkipsCompletedTasks(t *testing.T) {
 	// Should only execute task 2 and task 4
 	var err error
 	quietTest(t, func() {
-		err = executor.ExecutePRD(prd, "")
+		err = executor.ExecutePRD(context.Background(), prd, "")
 	})
 	require.NoError(t, err)
 }
@@ -118,7 +129,7 @@ func TestExecutePRD_TaskFailure(t *testing.T) {
 	cfg.Agent.Command = "echo 'Agent: %s' >/dev/null"
 	cfg.Validate.Command = "exit 1" // Always fail validation
 
-	r := runner.New(cfg, &mockHarness{})
+	r := runner.New(cfg, newMockHarness(cfg))
 	executor := NewExecutor(r)
 
 	prd := &PRD{
@@ -130,9 +141,102 @@ func TestExecutePRD_TaskFailure(t *testing.T) {
 	// Should return error after max iterations
 	var err error
 	quietTest(t, func() {
-		err = executor.ExecutePRD(prd, "")
+		err = executor.ExecutePRD(context.Background(), prd, "")
 	})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "failing task")
 	assert.Contains(t, err.Error(), "failed")
 }
+
+func TestExecutePRD_EmitsTaskEvents(t *testing.T) {
+	cfg := &config.Config{Profile: "fast"}
+	cfg.Agent.Command = "echo 'Agent: %s' >/dev/null"
+	cfg.Validate.Command = "exit 0"
+
+	r := runner.New(cfg, newMockHarness(cfg))
+	var starts []runner.TaskStart
+	var runStart runner.RunStart
+	var completes int
+	r.Subscribe(runner.SinkFunc(func(e runner.Event) {
+		switch e := e.(type) {
+		case runner.RunStart:
+			runStart = e
+		case runner.TaskStart:
+			starts = append(starts, e)
+		case runner.RunComplete:
+			completes++
+			assert.NoError(t, e.Err)
+		}
+	}))
+
+	prd := &PRD{
+		Tasks: []Task{
+			{Title: "done", Completed: true},
+			{Title: "first", Completed: false},
+			{Title: "second", Completed: false},
+		},
+	}
+
+	require.NoError(t, NewExecutor(r).ExecutePRD(context.Background(), prd, ""))
+	assert.Equal(t, 3, runStart.Total)
+	assert.Equal(t, 1, runStart.Completed)
+	assert.Equal(t, 2, runStart.Pending)
+	assert.Equal(t, "fast", runStart.Profile)
+	assert.Equal(t, []runner.TaskStart{
+		{Index: 1, Total: 2, Title: "first", Profile: "fast"},
+		{Index: 2, Total: 2, Title: "second", Profile: "fast"},
+	}, starts)
+	assert.Equal(t, 1, completes)
+}
+
+func TestExecutePRD_PRDContextInPrompt(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "true %s"
+	cfg.Agent.Prompt = "{{.PRDTitle}} / {{.PRDSection}}: {{.Task}}"
+	cfg.Validate.Command = "exit 0"
+
+	r := runner.New(cfg, newMockHarness(cfg))
+	var prompts []string
+	r.Subscribe(runner.SinkFunc(func(e runner.Event) {
+		if e, ok := e.(runner.IterationStart); ok {
+			prompts = append(prompts, e.Prompt)
+		}
+	}))
+
+	prd, err := ParseMarkdown("# Shop\n## Cart\n- [ ] show totals\n")
+	require.NoError(t, err)
+	require.NoError(t, NewExecutor(r).ExecutePRD(context.Background(), prd, ""))
+	assert.Equal(t, []string{"Shop / Cart: show totals"}, prompts)
+}
+
+func TestExecutePRD_LeavesSkippedTasksUnchecked(t *testing.T) {
+	dir := t.TempDir()
+	done := filepath.Join(dir, "done")
+	cfg := &config.Config{}
+	cfg.Agent.Command = "touch " + done + " # %s"
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Validate.Command = "test -f " + done
+	cfg.Validate.Baseline = config.Baseline{Enabled: true, IfPassing: config.IfPassingSkip}
+
+	filename := filepath.Join(dir, "PRD.md")
+	require.NoError(t, os.WriteFile(filename, []byte("# Tasks\n- [ ] make it\n- [ ] already made\n"), 0644))
+	prd, err := LoadPRD(filename)
+	require.NoError(t, err)
+
+	r := runner.New(cfg, newMockHarness(cfg))
+	var completes []runner.TaskComplete
+	r.Subscribe(runner.SinkFunc(func(e runner.Event) {
+		if e, ok := e.(runner.TaskComplete); ok {
+			completes = append(completes, e)
+		}
+	}))
+	require.NoError(t, NewExecutor(r).ExecutePRD(context.Background(), prd, filename))
+
+	assert.Equal(t, []runner.TaskComplete{
+		{Title: "make it", Iterations: 1},
+		{Title: "already made", Skipped: true},
+	}, completes)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "# Tasks\n- [x] make it\n- [ ] already made\n", string(data), "only the task the agent did is ticked")
+}
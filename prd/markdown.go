@@ -15,14 +15,32 @@ const (
 var (
 	// taskListItemRegex matches markdown task list items: "- [ ] task" or "- [x] task"
 	taskListItemRegex = regexp.MustCompile(`^[\s]*[-*+][\s]+\[([\sxX])\][\s]+(.+)$`)
+	// headingRegex matches ATX headings: "# Title", "## Section ##"
+	headingRegex = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+	// profileRegex matches a "[profile: name]" annotation ending a task
+	profileRegex = regexp.MustCompile(`\s*\[profile:\s*([\w.-]+)\s*\]\s*$`)
 )
 
 // ParseMarkdown parses a markdown PRD file and returns a PRD struct
 func ParseMarkdown(content string) (*PRD, error) {
 	lines := strings.Split(content, "\n")
 	var tasks []Task
+	var title, section string
+	inFence := false
 
 	for i, line := range lines {
+		// "# comment" lines in code blocks are not headings
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if heading := headingRegex.FindStringSubmatch(line); heading != nil && !inFence {
+			if title == "" && heading[1] == "#" {
+				title = heading[2]
+			}
+			section = heading[2]
+			continue
+		}
+
 		matches := taskListItemRegex.FindStringSubmatch(line)
 		if matches == nil {
 			continue
@@ -32,6 +50,11 @@ func ParseMarkdown(content string) (*PRD, error) {
 		// matches[2] is the task title
 		checkbox := strings.TrimSpace(matches[1])
 		title := strings.TrimSpace(matches[2])
+		profile := ""
+		if m := profileRegex.FindStringSubmatchIndex(title); m != nil {
+			profile = title[m[2]:m[3]]
+			title = title[:m[0]]
+		}
 
 		// Skip if title is empty
 		if title == "" {
@@ -45,6 +68,8 @@ func ParseMarkdown(content string) (*PRD, error) {
 			Title:     title,
 			Completed: completed,
 			LineNum:   i + 1,
+			Section:   section,
+			Profile:   profile,
 		})
 	}
 
@@ -53,6 +78,7 @@ func ParseMarkdown(content string) (*PRD, error) {
 	}
 
 	prd := &PRD{
+		Title: title,
 		Tasks: tasks,
 	}
 
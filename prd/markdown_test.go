@@ -120,6 +120,50 @@ Some other content here.
 	assert.Equal(t, "first task", prd.Tasks[0].Title)
 }
 
+func TestParseMarkdown_Profile(t *testing.T) {
+	content := `- [ ] quick fix [profile: fast]
+- [ ] full rewrite [profile:thorough-2]
+- [ ] mentions [profile: x] mid-title
+`
+
+	prd, err := ParseMarkdown(content)
+	require.NoError(t, err)
+	require.Len(t, prd.Tasks, 3)
+	assert.Equal(t, "quick fix", prd.Tasks[0].Title)
+	assert.Equal(t, "fast", prd.Tasks[0].Profile)
+	assert.Equal(t, "full rewrite", prd.Tasks[1].Title)
+	assert.Equal(t, "thorough-2", prd.Tasks[1].Profile)
+	assert.Equal(t, "mentions [profile: x] mid-title", prd.Tasks[2].Title)
+	assert.Empty(t, prd.Tasks[2].Profile)
+}
+
+func TestParseMarkdown_TitleAndSections(t *testing.T) {
+	content := `- [ ] before any heading
+# Checkout Redesign
+
+## Cart ##
+- [ ] show totals
+
+` + "```sh" + `
+# not a heading
+` + "```" + `
+- [ ] keep items
+
+### Payment
+- [ ] add card form
+`
+
+	prd, err := ParseMarkdown(content)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Checkout Redesign", prd.Title)
+	require.Len(t, prd.Tasks, 4)
+	assert.Empty(t, prd.Tasks[0].Section)
+	assert.Equal(t, "Cart", prd.Tasks[1].Section)
+	assert.Equal(t, "Cart", prd.Tasks[2].Section)
+	assert.Equal(t, "Payment", prd.Tasks[3].Section)
+}
+
 func TestMarkTaskCompleteInFile(t *testing.T) {
 	dir := t.TempDir()
 	filename := filepath.Join(dir, "prd.md")
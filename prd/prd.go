@@ -6,11 +6,14 @@ import "fmt"
 type Task struct {
 	Title     string
 	Completed bool
-	LineNum   int // 1-based line number in file (0 if unknown)
+	LineNum   int    // 1-based line number in file (0 if unknown)
+	Section   string // nearest heading above the task, if any
+	Profile   string // profile from a [profile: name] annotation, if any
 }
 
 // PRD represents a Product Requirements Document containing tasks
 type PRD struct {
+	Title string // first top-level heading, if any
 	Tasks []Task
 }
 
@@ -0,0 +1,151 @@
+package proc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitArgs splits a command line into words the way a POSIX shell would,
+// honouring single quotes, double quotes and backslash escapes, but without
+// expanding anything: `$HOME`, `$(...)`, globs and backticks stay literal.
+func SplitArgs(command string) ([]string, error) {
+	var (
+		args   []string
+		word   strings.Builder
+		inWord bool
+		quote  rune // 0, '\'' or '"'
+		escape bool
+	)
+	for _, r := range command {
+		switch {
+		case escape:
+			// Inside double quotes a backslash only escapes these
+			if quote == '"' && !strings.ContainsRune("\"\\$`\n", r) {
+				word.WriteRune('\\')
+			}
+			if r != '\n' { // backslash-newline continues the line
+				word.WriteRune(r)
+			}
+			escape = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escape, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, command)
+	}
+	if escape {
+		return nil, fmt.Errorf("trailing backslash in %q", command)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// ShellSyntax returns the first part of command that only a shell
+// understands, or "" if SplitArgs reads it the way a shell would run it:
+// an unquoted operator (| & ; < > ( )), an expansion ($ or ` outside
+// single quotes), a comment or ~ at the start of a word, a leading
+// VAR=value assignment, or a shell builtin as the program.
+func ShellSyntax(command string) string {
+	var (
+		quote     rune
+		escape    bool
+		wordStart = true
+	)
+	for _, r := range command {
+		literal := escape || quote != 0
+		switch {
+		case escape:
+			escape = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			}
+		case r == '\\':
+			escape = true
+		case r == '$' || r == '`':
+			return string(r)
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case strings.ContainsRune("|&;<>()", r):
+			return string(r)
+		case wordStart && (r == '#' || r == '~'):
+			return string(r)
+		}
+		wordStart = !literal && (r == ' ' || r == '\t' || r == '\n')
+	}
+	args, err := SplitArgs(command)
+	if err != nil || len(args) == 0 {
+		return ""
+	}
+	if name, _, ok := strings.Cut(args[0], "="); ok && isName(name) {
+		return args[0]
+	}
+	if IsBuiltin(args[0]) {
+		return args[0]
+	}
+	return ""
+}
+
+// IsBuiltin reports whether name is a shell builtin or keyword rather than
+// a program on PATH.
+func IsBuiltin(name string) bool {
+	switch name {
+	case "cd", "export", "source", ".", "exec", "eval", "set", "unset", "alias", "if", "for", "while", "case", "!", "(", "{":
+		return true
+	}
+	return false
+}
+
+// isName reports whether s is a shell variable name.
+func isName(s string) bool {
+	for i, r := range s {
+		if r != '_' && !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || i > 0 && '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// JoinArgs is the inverse of SplitArgs: it joins args into a command line,
+// single-quoting the ones that need it.
+func JoinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]{}~#!") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
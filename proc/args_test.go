@@ -0,0 +1,69 @@
+package proc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected []string
+	}{
+		{`opencode run "%s"`, []string{"opencode", "run", "%s"}},
+		{`  aider   --message  %s `, []string{"aider", "--message", "%s"}},
+		{`echo 'a "b" $c' "d 'e' \"f\" \$g \x"`, []string{"echo", `a "b" $c`, `d 'e' "f" $g \x`}},
+		{`echo $(rm -rf /) ` + "`id`", []string{"echo", "$(rm", "-rf", "/)", "`id`"}},
+		{`echo a\ b "" ''`, []string{"echo", "a b", "", ""}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		args, err := SplitArgs(tt.command)
+		require.NoError(t, err, tt.command)
+		assert.Equal(t, tt.expected, args, tt.command)
+	}
+}
+
+func TestSplitArgs_Errors(t *testing.T) {
+	for _, command := range []string{`echo "unterminated`, `echo 'x`, `echo \`} {
+		_, err := SplitArgs(command)
+		assert.Error(t, err, command)
+	}
+}
+
+func TestShellSyntax(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{`opencode run "%s"`, ""},
+		{`aider --message '%s' --model "gpt-4o" a\ b`, ""},
+		{`echo 'a | b; $c' "d#e" x#y`, ""},
+		{`FOO=1 echo "%s"`, "FOO=1"},
+		{`cd /tmp && echo "%s"`, "&"},
+		{`cd /tmp`, "cd"},
+		{`echo "%s" 2>&1 | cat`, ">"},
+		{`echo "%s"; true`, ";"},
+		{`echo "$HOME/%s"`, "$"},
+		{"echo `id` %s", "`"},
+		{`agent %s # note`, "#"},
+		{`~/bin/agent %s`, "~"},
+		{`echo \$HOME \| %s`, ""},
+		{``, ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, ShellSyntax(tt.command), tt.command)
+	}
+}
+
+func TestJoinArgs(t *testing.T) {
+	args := []string{"aider", "--message", "it's $HOME", ""}
+	line := JoinArgs(args)
+	assert.Equal(t, `aider --message 'it'\''s $HOME' ''`, line)
+
+	split, err := SplitArgs(line)
+	require.NoError(t, err)
+	assert.Equal(t, args, split)
+}
@@ -0,0 +1,42 @@
+// Package proc starts child processes that can be cancelled as a unit.
+package proc
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// WaitDelay bounds how long Wait blocks on I/O after the process group has
+// been killed (e.g. a grandchild that inherited stdout and ignored the signal).
+const WaitDelay = 5 * time.Second
+
+// Command is like exec.CommandContext, but the child is started in its own
+// process group and cancelling ctx kills the whole group, not just the direct
+// child. Agents and test runners spawn subprocesses that would otherwise
+// survive a timeout or a quit.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	c := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(c)
+	c.WaitDelay = WaitDelay
+	return c
+}
+
+// Shell runs command with bash -c via Command.
+func Shell(ctx context.Context, command string) *exec.Cmd {
+	return Command(ctx, "bash", "-c", command)
+}
+
+// ExitCode extracts a process exit code from a Run/Wait error: 0 for nil,
+// -1 if the process never ran or was killed by a signal.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
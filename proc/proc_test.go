@@ -0,0 +1,46 @@
+package proc
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShell_Success(t *testing.T) {
+	out, err := Shell(context.Background(), "echo hello").Output()
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(out))
+}
+
+func TestShell_ExitCode(t *testing.T) {
+	err := Shell(context.Background(), "exit 3").Run()
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr))
+	assert.Equal(t, 3, exitErr.ExitCode())
+	assert.Equal(t, 3, ExitCode(err))
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, -1, ExitCode(errors.New("not started")))
+}
+
+func TestShell_TimeoutKillsProcessGroup(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "survived")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// The grandchild would create the marker if it outlived the timeout
+	start := time.Now()
+	err := Shell(ctx, "(sleep 1 && touch "+marker+") & wait").Run()
+	require.Error(t, err)
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	time.Sleep(1200 * time.Millisecond)
+	assert.NoFileExists(t, marker)
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package proc
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error {
+		// Negative pid signals every process in the group
+		return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+	}
+}
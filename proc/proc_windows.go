@@ -0,0 +1,9 @@
+//go:build windows
+
+package proc
+
+import "os/exec"
+
+// Windows has no process groups in the POSIX sense; fall back to killing the
+// direct child (the exec.CommandContext default).
+func setProcessGroup(c *exec.Cmd) {}
@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/testresult"
+)
+
+// baseline runs validation before a task's first agent call, without the
+// usual events, when validate.baseline or validate.integrity asks for it.
+// Its test results are the reference for the integrity check, the known
+// failures and the first iteration's test progress. It reports whether the
+// task is already satisfied and should be skipped
+// (validate.baseline.if_passing), and emits Baseline.
+func (r *Runner) baseline(ctx context.Context, task string, resumed bool) (*ValidationResult, bool) {
+	b := r.config.Validate.Baseline
+	if !b.Enabled && !r.config.Validate.Integrity {
+		return nil, false
+	}
+	result := r.runValidation(ctx, func(Event) {})
+
+	skip := false
+	if b.Enabled && result.Success && !resumed && ctx.Err() == nil {
+		switch b.IfPassing {
+		case config.IfPassingSkip:
+			skip = true
+		case config.IfPassingAsk:
+			question := "Validation already passes before the task"
+			if line := result.TestSummary(); line != "" {
+				question += " (" + line + ")"
+			}
+			skip = !r.ask(ctx, question+". Run the agent anyway?")
+		}
+	}
+	r.setKnownFailures(result)
+	r.Emit(Baseline{Task: task, Result: result, Skipped: skip})
+	return &result, skip
+}
+
+// restoreBaseline takes the baseline of a resumed task from its journal
+// instead of running validation on the tree the agent already changed.
+func (r *Runner) restoreBaseline(result ValidationResult) *ValidationResult {
+	r.setKnownFailures(result)
+	return &result
+}
+
+// setKnownFailures remembers the tests that failed in the baseline, with
+// validate.baseline.known_failures other than fail.
+func (r *Runner) setKnownFailures(result ValidationResult) {
+	b := r.config.Validate.Baseline
+	if b.Enabled && b.KnownFailures != config.KnownFailuresFail && result.Report != nil {
+		r.knownFailures = make(map[string]bool)
+		for _, name := range result.Report.Names(testresult.Failed) {
+			r.knownFailures[name] = true
+		}
+	}
+}
+
+// onlyKnownFailures returns the failing tests of a failed validation if
+// every failure is a test that already failed in the baseline, sorted;
+// otherwise nil. A stage that failed without naming its failing tests
+// (build error, crash, timeout) is never a known failure.
+func (r *Runner) onlyKnownFailures(result ValidationResult) []string {
+	if len(r.knownFailures) == 0 || result.Success || result.Err != nil {
+		return nil
+	}
+	var names []string
+	for _, s := range result.Stages {
+		if s.Success || s.Skipped {
+			continue
+		}
+		if s.Report == nil || s.Report.Incomplete || s.Report.Failed == 0 || len(s.Report.Failing()) < s.Report.Failed {
+			return nil
+		}
+		for _, t := range s.Report.Failing() {
+			if !r.knownFailures[t.Name] {
+				return nil
+			}
+			names = append(names, t.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// knownFailureNote tells the agent which of the failing tests already
+// failed before the task, so it can focus on the ones it broke.
+func (r *Runner) knownFailureNote(result ValidationResult) string {
+	if result.Success || result.Report == nil {
+		return ""
+	}
+	var known []string
+	for _, t := range result.Report.Failing() {
+		if r.knownFailures[t.Name] {
+			known = append(known, t.Name)
+		}
+	}
+	if len(known) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nAlready failing before this task (not a regression, does not block it): %s\n", strings.Join(known, ", "))
+}
@@ -0,0 +1,129 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/testresult"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// passingConfig has validation pass before the agent runs; the agent
+// leaves a file behind when it is called.
+func passingConfig(ifPassing string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "touch agent-ran # %s"
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Validate.Command = "true"
+	cfg.Validate.Baseline = config.Baseline{Enabled: true, IfPassing: ifPassing}
+	return cfg
+}
+
+func TestRunner_BaselineSkipsSatisfiedTask(t *testing.T) {
+	inProject(t, func(dir string) {
+		cfg := passingConfig(config.IfPassingSkip)
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+		rec := &recorder{}
+		r.Subscribe(rec)
+
+		require.NoError(t, r.Run(context.Background(), "task"))
+		assert.NoFileExists(t, "agent-ran")
+		assert.NotContains(t, rec.kinds(), "IterationStart")
+		for _, e := range rec.events {
+			if e, ok := e.(Baseline); ok {
+				assert.True(t, e.Skipped)
+				assert.True(t, e.Result.Success)
+			}
+			if e, ok := e.(TaskComplete); ok {
+				assert.Equal(t, TaskComplete{Title: "task", Skipped: true}, e)
+			}
+		}
+	})
+}
+
+func TestRunner_BaselineAsks(t *testing.T) {
+	inProject(t, func(dir string) {
+		cfg := passingConfig(config.IfPassingAsk)
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+		require.NoError(t, r.Run(context.Background(), "task"))
+		assert.NoFileExists(t, "agent-ran", "without anyone to answer, the task is skipped")
+
+		var question string
+		r.SetConfirm(func(ctx context.Context, q string) bool {
+			question = q
+			return true
+		})
+		require.NoError(t, r.Run(context.Background(), "task"))
+		assert.FileExists(t, "agent-ran")
+		assert.Equal(t, "Validation already passes before the task. Run the agent anyway?", question)
+	})
+
+	inProject(t, func(dir string) {
+		cfg := passingConfig(config.IfPassingRun)
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+		require.NoError(t, r.Run(context.Background(), "task"))
+		assert.FileExists(t, "agent-ran")
+	})
+}
+
+// knownFailuresConfig validates with go test output the agent writes to
+// out.txt: TestA fails before the task, and the agent adds TestC with the
+// given status.
+func knownFailuresConfig(t *testing.T, knownFailures, status string) *config.Config {
+	t.Helper()
+	require.NoError(t, os.WriteFile("out.txt", []byte("--- FAIL: TestA (0.00s)\n--- PASS: TestB (0.00s)\nFAIL\n"), 0644))
+	cfg := &config.Config{}
+	cfg.Agent.Command = `printf -- '--- FAIL: TestA (0.00s)\n--- PASS: TestB (0.00s)\n--- ` + status + `: TestC (0.00s)\nFAIL\n' > out.txt # %s`
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Validate.Command = "cat out.txt; grep -q '^ok' out.txt"
+	cfg.Validate.Parser = testresult.FormatGo
+	cfg.Validate.Baseline = config.Baseline{Enabled: true, KnownFailures: knownFailures}
+	cfg.Patience = -1
+	return cfg
+}
+
+func TestRunner_BaselineKnownFailures(t *testing.T) {
+	inProject(t, func(dir string) {
+		cfg := knownFailuresConfig(t, config.KnownFailuresIgnore, "PASS")
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+		rec := &recorder{}
+		r.Subscribe(rec)
+
+		require.NoError(t, r.Run(context.Background(), "task"), "TestA failed before the task")
+		var results []ValidationResult
+		for _, e := range rec.events {
+			if e, ok := e.(ValidationResult); ok {
+				results = append(results, e)
+			}
+		}
+		require.Len(t, results, 1)
+		assert.True(t, results[0].Success)
+		assert.Equal(t, []string{"TestA"}, results[0].KnownFailures)
+	})
+
+	inProject(t, func(dir string) {
+		cfg := knownFailuresConfig(t, config.KnownFailuresIgnore, "FAIL")
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+		rec := &recorder{}
+		r.Subscribe(rec)
+
+		require.ErrorIs(t, r.Run(context.Background(), "task"), ErrMaxIterations, "TestC is a new failure")
+		var prompts []string
+		for _, e := range rec.events {
+			if e, ok := e.(IterationStart); ok {
+				prompts = append(prompts, e.Prompt)
+			}
+		}
+		require.Len(t, prompts, 2)
+		assert.Contains(t, prompts[1], "Already failing before this task (not a regression, does not block it): TestA")
+	})
+
+	inProject(t, func(dir string) {
+		cfg := knownFailuresConfig(t, config.KnownFailuresFail, "PASS")
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+		require.ErrorIs(t, r.Run(context.Background(), "task"), ErrMaxIterations)
+	})
+}
@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jack/tatsu/checkpoint"
+)
+
+// NewRunID returns a sortable, unique identifier for a run,
+// e.g. "20261017-153012-a1b2c3".
+func NewRunID() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// checkpointName is the name (ref suffix) of the snapshot taken before the
+// given iteration of the given task. Zero-padded so names sort naturally.
+func checkpointName(runID string, task, iteration int) string {
+	return fmt.Sprintf("%s/task-%02d/iter-%03d", runID, task, iteration)
+}
+
+// openCheckpoints opens the git repo for checkpointing if enabled. Failure
+// to open (e.g. not a git repo) disables checkpoints with a warning instead
+// of failing the run.
+func (r *Runner) openCheckpoints() {
+	if !r.config.Git.Checkpoints || r.repo != nil || r.repoErr != nil {
+		return
+	}
+	r.repo, r.repoErr = checkpoint.Open(".")
+	if r.repoErr != nil {
+		r.Emit(Warning{Message: fmt.Sprintf("git checkpoints disabled: %v", r.repoErr)})
+	}
+}
+
+// snapshot records the working tree before an agent call.
+func (r *Runner) snapshot(ctx context.Context, task string, iteration int) {
+	if r.repo == nil {
+		return
+	}
+	name := checkpointName(r.runID, r.taskNum, iteration)
+	msg := fmt.Sprintf("tatsu: before iteration %d/%d of %q", iteration, r.maxIterations, task)
+	sha, err := r.repo.Snapshot(ctx, name, msg)
+	if err != nil {
+		r.Emit(Warning{Message: fmt.Sprintf("checkpoint failed: %v", err)})
+		return
+	}
+	r.Emit(CheckpointCreated{Name: name, SHA: sha, Iteration: iteration})
+}
+
+// rollback restores the pre-task checkpoint after a failed task. A cancelled
+// run is left as is: the user stopped it and may want to inspect the tree.
+func (r *Runner) rollback(err error) {
+	if r.repo == nil || !r.config.Git.RollbackOnFailure || err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	name := checkpointName(r.runID, r.taskNum, 1)
+	// The task context may be past its deadline; the restore must still run
+	ctx := context.Background()
+	sha, resolveErr := r.repo.Resolve(ctx, name)
+	if resolveErr != nil {
+		// No agent call happened, so there is nothing to undo
+		return
+	}
+	r.Emit(RolledBack{Name: name, SHA: sha, Err: r.repo.Restore(ctx, name)})
+}
@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/jack/tatsu/checkpoint"
+	"github.com/jack/tatsu/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inGitRepo runs fn with the working directory set to a fresh git repo
+// containing a committed a.txt.
+func inGitRepo(t *testing.T, fn func(dir string)) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=t", "-c", "user.email=t@t", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("orig\n"), 0644))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	fn(dir)
+}
+
+func TestCheckpointName(t *testing.T) {
+	assert.Equal(t, "run1/task-02/iter-010", checkpointName("run1", 2, 10))
+}
+
+func TestRunner_CheckpointsAndRollback(t *testing.T) {
+	inGitRepo(t, func(dir string) {
+		cfg := &config.Config{}
+		cfg.Agent.Command = "echo broken > a.txt; touch new.txt # %s"
+		cfg.Agent.PromptVia = config.PromptViaShell
+		cfg.Validate.Command = "exit 1"
+		cfg.Git.Checkpoints = true
+		cfg.Git.RollbackOnFailure = true
+
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+		rec := &recorder{}
+		r.Subscribe(rec)
+
+		err := r.Run(context.Background(), "task")
+		require.ErrorIs(t, err, ErrMaxIterations)
+
+		var created []CheckpointCreated
+		var rolledBack []RolledBack
+		for _, e := range rec.events {
+			switch e := e.(type) {
+			case CheckpointCreated:
+				created = append(created, e)
+			case RolledBack:
+				rolledBack = append(rolledBack, e)
+			}
+		}
+		require.Len(t, created, 2)
+		assert.Equal(t, r.RunID()+"/task-01/iter-001", created[0].Name)
+		require.Len(t, rolledBack, 1)
+		assert.NoError(t, rolledBack[0].Err)
+		assert.Equal(t, created[0].Name, rolledBack[0].Name)
+
+		data, err := os.ReadFile("a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "orig\n", string(data))
+		assert.NoFileExists(t, "new.txt")
+
+		// The second snapshot holds iteration 1's result and can be restored
+		repo, err := checkpoint.Open(dir)
+		require.NoError(t, err)
+		require.NoError(t, repo.Restore(context.Background(), created[1].Name))
+		data, err = os.ReadFile("a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "broken\n", string(data))
+	})
+}
+
+func TestRunner_NoRollbackOnSuccess(t *testing.T) {
+	inGitRepo(t, func(dir string) {
+		cfg := &config.Config{}
+		cfg.Agent.Command = "echo fixed > a.txt # %s"
+		cfg.Agent.PromptVia = config.PromptViaShell
+		cfg.Validate.Command = "exit 0"
+		cfg.Git.Checkpoints = true
+		cfg.Git.RollbackOnFailure = true
+
+		r := New(cfg, newMockHarness(cfg))
+		require.NoError(t, r.Run(context.Background(), "task"))
+
+		data, err := os.ReadFile("a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "fixed\n", string(data))
+	})
+}
+
+func TestRunner_CheckpointsOutsideGitWarns(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	cfg := &config.Config{}
+	cfg.Agent.Command = "echo '%s'"
+	cfg.Validate.Command = "exit 0"
+	cfg.Git.Checkpoints = true
+
+	r := New(cfg, newMockHarness(cfg))
+	rec := &recorder{}
+	r.Subscribe(rec)
+
+	require.NoError(t, r.Run(context.Background(), "task"))
+	assert.Contains(t, rec.kinds(), "Warning")
+}
+
+func TestRunner_ChangedFilesInPrompt(t *testing.T) {
+	inGitRepo(t, func(dir string) {
+		cfg := &config.Config{}
+		cfg.Agent.Command = "echo x >> b.txt # %s"
+		cfg.Agent.PromptVia = config.PromptViaShell
+		cfg.Agent.RetryPrompt = "changed: {{.ChangedFiles}}"
+		cfg.Validate.Command = "exit 1"
+		cfg.Patience = -1
+
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+		rec := &recorder{}
+		r.Subscribe(rec)
+		require.Error(t, r.Run(context.Background(), "task"))
+
+		var prompts []string
+		for _, e := range rec.events {
+			if e, ok := e.(IterationStart); ok {
+				prompts = append(prompts, e.Prompt)
+			}
+		}
+		assert.Equal(t, []string{"task", "changed: b.txt"}, prompts)
+	})
+}
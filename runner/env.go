@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jack/tatsu/config"
+)
+
+// Redacted replaces secret values in agent and validation output.
+const Redacted = config.Redacted
+
+// loadEnv reads agent.env for a task: the environment the agent and the
+// validation commands run with, and the secret values to scrub from what
+// they print. .env files are read again for every task.
+func (r *Runner) loadEnv() error {
+	env, secrets, err := r.config.Agent.Env.Environ(os.Environ())
+	if err != nil {
+		return err
+	}
+	r.env = env
+	r.scrubber = newScrubber(secrets)
+	return nil
+}
+
+// newScrubber returns a replacer for secrets, or nil if there are none.
+// Longer values are replaced first, so a secret containing another is
+// redacted whole.
+func newScrubber(secrets []string) *strings.Replacer {
+	if len(secrets) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), secrets...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, s := range sorted {
+		pairs = append(pairs, s, Redacted)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// scrub redacts secret values in s. Agent and validation output pass
+// through here before they reach the sinks (the terminal, the journal) or
+// the retry prompt.
+func (r *Runner) scrub(s string) string {
+	if r.scrubber == nil {
+		return s
+	}
+	return r.scrubber.Replace(s)
+}
@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunner_EnvAndScrubbing(t *testing.T) {
+	t.Setenv("TATSU_TEST_TOKEN", "tok-0123456789")
+	t.Setenv("TATSU_TEST_API_KEY", "sk-0123456789")
+	envFile := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(envFile, []byte("FILE_KEY=file-secret-value\n"), 0644))
+
+	cfg := &config.Config{}
+	cfg.Agent.Command = `echo "agent sees [$TATSU_TEST_TOKEN] [$FILE_KEY] [$EXTRA] [$TATSU_TEST_API_KEY] [$SET_TOKEN]" # %s`
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Agent.Env = config.Env{Set: map[string]string{"EXTRA": "extra", "SET_TOKEN": "set-token-value"}, Files: []string{envFile}}
+	cfg.Validate.Command = `echo "leaked file-secret-value"; exit 1`
+	cfg.Patience = -1
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+	rec := &recorder{}
+	r.Subscribe(rec)
+	require.ErrorIs(t, r.Run(context.Background(), "task"), ErrMaxIterations)
+
+	assert.Contains(t, rec.events, AgentLine{Stream: Stdout, Line: "agent sees [] [[REDACTED]] [extra] [[REDACTED]] [[REDACTED]]"},
+		"the token is withheld; the .env value and the secret-named ones are passed but scrubbed")
+	var result ValidationResult
+	var retry IterationStart
+	for _, e := range rec.events {
+		switch e := e.(type) {
+		case ValidationResult:
+			result = e
+		case IterationStart:
+			retry = e
+		}
+	}
+	assert.Equal(t, "leaked [REDACTED]\n", result.Output)
+	assert.NotContains(t, retry.Prompt, "file-secret-value")
+}
+
+func TestRunner_EnvFileMissing(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "true %s"
+	cfg.Agent.Env.Files = []string{filepath.Join(t.TempDir(), "missing.env")}
+	cfg.Validate.Command = "true"
+
+	r := New(cfg, newMockHarness(cfg))
+	err := r.Run(context.Background(), "task")
+	assert.ErrorContains(t, err, "agent.env.files")
+}
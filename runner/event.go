@@ -0,0 +1,281 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jack/tatsu/harness"
+	"github.com/jack/tatsu/testresult"
+)
+
+// Event is something that happened during a run. The runner and the PRD
+// executor emit events to every subscribed Sink; consumers type-switch on the
+// concrete types below.
+type Event interface {
+	event()
+}
+
+// Stream identifies which agent output stream a line came from.
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+// RunStart is emitted once before any task runs. PRD is the PRD file path,
+// empty for a single task run. Profile is the profile of the run's config.
+type RunStart struct {
+	PRD       string
+	Profile   string
+	Total     int // tasks in the run (including already completed PRD tasks)
+	Completed int // tasks already completed before the run
+	Pending   int // tasks that will be executed
+}
+
+// TaskStart is emitted before the first iteration of a task.
+type TaskStart struct {
+	Index   int // 1-based position among the pending tasks
+	Total   int // number of pending tasks
+	Title   string
+	Profile string // the profile the task runs with, if any
+}
+
+// IterationStart is emitted before each agent call. Prompt is what the
+// agent is sent (before shell escaping).
+type IterationStart struct {
+	Task          string
+	Iteration     int
+	MaxIterations int
+	Prompt        string
+	// StartTree is the git tree of the working tree when the task started,
+	// which ChangedFiles and the integrity check compare with; empty
+	// outside a git repository.
+	StartTree string
+	// Protected holds the files matching guard.protected_paths before this
+	// agent call, by slash-separated path, and StartProtected (set on the
+	// first iteration a runner runs of the task) those before the task.
+	// Nil when nothing is protected.
+	Protected      map[string]ProtectedFile
+	StartProtected map[string]ProtectedFile
+}
+
+// Resumed is emitted when a task of a resumed run continues at Iteration
+// instead of starting over.
+type Resumed struct {
+	RunID         string
+	Task          int
+	Iteration     int
+	MaxIterations int
+}
+
+// AgentLine is a single line of agent output.
+type AgentLine struct {
+	Stream Stream
+	Line   string
+}
+
+// AgentExit is emitted when the agent process finishes. Err is non-nil if
+// the agent could not be started, exited non-zero or timed out. Usage is
+// set if the agent reported its token usage.
+type AgentExit struct {
+	ExitCode int
+	Duration time.Duration
+	Usage    *harness.Usage
+	Err      error
+}
+
+// SessionStarted is emitted when the agent started a new session for the
+// task (the first iteration, or after agent.session.reset_after failures).
+// Later iterations continue it. Only harnesses that keep sessions report one.
+type SessionStarted struct {
+	Task      string
+	Iteration int
+	SessionID string
+}
+
+// ValidationStart is emitted before the validation command runs.
+type ValidationStart struct{}
+
+// ValidationResult is emitted after the validation pipeline finishes. Err is
+// a *TimeoutError when the validation step timed out. Output is the combined
+// output of all stages that ran; Feedback is what the agent is shown on the
+// next iteration (only the failing tests' messages when results could be
+// parsed, otherwise the failed stages' output).
+type ValidationResult struct {
+	Success  bool
+	Output   string
+	Feedback string
+	Duration time.Duration
+	Err      error
+	Stages   []StageResult
+	// Report merges the parsed test results of all stages; nil if no stage
+	// produced any. PreviousReport is the previous iteration's Report.
+	Report         *testresult.Report
+	PreviousReport *testresult.Report
+	// KnownFailures are failing tests that already failed before the task
+	// (validate.baseline.known_failures: ignore). Validation passed because
+	// they were its only failures.
+	KnownFailures []string
+}
+
+// FailedStages returns the names of the stages that failed.
+func (v ValidationResult) FailedStages() []string {
+	var names []string
+	for _, s := range v.Stages {
+		if !s.Success && !s.Skipped {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// TestSummary describes the parsed test results, e.g. "10 passed, 3 failed,
+// 0 skipped (failing: 12 → 3)". Empty if no results were parsed.
+func (v ValidationResult) TestSummary() string {
+	if v.Report == nil || v.Report.Total() == 0 {
+		return ""
+	}
+	summary := v.Report.Summary()
+	if v.PreviousReport != nil && v.PreviousReport.Failed != v.Report.Failed {
+		summary += fmt.Sprintf(" (failing: %d → %d)", v.PreviousReport.Failed, v.Report.Failed)
+	}
+	return summary
+}
+
+// StageStart is emitted before a validation stage runs.
+type StageStart struct {
+	Name  string
+	Index int // 1-based
+	Total int
+}
+
+// StageResult is emitted after a validation stage finishes (or is skipped
+// because an earlier fail-fast stage failed), and is also collected in
+// ValidationResult.Stages.
+type StageResult struct {
+	Name     string
+	Command  string
+	Success  bool
+	Skipped  bool
+	ExitCode int
+	Output   string
+	Duration time.Duration
+	Err      error              // *TimeoutError if the stage timed out
+	Report   *testresult.Report // parsed test results, nil if none
+}
+
+// NoProgress is emitted after a failed iteration that failed the same way
+// as the previous one. Iterations counts such iterations in a row; the task
+// is given up when it reaches Patience. Not emitted when stall detection is
+// disabled.
+type NoProgress struct {
+	Iterations int
+	Patience   int
+}
+
+// Baseline is emitted with the result of the validation run before a
+// task's first agent call (validate.baseline, validate.integrity). Skipped
+// reports that validation already passed and the task is skipped.
+type Baseline struct {
+	Task    string
+	Result  ValidationResult
+	Skipped bool
+}
+
+// IntegrityViolation is emitted when validation passed but tests were lost
+// or skipped compared with the baseline, or skip markers were added.
+// Accepted reports whether the user accepted the changes, completing the
+// task; otherwise the agent is asked to restore the tests, with Feedback
+// in place of the validation output.
+type IntegrityViolation struct {
+	Task      string
+	Iteration int
+	Issues    []string
+	Accepted  bool
+	Feedback  string
+}
+
+// GuardViolation is emitted after an agent call that created, modified or
+// deleted files matching guard.protected_paths. Changes describes each,
+// e.g. "modified foo_test.go". Reverted reports whether the files were
+// restored; if not (guard.on_violation: fail, or Err) the iteration fails.
+type GuardViolation struct {
+	Task      string
+	Iteration int
+	Changes   []string
+	Reverted  bool
+	Err       error // restoring the files failed
+}
+
+// TaskComplete is emitted when a task passes validation or gives up.
+// Skipped reports that validation already passed before the task, so the
+// agent was not run and nothing was done (validate.baseline.if_passing).
+type TaskComplete struct {
+	Title      string
+	Iterations int
+	Err        error
+	Skipped    bool
+}
+
+// RunComplete is emitted once when the whole run (single task or PRD) ends.
+type RunComplete struct {
+	Err error
+}
+
+// CheckpointCreated is emitted when the working tree has been snapshotted
+// before an agent call. Name can be passed to `tatsu checkpoints restore`.
+type CheckpointCreated struct {
+	Name      string
+	SHA       string
+	Iteration int
+}
+
+// RolledBack is emitted after a failed task's changes were undone by
+// restoring its pre-task checkpoint. Err is set if the restore failed.
+type RolledBack struct {
+	Name string
+	SHA  string
+	Err  error
+}
+
+// Warning reports a non-fatal problem (e.g. the PRD file could not be updated).
+type Warning struct {
+	Message string
+}
+
+func (RunStart) event()           {}
+func (TaskStart) event()          {}
+func (IterationStart) event()     {}
+func (Resumed) event()            {}
+func (AgentLine) event()          {}
+func (AgentExit) event()          {}
+func (SessionStarted) event()     {}
+func (ValidationStart) event()    {}
+func (ValidationResult) event()   {}
+func (StageStart) event()         {}
+func (StageResult) event()        {}
+func (NoProgress) event()         {}
+func (GuardViolation) event()     {}
+func (Baseline) event()           {}
+func (IntegrityViolation) event() {}
+func (TaskComplete) event()       {}
+func (RunComplete) event()        {}
+func (CheckpointCreated) event()  {}
+func (RolledBack) event()         {}
+func (Warning) event()            {}
+
+// Sink receives events. Handle is called synchronously from the run
+// goroutine (and, for agent output, from the output copying goroutines, one
+// event at a time), so it should not block for long.
+type Sink interface {
+	Handle(Event)
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(Event)
+
+// Handle calls f(e).
+func (f SinkFunc) Handle(e Event) {
+	f(e)
+}
@@ -0,0 +1,186 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jack/tatsu/config"
+)
+
+// ProtectedFile is the content of a file matching guard.protected_paths
+// as it was before an agent call.
+type ProtectedFile struct {
+	Data []byte
+	Mode fs.FileMode
+}
+
+// protectedFiles reads the files matching guard.protected_paths, by
+// slash-separated path. It is nil when nothing is protected. The files are
+// read from disk rather than git, so the guard works outside a repo and
+// sees ignored files too.
+func (r *Runner) protectedFiles() (map[string]ProtectedFile, error) {
+	if !r.config.Guard.Enabled() {
+		return nil, nil
+	}
+	files := make(map[string]ProtectedFile)
+	err := walkProtected(r.config.Guard, func(name, path string, info fs.FileInfo) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[name] = ProtectedFile{Data: data, Mode: info.Mode().Perm()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read protected files: %w", err)
+	}
+	return files, nil
+}
+
+// protectedChanges compares the protected files on disk with before and
+// describes each change, e.g. "modified foo_test.go", sorted by path.
+// Putting a file back the way it was in original, before the task, is not
+// a change.
+func (r *Runner) protectedChanges(before, original map[string]ProtectedFile) []string {
+	if before == nil {
+		return nil
+	}
+	changes := make(map[string]string)
+	seen := make(map[string]bool)
+	_ = walkProtected(r.config.Guard, func(name, path string, _ fs.FileInfo) error {
+		seen[name] = true
+		old, ok := before[name]
+		data, err := os.ReadFile(path)
+		if ok && err == nil && bytes.Equal(data, old.Data) {
+			return nil
+		}
+		if f, restored := original[name]; restored && err == nil && bytes.Equal(data, f.Data) {
+			return nil
+		}
+		if ok {
+			changes[name] = "modified " + name
+		} else {
+			changes[name] = "created " + name
+		}
+		return nil
+	})
+	for name := range before {
+		if _, existed := original[name]; !seen[name] && existed {
+			changes[name] = "deleted " + name
+		}
+	}
+
+	names := make([]string, 0, len(changes))
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = changes[name]
+	}
+	return out
+}
+
+// restoreProtected puts the protected files back as they were in before:
+// rewrites modified and deleted files and removes created ones.
+func (r *Runner) restoreProtected(before map[string]ProtectedFile) error {
+	var created []string
+	_ = walkProtected(r.config.Guard, func(name, path string, _ fs.FileInfo) error {
+		if _, ok := before[name]; !ok {
+			created = append(created, path)
+		}
+		return nil
+	})
+	for _, path := range created {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for name, f := range before {
+		path := filepath.FromSlash(name)
+		if data, err := os.ReadFile(path); err == nil && bytes.Equal(data, f.Data) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, f.Data, f.Mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkGuard reports changes the agent made to protected files since
+// before, the start of the iteration, reverting them unless
+// guard.on_violation is fail. Changes left by an earlier failed iteration
+// are not reported again, and restoring files to original is allowed. It
+// returns the message for the agent's next prompt (empty if nothing
+// changed) and whether the files were reverted.
+func (r *Runner) checkGuard(task string, iteration int, before, original map[string]ProtectedFile) (string, bool) {
+	changes := r.protectedChanges(before, original)
+	if len(changes) == 0 {
+		return "", false
+	}
+	e := GuardViolation{Task: task, Iteration: iteration, Changes: changes}
+	if r.config.Guard.OnViolation != config.GuardFail {
+		e.Err = r.restoreProtected(before)
+		e.Reverted = e.Err == nil
+	}
+	r.Emit(e)
+
+	var b strings.Builder
+	b.WriteString("You changed protected files, which is not allowed:\n")
+	for _, c := range changes {
+		fmt.Fprintf(&b, "- %s\n", c)
+	}
+	if e.Reverted {
+		b.WriteString("These changes were reverted. Complete the task without changing protected files.")
+	} else {
+		b.WriteString("Restore these files to their original content and complete the task without changing them.")
+	}
+	return b.String(), e.Reverted
+}
+
+// guardFailure is the result of an iteration failed for changing protected
+// files that were not reverted: validation is not run.
+func (r *Runner) guardFailure(message string) ValidationResult {
+	result := ValidationResult{Output: message, Feedback: message}
+	r.Emit(result)
+	return result
+}
+
+// walkProtected calls fn for each regular file under the current directory
+// that the guard protects, with its slash-separated name and OS path.
+func walkProtected(g config.Guard, fn func(name, path string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			switch d.Name() {
+			case ".git", ".tatsu", "node_modules":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		name := filepath.ToSlash(path)
+		if !g.Protects(name) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		return fn(name, path, info)
+	})
+}
@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inProject runs fn with the working directory set to a fresh directory
+// (not a git repo) holding a_test.go and tests/b_test.go.
+func inProject(t *testing.T, fn func(dir string)) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tests"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a_test.go"), []byte("orig\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tests", "b_test.go"), []byte("orig\n"), 0644))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	fn(dir)
+}
+
+func guardViolations(rec *recorder) []GuardViolation {
+	var out []GuardViolation
+	for _, e := range rec.events {
+		if v, ok := e.(GuardViolation); ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func TestRunner_GuardReverts(t *testing.T) {
+	inProject(t, func(dir string) {
+		cfg := &config.Config{}
+		cfg.Agent.Command = "echo hacked > a_test.go; echo new > c_test.go; rm tests/b_test.go; echo done > impl.txt # %s"
+		cfg.Agent.PromptVia = config.PromptViaShell
+		cfg.Validate.Command = "grep -q orig a_test.go && test -f impl.txt"
+		cfg.Guard.ProtectedPaths = []string{"*_test.go"}
+
+		r := New(cfg, newMockHarness(cfg))
+		rec := &recorder{}
+		r.Subscribe(rec)
+		require.NoError(t, r.Run(context.Background(), "task"))
+
+		assert.Equal(t, []GuardViolation{{
+			Task:      "task",
+			Iteration: 1,
+			Changes:   []string{"modified a_test.go", "created c_test.go", "deleted tests/b_test.go"},
+			Reverted:  true,
+		}}, guardViolations(rec))
+		assertFileContent(t, filepath.Join(dir, "a_test.go"), "orig\n")
+		assertFileContent(t, filepath.Join(dir, "tests", "b_test.go"), "orig\n")
+		assert.NoFileExists(t, filepath.Join(dir, "c_test.go"))
+		assertFileContent(t, filepath.Join(dir, "impl.txt"), "done\n")
+	})
+}
+
+func TestRunner_GuardFailsIteration(t *testing.T) {
+	inProject(t, func(dir string) {
+		cfg := &config.Config{}
+		cfg.Agent.Command = `case "%s" in *Restore*) echo orig > a_test.go;; *) echo hacked > a_test.go;; esac`
+		cfg.Agent.PromptVia = config.PromptViaShell
+		cfg.Validate.Command = "true"
+		cfg.Guard.ProtectedPaths = []string{"a_test.go"}
+		cfg.Guard.OnViolation = config.GuardFail
+
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 3)
+		rec := &recorder{}
+		r.Subscribe(rec)
+		require.NoError(t, r.Run(context.Background(), "task"))
+
+		violations := guardViolations(rec)
+		require.Len(t, violations, 1)
+		assert.False(t, violations[0].Reverted)
+
+		var prompts []string
+		validations := 0
+		for _, e := range rec.events {
+			switch e := e.(type) {
+			case IterationStart:
+				prompts = append(prompts, e.Prompt)
+			case ValidationStart:
+				validations++
+			}
+		}
+		require.Len(t, prompts, 2)
+		assert.Contains(t, prompts[1], "- modified a_test.go")
+		assert.Equal(t, 1, validations, "the violating iteration is not validated")
+	})
+}
+
+func TestRunner_GuardChecksEachIteration(t *testing.T) {
+	inProject(t, func(dir string) {
+		cfg := &config.Config{}
+		// Iteration 1 changes a test, iteration 2 only the code
+		cfg.Agent.Command = `if [ -f impl.txt ]; then echo done > impl.txt; else echo hacked > a_test.go; echo wip > impl.txt; fi # %s`
+		cfg.Agent.PromptVia = config.PromptViaShell
+		cfg.Validate.Command = "grep -q done impl.txt"
+		cfg.Guard.ProtectedPaths = []string{"*_test.go"}
+		cfg.Guard.OnViolation = config.GuardFail
+
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 3)
+		rec := &recorder{}
+		r.Subscribe(rec)
+		require.NoError(t, r.Run(context.Background(), "task"))
+
+		violations := guardViolations(rec)
+		require.Len(t, violations, 1, "the change left by iteration 1 does not fail iteration 2")
+		assert.Equal(t, 1, violations[0].Iteration)
+		assert.Contains(t, rec.events, TaskComplete{Title: "task", Iterations: 2})
+	})
+}
+
+func TestRunner_ResumeKeepsProtectedSnapshot(t *testing.T) {
+	inProject(t, func(dir string) {
+		// Killed after the agent of iteration 2 changed a test
+		require.NoError(t, os.WriteFile("a_test.go", []byte("hacked\n"), 0644))
+		saved := map[string]ProtectedFile{
+			"a_test.go":       {Data: []byte("orig\n"), Mode: 0644},
+			"tests/b_test.go": {Data: []byte("orig\n"), Mode: 0644},
+		}
+
+		cfg := &config.Config{}
+		cfg.Agent.Command = "true %s"
+		cfg.Validate.Command = "true"
+		cfg.Guard.ProtectedPaths = []string{"*_test.go"}
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 3)
+		r.Resume(ResumeState{RunID: "run", Task: 1, Title: "task", Iteration: 1, StartProtected: saved, Protected: saved})
+		rec := &recorder{}
+		r.Subscribe(rec)
+		require.NoError(t, r.Run(context.Background(), "task"))
+
+		violations := guardViolations(rec)
+		require.Len(t, violations, 1)
+		assert.Equal(t, []string{"modified a_test.go"}, violations[0].Changes)
+		assertFileContent(t, filepath.Join(dir, "a_test.go"), "orig\n")
+	})
+}
+
+func assertFileContent(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, want, string(data))
+}
@@ -0,0 +1,142 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jack/tatsu/testresult"
+)
+
+// Confirm asks the user a yes/no question and waits for the answer. It
+// should return false when ctx is done or no one can answer.
+type Confirm func(ctx context.Context, question string) bool
+
+// SetConfirm sets how the runner asks the user to decide what must not be
+// left to the agent, e.g. accepting lost tests. Without it every such
+// question is answered no.
+func (r *Runner) SetConfirm(c Confirm) {
+	r.confirm = c
+}
+
+func (r *Runner) ask(ctx context.Context, question string) bool {
+	return r.confirm != nil && r.confirm(ctx, question)
+}
+
+// skipMarker matches code that skips or focuses tests in Go, pytest and
+// Jest: t.Skip(...), @pytest.mark.skip, it.skip(...), xit(...), it.only(...)
+// and the like. A focused test silently skips all the others.
+var skipMarker = regexp.MustCompile(`\b[tb]\.Skip(Now|f)?\(` +
+	`|\bpytest\.(skip|xfail)\(|@pytest\.mark\.(skip|skipif|xfail)\b|@unittest\.(skip|skipIf|skipUnless|expectedFailure)\b|\bunittest\.SkipTest\b` +
+	`|\b(it|test|describe)\.(skip|only|todo)\(|\b(xit|xtest|xdescribe|fit|fdescribe)\(`)
+
+// integrityIssues compares passing test results with the baseline and
+// looks for skip markers added since the git tree start. It describes each
+// problem, e.g. "TestFoo is missing".
+func (r *Runner) integrityIssues(ctx context.Context, baseline *ValidationResult, start string, report *testresult.Report) []string {
+	var issues []string
+	if baseline != nil {
+		issues = compareReports(baseline.Report, report)
+	}
+	if start != "" {
+		if now := r.gitTree(ctx); now != "" && now != start {
+			if diff, err := r.stateRepo.Diff(ctx, start, now); err == nil {
+				issues = append(issues, addedSkipMarkers(diff)...)
+			}
+		}
+	}
+	return issues
+}
+
+// compareReports reports tests that ran before and no longer do: a lower
+// test count, missing test names and tests skipped that were not before.
+// Names are only compared when both reports list every test.
+func compareReports(before, after *testresult.Report) []string {
+	if before == nil {
+		return nil
+	}
+	if after == nil {
+		if before.Total() > 0 {
+			return []string{fmt.Sprintf("no test results, %d test(s) before the task", before.Total())}
+		}
+		return nil
+	}
+
+	var issues []string
+	if after.Total() < before.Total() {
+		issues = append(issues, fmt.Sprintf("test count dropped from %d to %d", before.Total(), after.Total()))
+	}
+	if after.Skipped > before.Skipped {
+		issues = append(issues, fmt.Sprintf("skipped tests rose from %d to %d", before.Skipped, after.Skipped))
+	}
+	if !listsAll(before) || !listsAll(after) {
+		return issues
+	}
+	status := make(map[string]testresult.Status, len(after.Tests))
+	for _, t := range after.Tests {
+		status[t.Name] = t.Status
+	}
+	for _, t := range before.Tests {
+		now, ok := status[t.Name]
+		switch {
+		case !ok:
+			issues = append(issues, t.Name+" is missing")
+		case now == testresult.Skipped && t.Status != testresult.Skipped:
+			issues = append(issues, t.Name+" is now skipped")
+		}
+	}
+	return issues
+}
+
+// listsAll reports whether the report names every test it counts (e.g. go
+// test -v or -json, not plain go test).
+func listsAll(r *testresult.Report) bool {
+	return len(r.Tests) > 0 && len(r.Tests) >= r.Total()
+}
+
+// addedSkipMarkers finds skip markers on the added lines of a patch.
+func addedSkipMarkers(diff string) []string {
+	var issues []string
+	file := ""
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+		case strings.HasPrefix(line, "+"):
+			if code := strings.TrimSpace(line[1:]); skipMarker.MatchString(code) {
+				issues = append(issues, fmt.Sprintf("skip marker added in %s: %s", file, code))
+			}
+		}
+	}
+	return issues
+}
+
+// acceptIntegrity asks the user whether the task may complete despite the
+// issues and emits IntegrityViolation with the answer.
+func (r *Runner) acceptIntegrity(ctx context.Context, task string, iteration int, issues []string) bool {
+	var q strings.Builder
+	q.WriteString("Validation passed, but the tests changed:\n")
+	for _, issue := range issues {
+		fmt.Fprintf(&q, "  - %s\n", issue)
+	}
+	q.WriteString("Accept these changes and complete the task?")
+	accepted := r.ask(ctx, q.String())
+	e := IntegrityViolation{Task: task, Iteration: iteration, Issues: issues, Accepted: accepted}
+	if !accepted {
+		e.Feedback = integrityFeedback(issues)
+	}
+	r.Emit(e)
+	return accepted
+}
+
+// integrityFeedback tells the agent why a passing iteration did not count.
+func integrityFeedback(issues []string) string {
+	var b strings.Builder
+	b.WriteString("Validation passed, but only because tests were removed or skipped:\n")
+	for _, issue := range issues {
+		fmt.Fprintf(&b, "- %s\n", issue)
+	}
+	b.WriteString("Restore the tests and make them pass instead.")
+	return b.String()
+}
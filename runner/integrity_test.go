@@ -0,0 +1,136 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/testresult"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareReports(t *testing.T) {
+	before := &testresult.Report{
+		Tests:  []testresult.Test{{Name: "TestA", Status: testresult.Failed}, {Name: "TestB", Status: testresult.Passed}, {Name: "TestC", Status: testresult.Passed}},
+		Passed: 2, Failed: 1,
+	}
+	after := &testresult.Report{
+		Tests:  []testresult.Test{{Name: "TestB", Status: testresult.Passed}, {Name: "TestC", Status: testresult.Skipped}},
+		Passed: 1, Skipped: 1,
+	}
+	assert.Equal(t, []string{
+		"test count dropped from 3 to 2",
+		"skipped tests rose from 0 to 1",
+		"TestA is missing",
+		"TestC is now skipped",
+	}, compareReports(before, after))
+
+	assert.Empty(t, compareReports(before, before))
+	assert.Empty(t, compareReports(nil, after), "no baseline results, nothing to compare")
+	assert.Equal(t, []string{"no test results, 3 test(s) before the task"}, compareReports(before, nil))
+
+	countsOnly := &testresult.Report{Tests: []testresult.Test{{Name: "TestA", Status: testresult.Failed}}, Passed: 2, Failed: 1}
+	assert.Empty(t, compareReports(countsOnly, &testresult.Report{Passed: 3}),
+		"names are not compared when passing tests are not listed")
+}
+
+func TestAddedSkipMarkers(t *testing.T) {
+	diff := `diff --git a/a_test.go b/a_test.go
+--- a/a_test.go
++++ b/a_test.go
+@@ -3,0 +4 @@ func TestA(t *testing.T) {
++	t.Skip("flaky")
+-	t.Skip("removed skips are fine")
+diff --git a/test_x.py b/test_x.py
+--- a/test_x.py
++++ b/test_x.py
+@@ -1,0 +2,2 @@
++@pytest.mark.skip(reason="later")
++def test_skipped_name(): pass
+diff --git a/x.test.js b/x.test.js
+--- a/x.test.js
++++ b/x.test.js
+@@ -1 +1 @@
++it.only("focus", () => {})
++xit("off", () => {})
++const skipper = "it.skipped"
+`
+	assert.Equal(t, []string{
+		`skip marker added in a_test.go: t.Skip("flaky")`,
+		`skip marker added in test_x.py: @pytest.mark.skip(reason="later")`,
+		`skip marker added in x.test.js: it.only("focus", () => {})`,
+		`skip marker added in x.test.js: xit("off", () => {})`,
+	}, addedSkipMarkers(diff))
+}
+
+// integrityConfig validates with go test output the agent writes to
+// out.txt: two tests before the task, one failing.
+func integrityConfig(t *testing.T) *config.Config {
+	t.Helper()
+	require.NoError(t, os.WriteFile("out.txt", []byte("--- FAIL: TestA (0.00s)\n--- PASS: TestB (0.00s)\nFAIL\n"), 0644))
+	cfg := &config.Config{}
+	cfg.Agent.Command = `printf -- '--- PASS: TestB (0.00s)\nok\n' > out.txt; printf 'func TestA(t *testing.T) {\n\tt.Skip("later")\n}\n' > a_test.go # %s`
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Validate.Command = "cat out.txt; grep -q '^ok' out.txt"
+	cfg.Validate.Parser = testresult.FormatGo
+	cfg.Validate.Integrity = true
+	cfg.Patience = -1
+	return cfg
+}
+
+func TestRunner_IntegrityRejected(t *testing.T) {
+	inGitRepo(t, func(dir string) {
+		cfg := integrityConfig(t)
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+		rec := &recorder{}
+		r.Subscribe(rec)
+
+		err := r.Run(context.Background(), "task")
+		require.ErrorIs(t, err, ErrMaxIterations, "without anyone to accept, a weakened suite does not pass")
+
+		var baseline Baseline
+		var violation IntegrityViolation
+		var prompts []string
+		for _, e := range rec.events {
+			switch e := e.(type) {
+			case Baseline:
+				baseline = e
+			case IntegrityViolation:
+				violation = e
+			case IterationStart:
+				prompts = append(prompts, e.Prompt)
+			}
+		}
+		assert.False(t, baseline.Result.Success)
+		assert.Equal(t, "1 passed, 1 failed, 0 skipped", baseline.Result.TestSummary())
+		assert.False(t, violation.Accepted)
+		assert.Equal(t, []string{
+			"test count dropped from 2 to 1",
+			"TestA is missing",
+			`skip marker added in a_test.go: t.Skip("later")`,
+		}, violation.Issues)
+		require.Len(t, prompts, 2)
+		assert.Contains(t, prompts[1], "- TestA is missing")
+		assert.Contains(t, prompts[1], violation.Feedback, "the feedback is recorded as it was sent")
+	})
+}
+
+func TestRunner_IntegrityAccepted(t *testing.T) {
+	inGitRepo(t, func(dir string) {
+		cfg := integrityConfig(t)
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+		var question string
+		r.SetConfirm(func(ctx context.Context, q string) bool {
+			question = q
+			return true
+		})
+		rec := &recorder{}
+		r.Subscribe(rec)
+
+		require.NoError(t, r.Run(context.Background(), "task"))
+		assert.Contains(t, question, "  - TestA is missing\n")
+		assert.Contains(t, rec.kinds(), "IntegrityViolation")
+	})
+}
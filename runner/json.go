@@ -0,0 +1,285 @@
+package runner
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/jack/tatsu/harness"
+	"github.com/jack/tatsu/testresult"
+)
+
+// JSONPrinter is the CLI sink for --output=json: it writes one JSON object
+// per line (NDJSON) for the events CI cares about. Every object has "type"
+// and "time"; the fields of each type are the json* structs below and are
+// documented in the README. Agent output, stages and other events are not
+// written.
+type JSONPrinter struct {
+	enc *json.Encoder
+	now func() time.Time
+
+	// ExitCode, if set, maps the run error to the exit status reported in
+	// run_complete.
+	ExitCode func(error) int
+
+	start      time.Time
+	task       string
+	iteration  int
+	tasks      int
+	passed     int
+	skipped    int
+	iterations int
+}
+
+// NewJSONPrinter creates a JSONPrinter writing to w.
+func NewJSONPrinter(w io.Writer) *JSONPrinter {
+	return &JSONPrinter{enc: json.NewEncoder(w), now: time.Now}
+}
+
+type jsonHeader struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+}
+
+type jsonRunStart struct {
+	jsonHeader
+	PRD       string `json:"prd,omitempty"`
+	Profile   string `json:"profile,omitempty"`
+	Total     int    `json:"total"`
+	Completed int    `json:"completed"`
+	Pending   int    `json:"pending"`
+}
+
+type jsonTaskStart struct {
+	jsonHeader
+	Index   int    `json:"index"`
+	Total   int    `json:"total"`
+	Title   string `json:"title"`
+	Profile string `json:"profile,omitempty"`
+}
+
+type jsonIteration struct {
+	jsonHeader
+	Task          string `json:"task"`
+	Iteration     int    `json:"iteration"`
+	MaxIterations int    `json:"max_iterations"`
+}
+
+type jsonUsage struct {
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	TotalTokens  int     `json:"total_tokens"`
+	CostUSD      float64 `json:"cost_usd,omitempty"`
+}
+
+type jsonAgentExit struct {
+	jsonHeader
+	Task       string     `json:"task"`
+	Iteration  int        `json:"iteration"`
+	ExitCode   int        `json:"exit_code"`
+	DurationMS int64      `json:"duration_ms"`
+	Usage      *jsonUsage `json:"usage,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Timeout    bool       `json:"timeout,omitempty"`
+}
+
+type jsonStage struct {
+	Name       string `json:"name"`
+	Success    bool   `json:"success"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type jsonTests struct {
+	Passed  int      `json:"passed"`
+	Failed  int      `json:"failed"`
+	Skipped int      `json:"skipped"`
+	Failing []string `json:"failing,omitempty"`
+}
+
+type jsonValidation struct {
+	jsonHeader
+	Task          string      `json:"task"`
+	Iteration     int         `json:"iteration"`
+	Success       bool        `json:"success"`
+	DurationMS    int64       `json:"duration_ms"`
+	Error         string      `json:"error,omitempty"`
+	Timeout       bool        `json:"timeout,omitempty"`
+	Stages        []jsonStage `json:"stages,omitempty"`
+	Tests         *jsonTests  `json:"tests,omitempty"`
+	KnownFailures []string    `json:"known_failures,omitempty"`
+}
+
+type jsonBaseline struct {
+	jsonHeader
+	Task    string     `json:"task"`
+	Success bool       `json:"success"`
+	Skipped bool       `json:"skipped,omitempty"`
+	Tests   *jsonTests `json:"tests,omitempty"`
+}
+
+type jsonIntegrity struct {
+	jsonHeader
+	Task      string   `json:"task"`
+	Iteration int      `json:"iteration"`
+	Issues    []string `json:"issues"`
+	Accepted  bool     `json:"accepted"`
+}
+
+type jsonTaskComplete struct {
+	jsonHeader
+	Title      string `json:"title"`
+	Iterations int    `json:"iterations"`
+	Success    bool   `json:"success"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type jsonRunComplete struct {
+	jsonHeader
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	Tasks      int    `json:"tasks"`
+	Passed     int    `json:"passed"`
+	Skipped    int    `json:"skipped,omitempty"`
+	Failed     int    `json:"failed"`
+	Iterations int    `json:"iterations"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type jsonMessage struct {
+	jsonHeader
+	Message  string `json:"message"`
+	ExitCode int    `json:"exit_code,omitempty"`
+}
+
+// Handle implements Sink.
+func (p *JSONPrinter) Handle(e Event) {
+	switch e := e.(type) {
+	case RunStart:
+		h := p.header("run_start")
+		p.start = h.Time
+		p.write(jsonRunStart{h, e.PRD, e.Profile, e.Total, e.Completed, e.Pending})
+
+	case TaskStart:
+		p.write(jsonTaskStart{p.header("task_start"), e.Index, e.Total, e.Title, e.Profile})
+
+	case IterationStart:
+		p.task, p.iteration = e.Task, e.Iteration
+		p.write(jsonIteration{p.header("iteration"), e.Task, e.Iteration, e.MaxIterations})
+
+	case AgentExit:
+		p.write(jsonAgentExit{
+			jsonHeader: p.header("agent_exit"),
+			Task:       p.task,
+			Iteration:  p.iteration,
+			ExitCode:   e.ExitCode,
+			DurationMS: e.Duration.Milliseconds(),
+			Usage:      usageJSON(e.Usage),
+			Error:      errorString(e.Err),
+			Timeout:    IsTimeout(e.Err),
+		})
+
+	case ValidationResult:
+		v := jsonValidation{
+			jsonHeader:    p.header("validation"),
+			Task:          p.task,
+			Iteration:     p.iteration,
+			Success:       e.Success,
+			DurationMS:    e.Duration.Milliseconds(),
+			Error:         errorString(e.Err),
+			Timeout:       IsTimeout(e.Err),
+			KnownFailures: e.KnownFailures,
+		}
+		for _, s := range e.Stages {
+			v.Stages = append(v.Stages, jsonStage{s.Name, s.Success, s.Skipped, s.ExitCode, s.Duration.Milliseconds()})
+		}
+		v.Tests = testsJSON(e.Report)
+		p.write(v)
+
+	case Baseline:
+		p.write(jsonBaseline{p.header("baseline"), e.Task, e.Result.Success, e.Skipped, testsJSON(e.Result.Report)})
+
+	case IntegrityViolation:
+		p.write(jsonIntegrity{p.header("integrity"), e.Task, e.Iteration, e.Issues, e.Accepted})
+
+	case TaskComplete:
+		p.tasks++
+		p.iterations += e.Iterations
+		switch {
+		case e.Skipped:
+			p.skipped++
+		case e.Err == nil:
+			p.passed++
+		}
+		p.write(jsonTaskComplete{p.header("task_complete"), e.Title, e.Iterations, e.Err == nil, e.Skipped, errorString(e.Err)})
+
+	case RunComplete:
+		c := jsonRunComplete{
+			jsonHeader: p.header("run_complete"),
+			Success:    e.Err == nil,
+			Error:      errorString(e.Err),
+			Tasks:      p.tasks,
+			Passed:     p.passed,
+			Skipped:    p.skipped,
+			Failed:     p.tasks - p.passed - p.skipped,
+			Iterations: p.iterations,
+		}
+		if !p.start.IsZero() {
+			c.DurationMS = c.Time.Sub(p.start).Milliseconds()
+		}
+		if e.Err != nil {
+			c.ExitCode = 1
+			if p.ExitCode != nil {
+				c.ExitCode = p.ExitCode(e.Err)
+			}
+		}
+		p.write(c)
+
+	case Warning:
+		p.write(jsonMessage{jsonHeader: p.header("warning"), Message: e.Message})
+	}
+}
+
+// Error writes an error event for a failure outside the run, e.g. an
+// invalid config, with the exit status tatsu is about to exit with.
+func (p *JSONPrinter) Error(message string, exitCode int) {
+	p.write(jsonMessage{p.header("error"), message, exitCode})
+}
+
+func (p *JSONPrinter) header(typ string) jsonHeader {
+	return jsonHeader{Type: typ, Time: p.now().UTC()}
+}
+
+// write encodes v as one line. Encoding these types cannot fail, and a
+// write error (closed pipe) is not worth stopping the run for.
+func (p *JSONPrinter) write(v any) {
+	_ = p.enc.Encode(v)
+}
+
+func usageJSON(u *harness.Usage) *jsonUsage {
+	if u == nil {
+		return nil
+	}
+	return &jsonUsage{u.InputTokens, u.OutputTokens, u.TotalTokens, u.CostUSD}
+}
+
+func testsJSON(r *testresult.Report) *jsonTests {
+	if r == nil || r.Total() == 0 {
+		return nil
+	}
+	tests := &jsonTests{Passed: r.Passed, Failed: r.Failed, Skipped: r.Skipped}
+	for _, t := range r.Failing() {
+		tests.Failing = append(tests.Failing, t.Name)
+	}
+	return tests
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
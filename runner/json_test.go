@@ -0,0 +1,105 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jack/tatsu/harness"
+	"github.com/jack/tatsu/testresult"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONPrinter(t *testing.T) {
+	var out bytes.Buffer
+	p := NewJSONPrinter(&out)
+	clock := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	p.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	p.ExitCode = func(error) int { return 3 }
+
+	for _, e := range []Event{
+		RunStart{Total: 1, Pending: 1, Profile: "fast"},
+		TaskStart{Index: 1, Total: 1, Title: "task", Profile: "fast"},
+		IterationStart{Task: "task", Iteration: 1, MaxIterations: 3, Prompt: "task"},
+		AgentLine{Stream: Stdout, Line: "working"},
+		AgentExit{ExitCode: 0, Duration: 1500 * time.Millisecond, Usage: &harness.Usage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}},
+		ValidationResult{
+			Duration: 2 * time.Second,
+			Stages:   []StageResult{{Name: "test", ExitCode: 1, Duration: 2 * time.Second}},
+			Report:   &testresult.Report{Tests: []testresult.Test{{Name: "TestA", Status: testresult.Failed}}, Passed: 2, Failed: 1},
+		},
+		TaskComplete{Title: "task", Iterations: 1, Err: ErrMaxIterations},
+		RunComplete{Err: ErrMaxIterations},
+	} {
+		p.Handle(e)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 7, "agent output is not written")
+	assert.Equal(t, `{"type":"run_start","time":"2026-10-17T12:00:01Z","profile":"fast","total":1,"completed":0,"pending":1}`, lines[0])
+	assert.Equal(t, `{"type":"task_start","time":"2026-10-17T12:00:02Z","index":1,"total":1,"title":"task","profile":"fast"}`, lines[1])
+	assert.Equal(t, `{"type":"iteration","time":"2026-10-17T12:00:03Z","task":"task","iteration":1,"max_iterations":3}`, lines[2])
+	assert.Equal(t, `{"type":"agent_exit","time":"2026-10-17T12:00:04Z","task":"task","iteration":1,"exit_code":0,"duration_ms":1500,`+
+		`"usage":{"input_tokens":10,"output_tokens":5,"total_tokens":15}}`, lines[3])
+	assert.Equal(t, `{"type":"validation","time":"2026-10-17T12:00:05Z","task":"task","iteration":1,"success":false,"duration_ms":2000,`+
+		`"stages":[{"name":"test","success":false,"exit_code":1,"duration_ms":2000}],"tests":{"passed":2,"failed":1,"skipped":0,"failing":["TestA"]}}`, lines[4])
+	assert.Equal(t, `{"type":"task_complete","time":"2026-10-17T12:00:06Z","title":"task","iterations":1,"success":false,"error":"max iterations reached"}`, lines[5])
+
+	var summary map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[6]), &summary))
+	assert.Equal(t, map[string]any{
+		"type": "run_complete", "time": "2026-10-17T12:00:07Z",
+		"success": false, "error": "max iterations reached", "exit_code": 3.0,
+		"tasks": 1.0, "passed": 0.0, "failed": 1.0, "iterations": 1.0, "duration_ms": 6000.0,
+	}, summary)
+}
+
+func TestJSONPrinter_Error(t *testing.T) {
+	var out bytes.Buffer
+	p := NewJSONPrinter(&out)
+	p.Handle(AgentExit{ExitCode: -1, Err: &TimeoutError{Step: "agent", Timeout: time.Minute}})
+	p.Handle(Warning{Message: "careful"})
+	p.Error("tatsu.yaml: agent.command is required", 4)
+
+	var events []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var e map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		delete(e, "time")
+		events = append(events, e)
+	}
+	assert.Equal(t, []map[string]any{
+		{"type": "agent_exit", "task": "", "iteration": 0.0, "exit_code": -1.0, "duration_ms": 0.0, "error": "agent timed out after 1m0s", "timeout": true},
+		{"type": "warning", "message": "careful"},
+		{"type": "error", "message": "tatsu.yaml: agent.command is required", "exit_code": 4.0},
+	}, events)
+}
+
+func TestJSONPrinter_Baseline(t *testing.T) {
+	var out bytes.Buffer
+	p := NewJSONPrinter(&out)
+	p.now = func() time.Time { return time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC) }
+
+	p.Handle(Baseline{Task: "task", Result: ValidationResult{Report: &testresult.Report{
+		Tests:  []testresult.Test{{Name: "TestA", Status: testresult.Failed}},
+		Passed: 3, Failed: 1,
+	}}})
+	p.Handle(Baseline{Task: "done", Result: ValidationResult{Success: true}, Skipped: true})
+	p.Handle(IntegrityViolation{Task: "task", Iteration: 2, Issues: []string{"TestB was removed"}})
+	p.Handle(TaskComplete{Title: "done", Skipped: true})
+	p.Handle(RunComplete{})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 5)
+	assert.Equal(t, `{"type":"baseline","time":"2026-10-17T12:00:00Z","task":"task","success":false,"tests":{"passed":3,"failed":1,"skipped":0,"failing":["TestA"]}}`, lines[0])
+	assert.Equal(t, `{"type":"baseline","time":"2026-10-17T12:00:00Z","task":"done","success":true,"skipped":true}`, lines[1])
+	assert.Equal(t, `{"type":"integrity","time":"2026-10-17T12:00:00Z","task":"task","iteration":2,"issues":["TestB was removed"],"accepted":false}`, lines[2])
+	assert.Equal(t, `{"type":"task_complete","time":"2026-10-17T12:00:00Z","title":"done","iterations":0,"success":true,"skipped":true}`, lines[3])
+	assert.Equal(t, `{"type":"run_complete","time":"2026-10-17T12:00:00Z","success":true,"exit_code":0,"tasks":1,"passed":0,"skipped":1,"failed":0,"iterations":0,"duration_ms":0}`, lines[4])
+}
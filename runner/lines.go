@@ -0,0 +1,48 @@
+package runner
+
+import (
+	"bytes"
+	"strings"
+)
+
+// maxLineLength bounds a single buffered line; longer output is emitted in chunks.
+const maxLineLength = 64 * 1024
+
+// lineWriter is an io.Writer that emits each complete line written to it as
+// an AgentLine event. Flush emits a trailing partial line.
+type lineWriter struct {
+	r      *Runner
+	stream Stream
+	buf    bytes.Buffer
+}
+
+func (r *Runner) lineWriter(stream Stream) *lineWriter {
+	return &lineWriter{r: r, stream: stream}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			if w.buf.Len() > maxLineLength {
+				w.emit(string(w.buf.Next(maxLineLength)))
+			}
+			return len(p), nil
+		}
+		line := w.buf.Next(i + 1)
+		w.emit(string(line[:i]))
+	}
+}
+
+// Flush emits any buffered partial line.
+func (w *lineWriter) Flush() {
+	if w.buf.Len() > 0 {
+		w.emit(w.buf.String())
+		w.buf.Reset()
+	}
+}
+
+func (w *lineWriter) emit(line string) {
+	w.r.Emit(AgentLine{Stream: w.stream, Line: w.r.scrub(strings.TrimSuffix(line, "\r"))})
+}
@@ -0,0 +1,215 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jack/tatsu/harness"
+)
+
+// Printer is the CLI sink: it writes human-readable progress lines and
+// streams agent output as it arrives.
+type Printer struct {
+	out     io.Writer
+	errOut  io.Writer
+	prd     bool
+	empty   bool   // PRD had nothing to do
+	skipped int    // tasks skipped because validation already passed
+	profile string // the run's profile
+}
+
+// NewPrinter creates a Printer writing progress and agent stdout to out and
+// agent stderr to errOut.
+func NewPrinter(out, errOut io.Writer) *Printer {
+	return &Printer{out: out, errOut: errOut}
+}
+
+// Handle implements Sink.
+func (p *Printer) Handle(e Event) {
+	switch e := e.(type) {
+	case RunStart:
+		p.prd = e.PRD != ""
+		p.empty = e.Pending == 0
+		p.profile = e.Profile
+		if !p.prd {
+			return
+		}
+		if e.Pending == 0 {
+			fmt.Fprintln(p.out, "✅ All tasks are already completed!")
+			return
+		}
+		if e.Profile != "" {
+			fmt.Fprintf(p.out, "🎛️  Profile: %s\n\n", e.Profile)
+		}
+		fmt.Fprintf(p.out, "📋 PRD Summary:\n")
+		fmt.Fprintf(p.out, "   Total tasks: %d\n", e.Total)
+		fmt.Fprintf(p.out, "   Completed: %d\n", e.Completed)
+		fmt.Fprintf(p.out, "   Remaining: %d\n\n", e.Pending)
+
+	case TaskStart:
+		if !p.prd {
+			break
+		}
+		if e.Profile != p.profile && e.Profile != "" {
+			fmt.Fprintf(p.out, "📌 Task %d/%d: %s (profile: %s)\n\n", e.Index, e.Total, e.Title, e.Profile)
+		} else {
+			fmt.Fprintf(p.out, "📌 Task %d/%d: %s\n\n", e.Index, e.Total, e.Title)
+		}
+
+	case Resumed:
+		fmt.Fprintf(p.out, "⏯️  Resuming run %s at iteration %d/%d\n", e.RunID, e.Iteration, e.MaxIterations)
+
+	case IterationStart:
+		fmt.Fprintf(p.out, "🔁 Iteration %d/%d\n", e.Iteration, e.MaxIterations)
+
+	case AgentLine:
+		if e.Stream == Stderr {
+			fmt.Fprintln(p.errOut, e.Line)
+		} else {
+			fmt.Fprintln(p.out, e.Line)
+		}
+
+	case AgentExit:
+		if e.Usage != nil {
+			fmt.Fprintf(p.out, "🪙 %s\n", FormatUsage(e.Usage))
+		}
+		switch {
+		case e.Err == nil:
+		case IsTimeout(e.Err):
+			fmt.Fprintf(p.out, "⏱️  %v\n", e.Err)
+		default:
+			fmt.Fprintf(p.out, "⚠️  Agent error: %v\n", e.Err)
+		}
+
+	case SessionStarted:
+		fmt.Fprintf(p.out, "💬 Agent session %s\n", e.SessionID)
+
+	case ValidationResult:
+		if e.Success {
+			if line := e.TestSummary(); line != "" {
+				fmt.Fprintf(p.out, "🧪 Tests: %s\n", line)
+			}
+			if len(e.KnownFailures) > 0 {
+				fmt.Fprintf(p.out, "⚠️  Ignored failures present before the task: %s\n", strings.Join(e.KnownFailures, ", "))
+			}
+			return
+		}
+		fmt.Fprintf(p.out, "\n📋 Validation output:\n%s\n", e.Output)
+		if line := e.TestSummary(); line != "" {
+			fmt.Fprintf(p.out, "🧪 Tests: %s\n", line)
+		}
+		if len(e.Stages) > 1 {
+			p.printStages(e.Stages)
+		}
+		if e.Err != nil {
+			fmt.Fprintf(p.out, "⏱️  %v\n\n", e.Err)
+		} else {
+			fmt.Fprintf(p.out, "❌ Validation failed\n\n")
+		}
+
+	case Baseline:
+		state := "passing"
+		if !e.Result.Success {
+			state = "failing"
+		}
+		if line := e.Result.TestSummary(); line != "" {
+			state += " (" + line + ")"
+		}
+		fmt.Fprintf(p.out, "📏 Baseline: %s\n", state)
+		if e.Skipped {
+			fmt.Fprintln(p.out, "⏭️  Validation already passes, task skipped")
+		}
+
+	case IntegrityViolation:
+		fmt.Fprintf(p.out, "🔍 Validation passed, but the tests changed:\n")
+		for _, issue := range e.Issues {
+			fmt.Fprintf(p.out, "   - %s\n", issue)
+		}
+		if e.Accepted {
+			fmt.Fprintln(p.out, "✅ Test changes accepted")
+		} else {
+			fmt.Fprintf(p.out, "❌ Test changes not accepted, asking the agent to restore the tests\n\n")
+		}
+
+	case GuardViolation:
+		fmt.Fprintf(p.out, "🛡️  Agent changed protected files:\n")
+		for _, c := range e.Changes {
+			fmt.Fprintf(p.out, "   %s\n", c)
+		}
+		switch {
+		case e.Err != nil:
+			fmt.Fprintf(p.out, "⚠️  Reverting them failed: %v\n", e.Err)
+		case e.Reverted:
+			fmt.Fprintln(p.out, "↩️  Reverted")
+		}
+
+	case NoProgress:
+		fmt.Fprintf(p.out, "🐢 No progress for %d iteration(s) (giving up at %d)\n\n", e.Iterations, e.Patience)
+
+	case TaskComplete:
+		if e.Skipped {
+			p.skipped++
+			if p.prd {
+				fmt.Fprintln(p.out)
+			}
+		} else if e.Err == nil {
+			fmt.Fprintln(p.out, "\n✅ Task completed successfully!")
+			if p.prd {
+				fmt.Fprintln(p.out)
+			}
+		}
+
+	case RunComplete:
+		if p.prd && !p.empty && e.Err == nil {
+			if p.skipped > 0 {
+				fmt.Fprintf(p.out, "✅ All PRD tasks completed successfully! (%d skipped: validation already passed)\n", p.skipped)
+			} else {
+				fmt.Fprintln(p.out, "✅ All PRD tasks completed successfully!")
+			}
+		}
+
+	case CheckpointCreated:
+		fmt.Fprintf(p.out, "📸 Checkpoint %s\n", e.Name)
+
+	case RolledBack:
+		if e.Err != nil {
+			fmt.Fprintf(p.out, "⚠️  Rollback to %s failed: %v\n", e.Name, e.Err)
+		} else {
+			fmt.Fprintf(p.out, "↩️  Rolled back working tree to checkpoint %s\n", e.Name)
+		}
+
+	case Warning:
+		fmt.Fprintf(p.out, "⚠️  %s\n", e.Message)
+	}
+}
+
+// printStages writes a one-line summary per validation stage.
+func (p *Printer) printStages(stages []StageResult) {
+	for _, s := range stages {
+		switch {
+		case s.Skipped:
+			fmt.Fprintf(p.out, "   ⏭️  %s (skipped)\n", s.Name)
+		case s.Success:
+			fmt.Fprintf(p.out, "   ✅ %s (%s)\n", s.Name, s.Duration.Round(time.Millisecond))
+		default:
+			fmt.Fprintf(p.out, "   ❌ %s (exit %d, %s)\n", s.Name, s.ExitCode, s.Duration.Round(time.Millisecond))
+		}
+	}
+}
+
+// FormatUsage describes token usage, e.g. "2300 in / 150 out tokens, $0.0100".
+func FormatUsage(u *harness.Usage) string {
+	var s string
+	switch {
+	case u.InputTokens > 0 || u.OutputTokens > 0:
+		s = fmt.Sprintf("%d in / %d out tokens", u.InputTokens, u.OutputTokens)
+	default:
+		s = fmt.Sprintf("%d tokens", u.TotalTokens)
+	}
+	if u.CostUSD > 0 {
+		s += fmt.Sprintf(", $%.4f", u.CostUSD)
+	}
+	return s
+}
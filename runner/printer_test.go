@@ -0,0 +1,182 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jack/tatsu/harness"
+	"github.com/jack/tatsu/testresult"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrinter_TaskRun(t *testing.T) {
+	var out, errOut bytes.Buffer
+	p := NewPrinter(&out, &errOut)
+
+	for _, e := range []Event{
+		RunStart{Total: 1, Pending: 1},
+		TaskStart{Index: 1, Total: 1, Title: "task"},
+		IterationStart{Task: "task", Iteration: 1, MaxIterations: 3},
+		AgentLine{Stream: Stdout, Line: "working"},
+		AgentLine{Stream: Stderr, Line: "warning"},
+		AgentExit{ExitCode: 1, Err: errors.New("exit status 1")},
+		ValidationStart{},
+		ValidationResult{Success: false, Output: "FAIL"},
+		IterationStart{Task: "task", Iteration: 2, MaxIterations: 3},
+		ValidationResult{Success: true},
+		TaskComplete{Title: "task", Iterations: 2},
+		RunComplete{},
+	} {
+		p.Handle(e)
+	}
+
+	expected := "🔁 Iteration 1/3\n" +
+		"working\n" +
+		"⚠️  Agent error: exit status 1\n" +
+		"\n📋 Validation output:\nFAIL\n" +
+		"❌ Validation failed\n\n" +
+		"🔁 Iteration 2/3\n" +
+		"\n✅ Task completed successfully!\n"
+	assert.Equal(t, expected, out.String())
+	assert.Equal(t, "warning\n", errOut.String())
+}
+
+func TestPrinter_PRDRun(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out)
+
+	p.Handle(RunStart{PRD: "prd.md", Total: 3, Completed: 1, Pending: 2})
+	p.Handle(TaskStart{Index: 1, Total: 2, Title: "first"})
+	p.Handle(TaskComplete{Title: "first", Iterations: 1})
+	p.Handle(RunComplete{})
+
+	assert.Contains(t, out.String(), "📋 PRD Summary:\n   Total tasks: 3\n   Completed: 1\n   Remaining: 2\n")
+	assert.Contains(t, out.String(), "📌 Task 1/2: first\n")
+	assert.Contains(t, out.String(), "✅ All PRD tasks completed successfully!\n")
+}
+
+func TestPrinter_Profile(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out)
+
+	p.Handle(RunStart{PRD: "prd.md", Profile: "fast", Total: 2, Pending: 2})
+	p.Handle(TaskStart{Index: 1, Total: 2, Title: "first", Profile: "fast"})
+	p.Handle(TaskStart{Index: 2, Total: 2, Title: "second", Profile: "thorough"})
+
+	assert.True(t, strings.HasPrefix(out.String(), "🎛️  Profile: fast\n\n📋 PRD Summary:"))
+	assert.Contains(t, out.String(), "📌 Task 1/2: first\n")
+	assert.Contains(t, out.String(), "📌 Task 2/2: second (profile: thorough)\n")
+}
+
+func TestPrinter_PRDAlreadyComplete(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out)
+
+	p.Handle(RunStart{PRD: "prd.md", Total: 2, Completed: 2})
+	p.Handle(RunComplete{})
+
+	assert.Equal(t, "✅ All tasks are already completed!\n", out.String())
+}
+
+func TestPrinter_Timeouts(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out)
+
+	p.Handle(AgentExit{ExitCode: -1, Err: &TimeoutError{Step: "agent", Timeout: time.Second}})
+	p.Handle(ValidationResult{Output: "partial", Err: &TimeoutError{Step: "validation", Timeout: time.Minute}})
+
+	assert.Contains(t, out.String(), "⏱️  agent timed out after 1s\n")
+	assert.Contains(t, out.String(), "⏱️  validation timed out after 1m0s\n")
+}
+
+func TestPrinter_StageSummary(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out)
+
+	p.Handle(ValidationResult{
+		Output: "combined",
+		Stages: []StageResult{
+			{Name: "build", Success: true, Duration: 1500 * time.Millisecond},
+			{Name: "test", ExitCode: 1, Duration: 2 * time.Second},
+			{Name: "lint", Skipped: true},
+		},
+	})
+
+	assert.Contains(t, out.String(), "   ✅ build (1.5s)\n   ❌ test (exit 1, 2s)\n   ⏭️  lint (skipped)\n")
+}
+
+func TestPrinter_TestSummary(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out)
+
+	p.Handle(ValidationResult{
+		Output:         "output",
+		Report:         &testresult.Report{Passed: 10, Failed: 3, Skipped: 1},
+		PreviousReport: &testresult.Report{Passed: 1, Failed: 12},
+	})
+
+	assert.Contains(t, out.String(), "🧪 Tests: 10 passed, 3 failed, 1 skipped (failing: 12 → 3)\n")
+}
+
+func TestPrinter_NoProgress(t *testing.T) {
+	var out bytes.Buffer
+	NewPrinter(&out, &out).Handle(NoProgress{Iterations: 2, Patience: 3})
+
+	assert.Equal(t, "🐢 No progress for 2 iteration(s) (giving up at 3)\n\n", out.String())
+}
+
+func TestPrinter_Usage(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out)
+
+	p.Handle(AgentExit{Usage: &harness.Usage{InputTokens: 2300, OutputTokens: 150, CostUSD: 0.01}})
+	p.Handle(AgentExit{Usage: &harness.Usage{TotalTokens: 900}})
+
+	assert.Equal(t, "🪙 2300 in / 150 out tokens, $0.0100\n🪙 900 tokens\n", out.String())
+}
+
+func TestPrinter_SessionStarted(t *testing.T) {
+	var out bytes.Buffer
+	NewPrinter(&out, &out).Handle(SessionStarted{Task: "task", Iteration: 1, SessionID: "ses_1"})
+	assert.Equal(t, "💬 Agent session ses_1\n", out.String())
+}
+
+func TestPrinter_GuardViolation(t *testing.T) {
+	var out bytes.Buffer
+	NewPrinter(&out, &out).Handle(GuardViolation{Changes: []string{"modified a_test.go", "deleted b_test.go"}, Reverted: true})
+	assert.Equal(t, "🛡️  Agent changed protected files:\n   modified a_test.go\n   deleted b_test.go\n↩️  Reverted\n", out.String())
+}
+
+func TestPrinter_Integrity(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out)
+	p.Handle(Baseline{Result: ValidationResult{Report: &testresult.Report{Passed: 1, Failed: 1}}})
+	p.Handle(IntegrityViolation{Issues: []string{"TestA is missing"}})
+	assert.Equal(t, "📏 Baseline: failing (1 passed, 1 failed, 0 skipped)\n"+
+		"🔍 Validation passed, but the tests changed:\n   - TestA is missing\n"+
+		"❌ Test changes not accepted, asking the agent to restore the tests\n\n", out.String())
+}
+
+func TestPrinter_SkippedTasks(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out)
+	p.Handle(RunStart{PRD: "PRD.md", Total: 2, Pending: 2})
+	out.Reset()
+	p.Handle(TaskComplete{Title: "done already", Skipped: true})
+	p.Handle(TaskComplete{Title: "done now", Iterations: 1})
+	p.Handle(RunComplete{})
+	assert.Equal(t, "\n\n✅ Task completed successfully!\n\n"+
+		"✅ All PRD tasks completed successfully! (1 skipped: validation already passed)\n", out.String())
+}
+
+func TestPrinter_Baseline(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out)
+	p.Handle(Baseline{Result: ValidationResult{Success: true}, Skipped: true})
+	p.Handle(ValidationResult{Success: true, KnownFailures: []string{"TestA", "TestB"}})
+	assert.Equal(t, "📏 Baseline: passing\n⏭️  Validation already passes, task skipped\n"+
+		"⚠️  Ignored failures present before the task: TestA, TestB\n", out.String())
+}
@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/harness"
+)
+
+// ProfileLoader returns the config with the named profile applied (see
+// config.Options.Profile).
+type ProfileLoader func(name string) (*config.Config, error)
+
+// SetProfiles sets how a PRD task that asks for another profile than the
+// run's gets its config. Without it such tasks fail.
+func (r *Runner) SetProfiles(load ProfileLoader) {
+	r.profiles = load
+}
+
+// Profile returns the profile of the runner's config, if any.
+func (r *Runner) Profile() string {
+	return r.config.Profile
+}
+
+// UseProfile switches the rest of the run to the named profile's config,
+// harness and iteration budget, loaded with SetProfiles' loader.
+func (r *Runner) UseProfile(name string) error {
+	_, err := r.useProfile(name)
+	return err
+}
+
+// useProfile switches the config, harness and iteration budget to the
+// named profile's, and returns the function that switches them back.
+func (r *Runner) useProfile(name string) (func(), error) {
+	if r.profiles == nil {
+		return nil, fmt.Errorf("profile %s: profiles are not available in this run", name)
+	}
+	cfg, err := r.profiles(name)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	newHarness := r.newHarness
+	if newHarness == nil {
+		newHarness = availableHarness
+	}
+	h, err := newHarness(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+
+	prevConfig, prevHarness, prevMax := r.config, r.harness, r.maxIterations
+	r.config, r.harness = cfg, h
+	if cfg.MaxIterations > 0 {
+		r.maxIterations = cfg.MaxIterations
+	}
+	return func() {
+		r.config, r.harness, r.maxIterations = prevConfig, prevHarness, prevMax
+	}, nil
+}
+
+// availableHarness creates the harness for cfg and checks that its CLI is
+// installed.
+func availableHarness(cfg *config.Config) (harness.Harness, error) {
+	h, err := harness.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !h.IsAvailable() {
+		return nil, fmt.Errorf("%s is not installed or not in PATH", h.Name())
+	}
+	return h, nil
+}
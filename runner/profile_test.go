@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPRDTask_Profile(t *testing.T) {
+	cfg := &config.Config{Profile: "fast"}
+	cfg.Agent.Command = "true %s"
+	cfg.Validate.Command = "exit 1"
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+	r.newHarness = func(cfg *config.Config) (harness.Harness, error) { return newMockHarness(cfg), nil }
+
+	err := r.RunPRDTask(context.Background(), "task", PRDContext{Profile: "thorough"})
+	assert.ErrorContains(t, err, "profile thorough: profiles are not available")
+
+	r.SetProfiles(func(name string) (*config.Config, error) {
+		if name != "thorough" {
+			return nil, errors.New("unknown profile")
+		}
+		p := &config.Config{Profile: name, MaxIterations: 4}
+		p.Agent.Command = "true %s"
+		p.Validate.Command = "exit 0"
+		return p, nil
+	})
+	rec := &recorder{}
+	r.Subscribe(rec)
+	require.NoError(t, r.RunPRDTask(context.Background(), "task", PRDContext{Profile: "thorough"}))
+	for _, e := range rec.events {
+		if start, ok := e.(IterationStart); ok {
+			assert.Equal(t, 4, start.MaxIterations, "the profile's iteration budget")
+		}
+	}
+	assert.Same(t, cfg, r.Config(), "the run's config is restored after the task")
+	assert.Equal(t, 2, r.maxIterations)
+
+	assert.ErrorIs(t, r.RunPRDTask(context.Background(), "task", PRDContext{Profile: "fast"}), ErrMaxIterations,
+		"the run's own profile is not reloaded")
+
+	err = r.RunPRDTask(context.Background(), "task", PRDContext{Profile: "slow"})
+	assert.ErrorContains(t, err, "profile slow: unknown profile")
+	assert.Equal(t, "TaskComplete", rec.kinds()[len(rec.kinds())-1])
+}
+
+func TestUseProfile(t *testing.T) {
+	cfg := &config.Config{}
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+	r.newHarness = func(cfg *config.Config) (harness.Harness, error) { return newMockHarness(cfg), nil }
+	r.SetProfiles(func(name string) (*config.Config, error) {
+		return &config.Config{Profile: name}, nil
+	})
+	require.NoError(t, r.UseProfile("thorough"))
+	assert.Equal(t, "thorough", r.Profile())
+	assert.Equal(t, 2, r.maxIterations, "max_iterations not set")
+}
@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jack/tatsu/config"
+)
+
+// PromptData is the data available to the prompt templates (see
+// config.PromptVars).
+type PromptData struct {
+	Task                 string
+	Iteration            int
+	MaxIterations        int
+	LastValidationOutput string
+	// FailedStages names the validation stages that failed, comma separated.
+	// Empty for single-stage validation.
+	FailedStages string
+	// PRDTitle and PRDSection locate the task in its PRD. Empty for a
+	// single task.
+	PRDTitle   string
+	PRDSection string
+	// ChangedFiles lists the files changed since the task started, one per
+	// line. Empty outside a git repo.
+	ChangedFiles string
+}
+
+// Vars returns the data as template variables, for command templates.
+func (d PromptData) Vars() map[string]interface{} {
+	return map[string]interface{}{
+		"Task":                 d.Task,
+		"Iteration":            d.Iteration,
+		"MaxIterations":        d.MaxIterations,
+		"LastValidationOutput": d.LastValidationOutput,
+		"FailedStages":         d.FailedStages,
+		"PRDTitle":             d.PRDTitle,
+		"PRDSection":           d.PRDSection,
+		"ChangedFiles":         d.ChangedFiles,
+	}
+}
+
+// BuildPrompt returns the prompt to send to the agent for an iteration.
+// The first iteration gets agent.prompt, or the bare task; later
+// iterations get the retry prompt with the (trimmed) output of the
+// previous validation run.
+func BuildPrompt(cfg *config.Config, data PromptData) (string, error) {
+	name, text := "prompt", cfg.Agent.Prompt
+	if data.Iteration <= 1 {
+		if text == "" {
+			return data.Task, nil
+		}
+	} else {
+		name, text = "retry_prompt", cfg.Agent.RetryPrompt
+		if text == "" {
+			text = config.DefaultRetryPrompt
+		}
+	}
+	tmpl, err := config.ParseTemplate(name, text)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", name, err)
+	}
+
+	maxBytes := cfg.Agent.Feedback.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = config.DefaultFeedbackMaxBytes
+	}
+	maxLines := cfg.Agent.Feedback.MaxLines
+	if maxLines == 0 {
+		maxLines = config.DefaultFeedbackMaxLines
+	}
+	data.LastValidationOutput = TrimOutput(data.LastValidationOutput, maxBytes, maxLines)
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render %s: %w", name, err)
+	}
+	return b.String(), nil
+}
+
+// TrimOutput keeps the tail of output within maxLines lines and maxBytes bytes.
+// The end of a test or build log usually holds the failure summary, so the
+// beginning is dropped and replaced with a marker. A limit <= 0 is ignored.
+func TrimOutput(output string, maxBytes, maxLines int) string {
+	output = strings.TrimRight(output, "\n")
+	trimmed := false
+
+	if maxLines > 0 {
+		lines := strings.Split(output, "\n")
+		if len(lines) > maxLines {
+			output = strings.Join(lines[len(lines)-maxLines:], "\n")
+			trimmed = true
+		}
+	}
+
+	if maxBytes > 0 && len(output) > maxBytes {
+		cut := len(output) - maxBytes
+		// Never start inside a multi-byte character
+		for cut < len(output) && !utf8.RuneStart(output[cut]) {
+			cut++
+		}
+		output = output[cut:]
+		// Drop the partial first line so the output starts cleanly
+		if i := strings.IndexByte(output, '\n'); i >= 0 && i < len(output)-1 {
+			output = output[i+1:]
+		}
+		trimmed = true
+	}
+
+	if trimmed {
+		return "... (earlier output trimmed)\n" + output
+	}
+	return output
+}
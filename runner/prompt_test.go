@@ -0,0 +1,133 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jack/tatsu/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildPrompt_FirstIterationIsTask(t *testing.T) {
+	cfg := &config.Config{}
+
+	prompt, err := BuildPrompt(cfg, PromptData{Task: "fix the parser", Iteration: 1, MaxIterations: 5})
+	require.NoError(t, err)
+	assert.Equal(t, "fix the parser", prompt)
+}
+
+func TestBuildPrompt_RetryIncludesValidationOutput(t *testing.T) {
+	cfg := &config.Config{}
+
+	prompt, err := BuildPrompt(cfg, PromptData{
+		Task:                 "fix the parser",
+		Iteration:            2,
+		MaxIterations:        5,
+		LastValidationOutput: "--- FAIL: TestParse",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, prompt, "fix the parser")
+	assert.Contains(t, prompt, "attempt 2 of 5")
+	assert.Contains(t, prompt, "--- FAIL: TestParse")
+}
+
+func TestBuildPrompt_CustomTemplate(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.RetryPrompt = "{{.Task}} (try {{.Iteration}}): {{.LastValidationOutput}}"
+
+	prompt, err := BuildPrompt(cfg, PromptData{
+		Task:                 "task",
+		Iteration:            3,
+		MaxIterations:        5,
+		LastValidationOutput: "boom",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "task (try 3): boom", prompt)
+}
+
+func TestBuildPrompt_FirstIterationTemplate(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Prompt = "[{{.PRDTitle}} > {{.PRDSection}}] {{.Task}} ({{.Iteration}}/{{.MaxIterations}})"
+
+	prompt, err := BuildPrompt(cfg, PromptData{Task: "task", Iteration: 1, MaxIterations: 5, PRDTitle: "Shop", PRDSection: "Cart"})
+	require.NoError(t, err)
+	assert.Equal(t, "[Shop > Cart] task (1/5)", prompt)
+
+	// Retries still use the retry prompt
+	prompt, err = BuildPrompt(cfg, PromptData{Task: "task", Iteration: 2, MaxIterations: 5})
+	require.NoError(t, err)
+	assert.Contains(t, prompt, "This is attempt 2 of 5")
+}
+
+func TestBuildPrompt_TrimsFeedback(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.RetryPrompt = "{{.LastValidationOutput}}"
+	cfg.Agent.Feedback.MaxLines = 2
+
+	prompt, err := BuildPrompt(cfg, PromptData{
+		Task:                 "task",
+		Iteration:            2,
+		LastValidationOutput: "one\ntwo\nthree\n",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "... (earlier output trimmed)\ntwo\nthree", prompt)
+}
+
+func TestBuildPrompt_InvalidTemplate(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.RetryPrompt = "{{.Task"
+
+	_, err := BuildPrompt(cfg, PromptData{Task: "task", Iteration: 2})
+	require.Error(t, err)
+}
+
+func TestTrimOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		maxBytes int
+		maxLines int
+		expected string
+	}{
+		{
+			name:     "within limits",
+			input:    "ok\n",
+			maxBytes: 100,
+			maxLines: 10,
+			expected: "ok",
+		},
+		{
+			name:     "line limit keeps tail",
+			input:    "a\nb\nc\nd",
+			maxLines: 2,
+			expected: "... (earlier output trimmed)\nc\nd",
+		},
+		{
+			name:     "byte limit drops partial line",
+			input:    "first line\nsecond\nthird",
+			maxBytes: 10,
+			expected: "... (earlier output trimmed)\nthird",
+		},
+		{
+			name:     "byte limit keeps whole characters",
+			input:    "échec: ünïcode ✗✗✗",
+			maxBytes: 7,
+			expected: "... (earlier output trimmed)\n✗✗",
+		},
+		{
+			name:     "no limits",
+			input:    strings.Repeat("x\n", 50),
+			expected: strings.TrimRight(strings.Repeat("x\n", 50), "\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TrimOutput(tt.input, tt.maxBytes, tt.maxLines)
+			assert.Equal(t, tt.expected, got)
+			assert.True(t, utf8.ValidString(got))
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package runner
+
+import "fmt"
+
+// ResumeState is where an interrupted run left off, as read back from its
+// journal.
+type ResumeState struct {
+	RunID string
+	// Task is the 1-based number of the task to continue; Title its title.
+	Task  int
+	Title string
+	// Iteration is the number of iterations of the task that completed
+	// validation. The task continues at Iteration+1, so the iteration budget
+	// is not reset.
+	Iteration            int
+	LastValidationOutput string
+	FailedStages         []string
+	// SessionID is the agent session to continue and SessionStart the
+	// iteration it started in. Empty if the harness keeps no sessions.
+	SessionID    string
+	SessionStart int
+	// StartTree and Baseline are the git tree and the baseline validation
+	// of the task from before its first iteration, so that the resumed
+	// task compares with the tree the agent started from rather than the
+	// one it left. Empty if they were not recorded.
+	StartTree string
+	Baseline  *ValidationResult
+	// StartProtected and Protected are the protected files from before the
+	// task and from before the interrupted iteration's agent call, so that
+	// changes that agent made are still caught. Nil if not recorded.
+	StartProtected map[string]ProtectedFile
+	Protected      map[string]ProtectedFile
+}
+
+// Resume makes the runner continue an interrupted run. The run ID is kept,
+// so checkpoints and the journal continue where they stopped; tasks are
+// numbered from state.Task; and the next RunTask, if it is for state.Title,
+// starts after the saved iteration with the saved validation output in its
+// prompt, and with the saved start tree and baseline.
+func (r *Runner) Resume(state ResumeState) {
+	r.runID = state.RunID
+	r.taskNum = state.Task - 1
+	r.resume = &state
+}
+
+// takeResume returns the resume state for the task about to run, if any.
+// The state only ever applies to the first task of a resumed run.
+func (r *Runner) takeResume(task string) *ResumeState {
+	state := r.resume
+	r.resume = nil
+	if state == nil || (state.Iteration == 0 && state.SessionID == "" && state.StartTree == "" && state.Baseline == nil && state.StartProtected == nil) {
+		return nil
+	}
+	if state.Title != task {
+		r.Emit(Warning{Message: fmt.Sprintf("resume state is for task %q, starting %q from iteration 1", state.Title, task)})
+		return nil
+	}
+	r.Emit(Resumed{RunID: state.RunID, Task: state.Task, Iteration: state.Iteration + 1, MaxIterations: r.maxIterations})
+	return state
+}
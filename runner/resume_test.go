@@ -0,0 +1,121 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/testresult"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunner_Resume(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "true %s"
+	cfg.Validate.Command = "exit 1"
+	cfg.Patience = -1
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 4)
+	r.Resume(ResumeState{
+		RunID:                "20261017-120000-abcdef",
+		Task:                 2,
+		Title:                "task",
+		Iteration:            2,
+		LastValidationOutput: "saved failure",
+		FailedStages:         []string{"test"},
+	})
+	rec := &recorder{}
+	r.Subscribe(rec)
+
+	err := r.Run(context.Background(), "task")
+	require.ErrorIs(t, err, ErrMaxIterations)
+
+	assert.Equal(t, "20261017-120000-abcdef", r.RunID())
+	assert.Equal(t, 2, r.taskNum)
+	assert.Contains(t, rec.events, Resumed{RunID: "20261017-120000-abcdef", Task: 2, Iteration: 3, MaxIterations: 4})
+
+	var starts []IterationStart
+	for _, e := range rec.events {
+		if it, ok := e.(IterationStart); ok {
+			starts = append(starts, it)
+		}
+	}
+	require.Len(t, starts, 2, "the iteration budget is not reset")
+	assert.Equal(t, 3, starts[0].Iteration)
+	assert.Contains(t, starts[0].Prompt, "This is attempt 3 of 4")
+	assert.Contains(t, starts[0].Prompt, "(failed stage: test)")
+	assert.Contains(t, starts[0].Prompt, "saved failure")
+}
+
+func TestRunner_ResumeOtherTask(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "true %s"
+	cfg.Validate.Command = "true"
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 3)
+	r.Resume(ResumeState{RunID: "id", Task: 1, Title: "old task", Iteration: 2})
+	rec := &recorder{}
+	r.Subscribe(rec)
+
+	require.NoError(t, r.Run(context.Background(), "new task"))
+	assert.Contains(t, rec.events, Warning{Message: `resume state is for task "old task", starting "new task" from iteration 1`})
+	assert.Contains(t, rec.events, TaskComplete{Title: "new task", Iterations: 1})
+}
+
+func TestRunner_ResumeSession(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Validate.Command = "exit 1"
+	cfg.Patience = -1
+
+	h := &sessionHarness{}
+	r := NewWithMaxIterations(cfg, h, 2)
+	// Killed during iteration 1, after the agent started its session
+	r.Resume(ResumeState{RunID: "run", Task: 1, Title: "task", SessionID: "ses_saved", SessionStart: 1})
+	require.Error(t, r.Run(context.Background(), "task"))
+
+	require.Len(t, h.prompts, 2)
+	assert.Equal(t, 1, h.prompts[0].Iteration)
+	assert.Equal(t, "ses_saved", h.prompts[0].SessionID)
+	assert.Equal(t, "ses_saved", h.prompts[1].SessionID)
+	assert.Zero(t, h.started)
+}
+
+func TestRunner_ResumeKeepsBaseline(t *testing.T) {
+	inGitRepo(t, func(dir string) {
+		cfg := integrityConfig(t)
+		tree := New(cfg, newMockHarness(cfg)).gitTree(context.Background())
+		require.NotEmpty(t, tree)
+		// Killed after the agent weakened the suite in iteration 1
+		require.NoError(t, os.WriteFile("out.txt", []byte("--- PASS: TestB (0.00s)\nok\n"), 0644))
+		require.NoError(t, os.WriteFile("a_test.go", []byte("func TestA(t *testing.T) {\n\tt.Skip(\"later\")\n}\n"), 0644))
+
+		cfg.Agent.Command = "true # %s"
+		r := NewWithMaxIterations(cfg, newMockHarness(cfg), 1)
+		r.Resume(ResumeState{RunID: "run", Task: 1, Title: "task", StartTree: tree, Baseline: &ValidationResult{Report: &testresult.Report{
+			Tests:  []testresult.Test{{Name: "TestA", Status: testresult.Failed}, {Name: "TestB", Status: testresult.Passed}},
+			Passed: 1,
+			Failed: 1,
+		}}})
+		rec := &recorder{}
+		r.Subscribe(rec)
+		require.Error(t, r.Run(context.Background(), "task"))
+
+		assert.NotContains(t, rec.kinds(), "Baseline", "the saved baseline is used, not one of the changed tree")
+		var violation IntegrityViolation
+		for _, e := range rec.events {
+			switch e := e.(type) {
+			case IterationStart:
+				assert.Equal(t, tree, e.StartTree)
+			case IntegrityViolation:
+				violation = e
+			}
+		}
+		assert.Equal(t, []string{
+			"test count dropped from 2 to 1",
+			"TestA is missing",
+			`skip marker added in a_test.go: t.Skip("later")`,
+		}, violation.Issues)
+	})
+}
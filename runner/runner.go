@@ -1,13 +1,17 @@
 package runner
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/jack/tatsu/checkpoint"
 	"github.com/jack/tatsu/config"
 	"github.com/jack/tatsu/harness"
+	"github.com/jack/tatsu/testresult"
 )
 
 const DefaultMaxIterations = 15
@@ -16,14 +20,46 @@ type Runner struct {
 	config        *config.Config
 	harness       harness.Harness
 	maxIterations int
+
+	mu    sync.Mutex // serialises emit (agent output arrives from two goroutines)
+	sinks []Sink
+
+	runID   string
+	taskNum int              // 1-based number of the current task within the run
+	repo    *checkpoint.Repo // nil unless git checkpoints are enabled and usable
+	repoErr error
+
+	lastReport *testresult.Report // previous iteration's parsed test results
+
+	stateRepo   *checkpoint.Repo // git repo used to detect file changes, if any
+	stateOpened bool
+
+	resume *ResumeState // applied to the next RunTask, then cleared
+	prd    PRDContext   // PRD of the current task, if any
+
+	env      []string          // agent and validation environment (agent.env)
+	scrubber *strings.Replacer // redacts secrets from output; nil if none
+
+	confirm Confirm // asks the user; nil answers no
+
+	profiles   ProfileLoader                                 // configs of PRD task profiles; nil if none
+	newHarness func(*config.Config) (harness.Harness, error) // harness of a profile; nil means availableHarness
+
+	knownFailures map[string]bool // tests failing before the task, ignored by validation
+	skipped       bool            // the current task was skipped: validation already passed
+}
+
+// PRDContext locates a task in the PRD it comes from, for the prompt
+// templates (.PRDTitle and .PRDSection). Profile is the profile the task
+// asks for, if any.
+type PRDContext struct {
+	Title   string
+	Section string
+	Profile string
 }
 
 func New(cfg *config.Config, h harness.Harness) *Runner {
-	return &Runner{
-		config:        cfg,
-		harness:       h,
-		maxIterations: DefaultMaxIterations,
-	}
+	return NewWithMaxIterations(cfg, h, DefaultMaxIterations)
 }
 
 // NewWithMaxIterations creates a Runner with custom max iterations
@@ -32,59 +68,333 @@ func NewWithMaxIterations(cfg *config.Config, h harness.Harness, maxIter int) *R
 		config:        cfg,
 		harness:       h,
 		maxIterations: maxIter,
+		runID:         NewRunID(),
+	}
+}
+
+// RunID returns the identifier of this run (used for checkpoint names).
+func (r *Runner) RunID() string {
+	return r.runID
+}
+
+// TaskSkipped reports whether the last task was skipped because validation
+// already passed before it (validate.baseline.if_passing), rather than
+// completed by the agent.
+func (r *Runner) TaskSkipped() bool {
+	return r.skipped
+}
+
+// Config returns the config the runner runs tasks with.
+func (r *Runner) Config() *config.Config {
+	return r.config
+}
+
+// Harness returns the agent harness the runner runs tasks with.
+func (r *Runner) Harness() harness.Harness {
+	return r.harness
+}
+
+// ErrMaxIterations is returned by Run when validation never passed.
+var ErrMaxIterations = errors.New("max iterations reached")
+
+// TimeoutError reports that a step ("agent", "validation") or the whole task
+// ("task") ran past its configured deadline.
+type TimeoutError struct {
+	Step    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Step, e.Timeout)
+}
+
+// IsTimeout reports whether err is (or wraps) a TimeoutError.
+func IsTimeout(err error) bool {
+	var te *TimeoutError
+	return errors.As(err, &te)
+}
+
+// Subscribe adds a sink that receives every event emitted by the runner.
+func (r *Runner) Subscribe(s Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sinks = append(r.sinks, s)
+}
+
+// Emit sends e to all subscribed sinks. It is exported so that drivers built
+// on top of the runner (e.g. the PRD executor) report through the same sinks.
+func (r *Runner) Emit(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sinks {
+		s.Handle(e)
+	}
+}
+
+// Run executes a single task as a complete run, emitting RunStart, TaskStart,
+// TaskComplete and RunComplete around RunTask.
+func (r *Runner) Run(ctx context.Context, task string) error {
+	r.Emit(RunStart{Total: 1, Pending: 1, Profile: r.Profile()})
+	r.Emit(TaskStart{Index: 1, Total: 1, Title: task, Profile: r.Profile()})
+	err := r.RunTask(ctx, task)
+	r.Emit(RunComplete{Err: err})
+	return err
+}
+
+// RunPRDTask is RunTask for a task from a PRD. A task that asks for
+// another profile than the run's runs with that profile's config (see
+// SetProfiles).
+func (r *Runner) RunPRDTask(ctx context.Context, task string, prd PRDContext) error {
+	if prd.Profile != "" && prd.Profile != r.Profile() {
+		restore, err := r.useProfile(prd.Profile)
+		if err != nil {
+			r.Emit(TaskComplete{Title: task, Err: err})
+			return err
+		}
+		defer restore()
 	}
+	r.prd = prd
+	defer func() { r.prd = PRDContext{} }()
+	return r.RunTask(ctx, task)
 }
 
-func (r *Runner) Run(task string) error {
-	for i := 1; i <= r.maxIterations; i++ {
-		fmt.Printf("🔁 Iteration %d/%d\n", i, r.maxIterations)
+// RunTask executes the task until validation passes, max iterations are
+// reached, the task timeout expires or ctx is cancelled, then emits
+// TaskComplete. Child processes are killed when ctx is done.
+func (r *Runner) RunTask(ctx context.Context, task string) error {
+	r.taskNum++
+	r.lastReport = nil
+	r.knownFailures = nil
+	r.skipped = false
+	r.openCheckpoints()
+	iterations, err := r.iterate(ctx, task, r.takeResume(task))
+	r.rollback(err)
+	r.Emit(TaskComplete{Title: task, Iterations: iterations, Err: err, Skipped: r.skipped})
+	return err
+}
+
+func (r *Runner) iterate(ctx context.Context, task string, resume *ResumeState) (int, error) {
+	if err := r.loadEnv(); err != nil {
+		return 0, err
+	}
+	if r.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.Timeout)
+		defer cancel()
+	}
 
-		// Run agent
-		if err := r.runAgent(task); err != nil {
-			fmt.Printf("⚠️  Agent error: %v\n", err)
+	var lastOutput string
+	var lastTimeout error
+	var lastFailed []string // failed stage names, only for multi-stage pipelines
+	var session string      // agent session to continue, if the harness keeps them
+	var sessionStart int    // iteration the session started in
+	first := 1
+	if resume != nil {
+		first = resume.Iteration + 1
+		lastOutput = resume.LastValidationOutput
+		lastFailed = resume.FailedStages
+		session, sessionStart = resume.SessionID, resume.SessionStart
+	}
+	stall := newStallDetector(r.config.Patience)
+	var start string // for .ChangedFiles
+	if resume != nil {
+		start = resume.StartTree
+	}
+	if start == "" {
+		start = r.gitTree(ctx)
+	}
+	original, err := r.protectedFiles() // protected files before the task
+	if err != nil {
+		return first - 1, err
+	}
+	if original != nil && resume != nil && resume.StartProtected != nil {
+		original = resume.StartProtected
+	}
+	var baseline *ValidationResult
+	var satisfied bool
+	if resume != nil && resume.Baseline != nil {
+		baseline = r.restoreBaseline(*resume.Baseline)
+	} else {
+		baseline, satisfied = r.baseline(ctx, task, resume != nil)
+	}
+	if err := r.checkContext(ctx); err != nil {
+		return first - 1, err
+	}
+	if satisfied {
+		r.skipped = true
+		return 0, nil
+	}
+	for i := first; i <= r.maxIterations; i++ {
+		if err := r.checkContext(ctx); err != nil {
+			return i - 1, err
+		}
+
+		// Build prompt (iteration 2+ includes the previous validation output)
+		data := PromptData{
+			Task:                 task,
+			Iteration:            i,
+			MaxIterations:        r.maxIterations,
+			LastValidationOutput: lastOutput,
+			FailedStages:         strings.Join(lastFailed, ", "),
+			PRDTitle:             r.prd.Title,
+			PRDSection:           r.prd.Section,
+			ChangedFiles:         r.changedFiles(ctx, start),
+		}
+		prompt, err := BuildPrompt(r.config, data)
+		if err != nil {
+			return i, err
 		}
 
+		// Snapshot the protected files and the tree so this iteration can be undone
+		protected, err := r.protectedFiles()
+		if err != nil {
+			return i - 1, err
+		}
+		if protected != nil && i == first && resume != nil && resume.Protected != nil {
+			// The interrupted agent call may have changed them already
+			protected = resume.Protected
+		}
+		e := IterationStart{Task: task, Iteration: i, MaxIterations: r.maxIterations, Prompt: prompt, StartTree: start, Protected: protected}
+		if i == first {
+			e.StartProtected = original
+		}
+		r.Emit(e)
+		r.snapshot(ctx, task, i)
+
+		// Run agent (errors are reported through AgentExit; validation decides)
+		var before string
+		if stall.patience > 0 {
+			before = r.treeState(ctx)
+		}
+		if r.freshSession(i, sessionStart) {
+			session = ""
+		}
+		if id := r.runAgent(ctx, data, prompt, session); id != "" && id != session {
+			session, sessionStart = id, i
+			r.Emit(SessionStarted{Task: task, Iteration: i, SessionID: id})
+		}
+		if err := r.checkContext(ctx); err != nil {
+			return i, err
+		}
+
+		// Undo (or refuse) changes to protected files
+		violation, reverted := r.checkGuard(task, i, protected, original)
+		failed := violation != "" && !reverted
+		changed := stall.patience > 0 && before != r.treeState(ctx)
+
 		// Validate
-		if ok := r.validate(); ok {
-			fmt.Println("\n✅ Task completed successfully!")
-			return nil
+		var result ValidationResult
+		if failed {
+			result = r.guardFailure(violation)
+		} else {
+			result = r.validate(ctx)
+		}
+		if ctxErr := r.checkContext(ctx); ctxErr != nil {
+			return i, ctxErr
+		}
+		if result.Success {
+			if !r.config.Validate.Integrity {
+				return i, nil
+			}
+			issues := r.integrityIssues(ctx, baseline, start, result.Report)
+			if len(issues) == 0 || r.acceptIntegrity(ctx, task, i, issues) {
+				return i, nil
+			}
+			lastOutput, lastTimeout, lastFailed = integrityFeedback(issues), nil, nil
+			continue
+		}
+		lastOutput = result.Feedback
+		if reverted {
+			lastOutput = violation + "\n\n" + lastOutput
+		}
+		lastTimeout = result.Err
+		lastFailed = nil
+		if len(result.Stages) > 1 {
+			lastFailed = result.FailedStages()
+		}
+
+		// Give up early when iterations keep failing the same way
+		if stall.patience > 0 {
+			if repeats, stalled := stall.observe(NewFingerprint(result, changed)); repeats > 0 {
+				r.Emit(NoProgress{Iterations: repeats, Patience: stall.patience})
+				if stalled && i < r.maxIterations {
+					return i, &StallError{Iterations: repeats}
+				}
+			}
 		}
+	}
 
-		fmt.Println("❌ Validation failed, retrying...")
-		fmt.Println()
+	if lastTimeout != nil {
+		return r.maxIterations, fmt.Errorf("%w (last %w)", ErrMaxIterations, lastTimeout)
 	}
+	return r.maxIterations, ErrMaxIterations
+}
 
-	return fmt.Errorf("max iterations reached")
+// checkContext turns a done ctx into the error Run should return: a task
+// TimeoutError when the task deadline passed, otherwise ctx.Err().
+func (r *Runner) checkContext(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return &TimeoutError{Step: "task", Timeout: r.config.Timeout}
+	default:
+		return ctx.Err()
+	}
 }
 
-func (r *Runner) runAgent(task string) error {
-	// Format command with task
-	cmd := fmt.Sprintf(r.config.Agent.Command, EscapeTask(task))
+// stepContext derives the context for a single agent or validation run.
+func stepContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
 
-	// Execute with non-interactive env (permission allow, CI)
-	c := exec.Command("bash", "-c", cmd)
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	c.Stdin = nil // /dev/null - prevent blocking on stdin
-	c.Env = harness.AgentEnv()
+// stepTimedOut reports whether the step's own deadline fired (as opposed to
+// the parent being cancelled or hitting the task deadline).
+func stepTimedOut(parent, step context.Context) bool {
+	return parent.Err() == nil && errors.Is(step.Err(), context.DeadlineExceeded)
+}
 
-	return c.Run()
+// freshSession reports whether iteration should start a new agent session
+// instead of continuing the one started in iteration sessionStart.
+func (r *Runner) freshSession(iteration, sessionStart int) bool {
+	s := r.config.Agent.Session
+	return s.Fresh || (s.ResetAfter > 0 && iteration-sessionStart >= s.ResetAfter)
 }
 
-func (r *Runner) validate() bool {
-	// Execute validation command
-	c := exec.Command("bash", "-c", r.config.Validate.Command)
-	output, err := c.CombinedOutput()
+// runAgent runs the agent with the prompt through the harness, streaming its
+// output as AgentLine events, and emits AgentExit. session is the agent
+// session to continue; the session the agent used is returned.
+func (r *Runner) runAgent(parent context.Context, data PromptData, prompt, session string) string {
+	ctx, cancel := stepContext(parent, r.config.Agent.Timeout)
+	defer cancel()
 
-	if err != nil {
-		fmt.Printf("\n📋 Validation output:\n%s\n", string(output))
-		return false
-	}
+	stdout := r.lineWriter(Stdout)
+	stderr := r.lineWriter(Stderr)
+	result, err := r.harness.Run(ctx, harness.Prompt{
+		Text:      prompt,
+		Task:      data.Task,
+		Iteration: data.Iteration,
+		Vars:      data.Vars(),
+		SessionID: session,
+		Env:       r.env,
+		Stdout:    stdout,
+		Stderr:    stderr,
+	})
+	stdout.Flush()
+	stderr.Flush()
 
-	return true
+	exit := AgentExit{ExitCode: result.ExitCode, Duration: result.Duration, Usage: result.Usage, Err: err}
+	if stepTimedOut(parent, ctx) {
+		exit.Err = &TimeoutError{Step: "agent", Timeout: r.config.Agent.Timeout}
+	}
+	r.Emit(exit)
+	return result.SessionID
 }
 
 // EscapeTask escapes a task string for safe use in shell commands.
 func EscapeTask(task string) string {
-	return strings.ReplaceAll(task, `"`, `\"`)
+	return harness.EscapeTask(task)
 }
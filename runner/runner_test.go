@@ -1,10 +1,16 @@
 package runner
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/harness"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,14 +33,22 @@ func quietTest(t *testing.T, fn func()) {
 	fn()
 }
 
-type mockHarness struct{}
+// mockHarness runs agent.command like the custom harness but is always
+// available.
+type mockHarness struct {
+	*harness.Custom
+}
+
+func newMockHarness(cfg *config.Config) *mockHarness {
+	return &mockHarness{harness.NewCustom(cfg)}
+}
 
 func (m *mockHarness) Name() string      { return "MockHarness" }
 func (m *mockHarness) IsAvailable() bool { return true }
 
 func TestNew(t *testing.T) {
 	cfg := &config.Config{}
-	h := &mockHarness{}
+	h := newMockHarness(cfg)
 
 	r := New(cfg, h)
 
@@ -65,6 +79,16 @@ func TestEscapeTask(t *testing.T) {
 			input:    `"start" and "end"`,
 			expected: `\"start\" and \"end\"`,
 		},
+		{
+			name:     "shell expansions",
+			input:    "`touch pwned` $(id) $HOME \\n",
+			expected: "\\`touch pwned\\` \\$(id) \\$HOME \\\\n",
+		},
+		{
+			name:     "no history expansion",
+			input:    "done! !! !$",
+			expected: `done! !! !\$`,
+		},
 		{
 			name:     "empty string",
 			input:    "",
@@ -86,7 +110,7 @@ func TestDefaultMaxIterations(t *testing.T) {
 
 func TestNewWithMaxIterations(t *testing.T) {
 	cfg := &config.Config{}
-	h := &mockHarness{}
+	h := newMockHarness(cfg)
 
 	r := NewWithMaxIterations(cfg, h, 5)
 	require.NotNil(t, r)
@@ -100,13 +124,13 @@ func TestRunner_UsesCustomMaxIterations(t *testing.T) {
 	cfg.Agent.Command = "echo 'Agent: %s'"
 	cfg.Validate.Command = "exit 1" // Always fail
 
-	h := &mockHarness{}
+	h := newMockHarness(cfg)
 	r := NewWithMaxIterations(cfg, h, 3) // Only 3 iterations
 
 	// Should fail after 3 iterations, not 15
 	var err error
 	quietTest(t, func() {
-		err = r.Run("test task")
+		err = r.Run(context.Background(), "test task")
 	})
 	require.Error(t, err)
 	assert.Equal(t, "max iterations reached", err.Error())
@@ -121,13 +145,13 @@ func TestRunner_IntegrationWithPassingValidation(t *testing.T) {
 	cfg.Agent.Command = "echo 'Agent running: %s'"
 	cfg.Validate.Command = "exit 0"
 
-	h := &mockHarness{}
+	h := newMockHarness(cfg)
 	r := New(cfg, h)
 
 	// Run with passing validation - should succeed on first iteration
 	var err error
 	quietTest(t, func() {
-		err = r.Run("test task")
+		err = r.Run(context.Background(), "test task")
 	})
 	assert.NoError(t, err)
 }
@@ -137,15 +161,337 @@ func TestRunner_IntegrationWithFailingValidation(t *testing.T) {
 	cfg := &config.Config{}
 	cfg.Agent.Command = "echo 'Agent running: %s'"
 	cfg.Validate.Command = "exit 1"
+	cfg.Patience = -1 // identical failures would otherwise stop it early
 
-	h := &mockHarness{}
+	h := newMockHarness(cfg)
 	r := New(cfg, h)
 
 	// Run with failing validation - should hit max iterations
 	var err error
 	quietTest(t, func() {
-		err = r.Run("test task")
+		err = r.Run(context.Background(), "test task")
 	})
 	require.Error(t, err)
 	assert.Equal(t, "max iterations reached", err.Error())
 }
+
+func TestRunner_RetryPromptIncludesValidationOutput(t *testing.T) {
+	dir := t.TempDir()
+	prompts := filepath.Join(dir, "prompts.txt")
+	marker := filepath.Join(dir, "validated")
+
+	// Validation fails the first time with a recognisable message, then passes
+	cfg := &config.Config{}
+	cfg.Agent.Command = "echo \"%s\" >> " + prompts
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Agent.RetryPrompt = "RETRY {{.Iteration}}: {{.LastValidationOutput}}"
+	cfg.Validate.Command = "if [ -f " + marker + " ]; then exit 0; fi; touch " + marker + "; echo boom-from-tests; exit 1"
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 3)
+
+	var err error
+	quietTest(t, func() {
+		err = r.Run(context.Background(), "first prompt")
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(prompts)
+	require.NoError(t, err)
+	assert.Equal(t, "first prompt\nRETRY 2: boom-from-tests\n", string(data))
+}
+
+func TestRunner_RetryPromptIsNotRunByTheShell(t *testing.T) {
+	dir := t.TempDir()
+	prompts := filepath.Join(dir, "prompts.txt")
+	marker := filepath.Join(dir, "validated")
+	pwned := filepath.Join(dir, "pwned")
+
+	// The validation output holds command substitutions; the retry prompt
+	// must reach the agent literally
+	cfg := &config.Config{}
+	cfg.Agent.Command = "echo \"%s\" >> " + prompts
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Agent.RetryPrompt = "{{.LastValidationOutput}}"
+	cfg.Validate.Command = "if [ -f " + marker + " ]; then exit 0; fi; touch " + marker +
+		"; echo 'FAIL: `touch " + pwned + "` $(touch " + pwned + ") $HOME \\ done!'; exit 1"
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 3)
+
+	var err error
+	quietTest(t, func() {
+		err = r.Run(context.Background(), "first prompt")
+	})
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, pwned)
+	data, err := os.ReadFile(prompts)
+	require.NoError(t, err)
+	assert.Equal(t, "first prompt\nFAIL: `touch "+pwned+"` $(touch "+pwned+") $HOME \\ done!\n", string(data))
+}
+
+func TestRunner_AgentTimeout(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "sleep 5 # %s"
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Agent.Timeout = 100 * time.Millisecond
+	cfg.Validate.Command = "exit 0"
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 1)
+
+	// A timed-out agent is reported, but validation still decides the outcome
+	start := time.Now()
+	var err error
+	quietTest(t, func() {
+		err = r.Run(context.Background(), "test task")
+	})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestRunner_ValidationTimeout(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "echo '%s'"
+	cfg.Validate.Command = "sleep 5"
+	cfg.Validate.Timeout = 100 * time.Millisecond
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+
+	var err error
+	quietTest(t, func() {
+		err = r.Run(context.Background(), "test task")
+	})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrMaxIterations)
+	assert.True(t, IsTimeout(err), "the last timeout is wrapped too, so tatsu exits 124")
+	assert.Contains(t, err.Error(), "validation timed out after 100ms")
+}
+
+func TestRunner_TaskTimeout(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "echo '%s'"
+	cfg.Validate.Command = "sleep 5"
+	cfg.Timeout = 200 * time.Millisecond
+
+	r := New(cfg, newMockHarness(cfg))
+
+	var err error
+	quietTest(t, func() {
+		err = r.Run(context.Background(), "test task")
+	})
+	require.Error(t, err)
+	assert.True(t, IsTimeout(err))
+	assert.Equal(t, "task timed out after 200ms", err.Error())
+}
+
+func TestRunner_Cancelled(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "sleep 5 # %s"
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Validate.Command = "exit 0"
+
+	r := New(cfg, newMockHarness(cfg))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	var err error
+	quietTest(t, func() {
+		err = r.Run(ctx, "test task")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// recorder is a Sink that keeps every event it receives.
+type recorder struct {
+	events []Event
+}
+
+func (rec *recorder) Handle(e Event) { rec.events = append(rec.events, e) }
+
+// kinds returns the event type names, skipping agent output lines.
+func (rec *recorder) kinds() []string {
+	var kinds []string
+	for _, e := range rec.events {
+		if _, ok := e.(AgentLine); ok {
+			continue
+		}
+		kinds = append(kinds, strings.TrimPrefix(fmt.Sprintf("%T", e), "runner."))
+	}
+	return kinds
+}
+
+func TestRunner_EmitsEvents(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "echo 'out: %s'; echo err >&2"
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Validate.Command = "echo fail; exit 1"
+	cfg.Patience = -1
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+	rec := &recorder{}
+	r.Subscribe(rec)
+
+	err := r.Run(context.Background(), "task")
+	require.ErrorIs(t, err, ErrMaxIterations)
+
+	assert.Equal(t, []string{
+		"RunStart", "TaskStart",
+		"IterationStart", "AgentExit", "ValidationStart", "StageStart", "StageResult", "ValidationResult",
+		"IterationStart", "AgentExit", "ValidationStart", "StageStart", "StageResult", "ValidationResult",
+		"TaskComplete", "RunComplete",
+	}, rec.kinds())
+
+	assert.Contains(t, rec.events, AgentLine{Stream: Stdout, Line: "out: task"})
+	assert.Contains(t, rec.events, AgentLine{Stream: Stderr, Line: "err"})
+
+	var result ValidationResult
+	var complete TaskComplete
+	for _, e := range rec.events {
+		switch e := e.(type) {
+		case ValidationResult:
+			result = e
+		case TaskComplete:
+			complete = e
+		}
+	}
+	assert.False(t, result.Success)
+	assert.Equal(t, "fail\n", result.Output)
+	assert.Equal(t, 2, complete.Iterations)
+	assert.ErrorIs(t, complete.Err, ErrMaxIterations)
+}
+
+func TestRunner_AgentExitCode(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "exit 7 # %s"
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Validate.Command = "exit 0"
+
+	r := New(cfg, newMockHarness(cfg))
+	rec := &recorder{}
+	r.Subscribe(rec)
+
+	require.NoError(t, r.Run(context.Background(), "task"))
+	for _, e := range rec.events {
+		if exit, ok := e.(AgentExit); ok {
+			assert.Equal(t, 7, exit.ExitCode)
+			assert.Error(t, exit.Err)
+		}
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	cfg := &config.Config{}
+	r := New(cfg, newMockHarness(cfg))
+	rec := &recorder{}
+	r.Subscribe(rec)
+
+	w := r.lineWriter(Stdout)
+	_, _ = w.Write([]byte("one\ntw"))
+	_, _ = w.Write([]byte("o\r\nthree"))
+	w.Flush()
+
+	assert.Equal(t, []Event{
+		AgentLine{Stream: Stdout, Line: "one"},
+		AgentLine{Stream: Stdout, Line: "two"},
+		AgentLine{Stream: Stdout, Line: "three"},
+	}, rec.events)
+}
+
+// fakeHarness answers in-process, without running a command.
+type fakeHarness struct {
+	prompts []harness.Prompt
+}
+
+func (f *fakeHarness) Name() string      { return "Fake" }
+func (f *fakeHarness) IsAvailable() bool { return true }
+
+func (f *fakeHarness) Run(ctx context.Context, p harness.Prompt) (harness.Result, error) {
+	f.prompts = append(f.prompts, p)
+	fmt.Fprintf(p.Stdout, "editing for %s\npartial", p.Task)
+	fmt.Fprintln(p.Stderr, "warning")
+	return harness.Result{Duration: time.Second, Usage: &harness.Usage{TotalTokens: 42}}, nil
+}
+
+func TestRunner_FakeHarness(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Validate.Command = "exit 1"
+	cfg.Patience = -1
+
+	h := &fakeHarness{}
+	r := NewWithMaxIterations(cfg, h, 2)
+	rec := &recorder{}
+	r.Subscribe(rec)
+
+	require.ErrorIs(t, r.Run(context.Background(), "task"), ErrMaxIterations)
+
+	require.Len(t, h.prompts, 2)
+	assert.Equal(t, "task", h.prompts[0].Text)
+	assert.Equal(t, 2, h.prompts[1].Iteration)
+	assert.Equal(t, "task", h.prompts[1].Task)
+	assert.Contains(t, h.prompts[1].Text, "This is attempt 2 of 2")
+
+	assert.Contains(t, rec.events, AgentLine{Stream: Stdout, Line: "editing for task"})
+	assert.Contains(t, rec.events, AgentLine{Stream: Stdout, Line: "partial"})
+	assert.Contains(t, rec.events, AgentLine{Stream: Stderr, Line: "warning"})
+	assert.Contains(t, rec.events, AgentExit{Duration: time.Second, Usage: &harness.Usage{TotalTokens: 42}})
+}
+
+// sessionHarness starts a numbered session whenever it is not asked to
+// continue one.
+type sessionHarness struct {
+	fakeHarness
+	started int
+}
+
+func (s *sessionHarness) Run(ctx context.Context, p harness.Prompt) (harness.Result, error) {
+	s.prompts = append(s.prompts, p)
+	if p.SessionID != "" {
+		return harness.Result{SessionID: p.SessionID}, nil
+	}
+	s.started++
+	return harness.Result{SessionID: fmt.Sprintf("ses_%d", s.started)}, nil
+}
+
+func TestRunner_Sessions(t *testing.T) {
+	tests := []struct {
+		name       string
+		fresh      bool
+		resetAfter int
+		continued  []string // session passed to iterations 1-5
+		started    []int    // iterations that started a session
+	}{
+		{"continue", false, 0, []string{"", "ses_1", "ses_1", "ses_1", "ses_1"}, []int{1}},
+		{"reset after 2", false, 2, []string{"", "ses_1", "", "ses_2", ""}, []int{1, 3, 5}},
+		{"fresh", true, 0, []string{"", "", "", "", ""}, []int{1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Validate.Command = "exit 1"
+			cfg.Patience = -1
+			cfg.Agent.Session.Fresh = tt.fresh
+			cfg.Agent.Session.ResetAfter = tt.resetAfter
+
+			h := &sessionHarness{}
+			r := NewWithMaxIterations(cfg, h, 5)
+			rec := &recorder{}
+			r.Subscribe(rec)
+			require.Error(t, r.Run(context.Background(), "task"))
+
+			var continued []string
+			for _, p := range h.prompts {
+				continued = append(continued, p.SessionID)
+			}
+			assert.Equal(t, tt.continued, continued)
+
+			var started []int
+			for _, e := range rec.events {
+				if e, ok := e.(SessionStarted); ok {
+					assert.Equal(t, "task", e.Task)
+					started = append(started, e.Iteration)
+				}
+			}
+			assert.Equal(t, tt.started, started)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jack/tatsu/checkpoint"
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/testresult"
+)
+
+// StallError is returned when the last Iterations failed iterations all
+// failed the same way (see Fingerprint) and the patience ran out.
+type StallError struct {
+	Iterations int
+}
+
+func (e *StallError) Error() string {
+	return fmt.Sprintf("no progress for %d iterations", e.Iterations)
+}
+
+// Fingerprint identifies how an iteration failed. Two consecutive iterations
+// with equal fingerprints made no progress.
+type Fingerprint struct {
+	Output  string // hash of the normalized validation output
+	Failing string // sorted failing test names, if results were parsed
+	Changed bool   // the agent changed files in the working tree
+}
+
+// volatileOutput matches the parts of validation output that differ between
+// otherwise identical runs: timestamps, durations, addresses, temp paths,
+// process IDs and the ports of local servers.
+var volatileOutput = []*regexp.Regexp{
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`),
+	regexp.MustCompile(`\b\d+(\.\d+)?(ns|µs|us|ms|s|m|h)\b`),
+	regexp.MustCompile(`\b0[xX][0-9a-fA-F]+\b`),
+	regexp.MustCompile(`(/tmp|/private/var/folders|/var/folders)/[^\s:'"]+`),
+	regexp.MustCompile(`\b[A-Za-z]:\\[^\s:'"]*\\Temp\\[^\s:'"]+`),
+	regexp.MustCompile(`goroutine \d+`),
+	regexp.MustCompile(`(?i)\b(pid|process)\b[ :=#]*\d+|==\d+==`),
+	regexp.MustCompile(`(\blocalhost|\b\d{1,3}(\.\d{1,3}){3}|\[[0-9a-fA-F:]*\]):\d+`),
+}
+
+// NormalizeOutput strips volatile details (timings, timestamps, pointers,
+// temp dirs, PIDs, ports) and trailing whitespace so repeated identical failures compare
+// equal.
+func NormalizeOutput(output string) string {
+	for _, re := range volatileOutput {
+		output = re.ReplaceAllString(output, "#")
+	}
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// NewFingerprint fingerprints a failed validation.
+func NewFingerprint(result ValidationResult, changed bool) Fingerprint {
+	sum := sha256.Sum256([]byte(NormalizeOutput(result.Output)))
+	fp := Fingerprint{Output: hex.EncodeToString(sum[:]), Changed: changed}
+	if result.Report != nil {
+		fp.Failing = strings.Join(result.Report.Names(testresult.Failed), "\n")
+	}
+	return fp
+}
+
+// stallDetector counts consecutive iterations with the same fingerprint.
+type stallDetector struct {
+	patience int // 0 disables detection
+	last     *Fingerprint
+	repeats  int
+}
+
+func newStallDetector(patience int) *stallDetector {
+	switch {
+	case patience == 0:
+		patience = config.DefaultPatience
+	case patience < 0:
+		patience = 0
+	}
+	return &stallDetector{patience: patience}
+}
+
+// observe records a failed iteration and returns how many iterations in a
+// row made no progress, and whether the patience is exhausted.
+func (d *stallDetector) observe(fp Fingerprint) (repeats int, stalled bool) {
+	if d.last != nil && *d.last == fp {
+		d.repeats++
+	} else {
+		d.repeats = 0
+	}
+	d.last = &fp
+	return d.repeats, d.patience > 0 && d.repeats >= d.patience
+}
+
+// gitTree returns the git tree hash of the working tree, or "" outside a
+// git repo.
+func (r *Runner) gitTree(ctx context.Context) string {
+	if !r.stateOpened {
+		r.stateOpened = true
+		r.stateRepo, _ = checkpoint.Open(".")
+	}
+	if r.stateRepo == nil {
+		return ""
+	}
+	tree, err := r.stateRepo.WorkTree(ctx)
+	if err != nil {
+		return ""
+	}
+	return tree
+}
+
+// changedFiles lists the files changed since the git tree since, one per
+// line. Empty if since is.
+func (r *Runner) changedFiles(ctx context.Context, since string) string {
+	if since == "" {
+		return ""
+	}
+	now := r.gitTree(ctx)
+	if now == "" || now == since {
+		return ""
+	}
+	files, err := r.stateRepo.ChangedFiles(ctx, since, now)
+	if err != nil {
+		return ""
+	}
+	return strings.Join(files, "\n")
+}
+
+// treeState returns a value that changes whenever the working tree does:
+// the git tree hash when in a git repo, otherwise a hash of file paths,
+// sizes and modification times. Empty if the state cannot be read.
+func (r *Runner) treeState(ctx context.Context) string {
+	if tree := r.gitTree(ctx); tree != "" {
+		return tree
+	}
+
+	h := sha256.New()
+	err := filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			switch d.Name() {
+			case ".git", ".tatsu", "node_modules":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,219 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/testresult"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeOutput(t *testing.T) {
+	a := "--- FAIL: TestX (0.01s)\nok  \tpkg\t1.234s\n2026-10-17T15:30:12Z started\nptr 0xc000012345 \n/tmp/go-build123/x.go:3"
+	b := "--- FAIL: TestX (0.02s)\nok  \tpkg\t0.9s\n2026-10-18T09:00:00Z started\nptr 0xc000099999\n/tmp/go-build456/x.go:3"
+	assert.Equal(t, NormalizeOutput(a), NormalizeOutput(b))
+	assert.NotEqual(t, NormalizeOutput("x.go:3: boom"), NormalizeOutput("x.go:4: boom"))
+}
+
+func TestNormalizeOutput_RealRuns(t *testing.T) {
+	// Each case is the same failure seen in two runs
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{
+			name: "go test",
+			a: `=== RUN   TestServer
+    server_test.go:31: GET http://127.0.0.1:41873/health: connection refused
+    server_test.go:35: wrote /tmp/TestServer2874417364/001/config.json
+--- FAIL: TestServer (0.03s)
+=== RUN   TestWorker
+    worker_test.go:18: worker pid 48213 exited: signal: killed
+--- FAIL: TestWorker (1.50s)
+panic: runtime error: invalid memory address or nil pointer dereference [recovered]
+[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x5f2b3a]
+
+goroutine 21 [running]:
+testing.tRunner.func1.2({0x6a1f20, 0x8e3c50})
+	/usr/local/go/src/testing/testing.go:1545 +0x238
+example.com/app.(*Cache).Get(0x0, {0x6c1d2e, 0x3})
+	/home/dev/app/cache.go:42 +0x1c
+FAIL	example.com/app	1.562s
+FAIL`,
+			b: `=== RUN   TestServer
+    server_test.go:31: GET http://127.0.0.1:36009/health: connection refused
+    server_test.go:35: wrote /tmp/TestServer1193018846/001/config.json
+--- FAIL: TestServer (0.05s)
+=== RUN   TestWorker
+    worker_test.go:18: worker pid 48377 exited: signal: killed
+--- FAIL: TestWorker (1.51s)
+panic: runtime error: invalid memory address or nil pointer dereference [recovered]
+[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x5f2c1e]
+
+goroutine 7 [running]:
+testing.tRunner.func1.2({0x6a1f20, 0x8e3c50})
+	/usr/local/go/src/testing/testing.go:1545 +0x238
+example.com/app.(*Cache).Get(0x0, {0x6c1d2e, 0x3})
+	/home/dev/app/cache.go:42 +0x1c
+FAIL	example.com/app	1.604s
+FAIL`,
+		},
+		{
+			name: "go test on macOS",
+			a:    "    store_test.go:22: open /var/folders/9x/k2l1y5d3qz7c0000gn/T/TestStore3120/001/db: permission denied\n--- FAIL: TestStore (0.00s)",
+			b:    "    store_test.go:22: open /var/folders/9x/k2l1y5d3qz7c0000gn/T/TestStore4471/001/db: permission denied\n--- FAIL: TestStore (0.01s)",
+		},
+		{
+			name: "pytest",
+			a: `=================================== FAILURES ===================================
+_________________________________ test_upload __________________________________
+
+tmp_path = PosixPath('/tmp/pytest-of-dev/pytest-17/test_upload0')
+
+    def test_upload(tmp_path):
+>       assert upload(tmp_path / "a.txt") == 200
+E       AssertionError: assert <Response [500]> == 200
+E        +  where <Response [500]> = upload(PosixPath('/tmp/pytest-of-dev/pytest-17/test_upload0/a.txt'))
+
+tests/test_api.py:12: AssertionError
+_________________________________ test_server __________________________________
+
+server = <app.testing.LiveServer object at 0x7f8e2c1b3d90>
+
+    def test_server(server):
+>       assert ping(server.url)
+E       AssertionError: assert False
+E        +  where False = ping('http://localhost:53817')
+
+tests/test_api.py:20: AssertionError
+------------------------------ Captured log call -------------------------------
+WARNING  app.server:server.py:88 worker process 31337 died
+=========================== short test summary info ============================
+FAILED tests/test_api.py::test_upload - AssertionError: assert <Response [500]> == 200
+FAILED tests/test_api.py::test_server - AssertionError: assert False
+========================= 2 failed, 1 passed in 0.84s ==========================`,
+			b: `=================================== FAILURES ===================================
+_________________________________ test_upload __________________________________
+
+tmp_path = PosixPath('/tmp/pytest-of-dev/pytest-18/test_upload0')
+
+    def test_upload(tmp_path):
+>       assert upload(tmp_path / "a.txt") == 200
+E       AssertionError: assert <Response [500]> == 200
+E        +  where <Response [500]> = upload(PosixPath('/tmp/pytest-of-dev/pytest-18/test_upload0/a.txt'))
+
+tests/test_api.py:12: AssertionError
+_________________________________ test_server __________________________________
+
+server = <app.testing.LiveServer object at 0x7f3a90d2e110>
+
+    def test_server(server):
+>       assert ping(server.url)
+E       AssertionError: assert False
+E        +  where False = ping('http://localhost:40121')
+
+tests/test_api.py:20: AssertionError
+------------------------------ Captured log call -------------------------------
+WARNING  app.server:server.py:88 worker process 31502 died
+=========================== short test summary info ============================
+FAILED tests/test_api.py::test_upload - AssertionError: assert <Response [500]> == 200
+FAILED tests/test_api.py::test_server - AssertionError: assert False
+========================= 2 failed, 1 passed in 0.91s ==========================`,
+		},
+		{
+			name: "address sanitizer",
+			a:    "==12345==ERROR: AddressSanitizer: heap-use-after-free on address 0x602000000010 at pc 0x55d1c3a2b1f4",
+			b:    "==12399==ERROR: AddressSanitizer: heap-use-after-free on address 0x602000000030 at pc 0x55e07b12c1f4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, NormalizeOutput(tt.a), NormalizeOutput(tt.b))
+		})
+	}
+
+	// Real differences are kept
+	for _, pair := range [][2]string{
+		{"E       assert 3 == 4", "E       assert 3 == 5"},
+		{"tests/test_api.py:12: AssertionError", "tests/test_api.py:14: AssertionError"},
+		{"--- FAIL: TestServer (0.03s)", "--- FAIL: TestWorker (0.03s)"},
+		{"want status 200, got 500", "want status 200, got 404"},
+	} {
+		assert.NotEqual(t, NormalizeOutput(pair[0]), NormalizeOutput(pair[1]), pair[0])
+	}
+}
+
+func TestNewFingerprint(t *testing.T) {
+	report := func(failing ...string) *testresult.Report {
+		r := &testresult.Report{}
+		for _, name := range failing {
+			r.Tests = append(r.Tests, testresult.Test{Name: name, Status: testresult.Failed})
+		}
+		return r
+	}
+
+	base := NewFingerprint(ValidationResult{Output: "FAIL (1s)", Report: report("B", "A")}, true)
+	assert.Equal(t, base, NewFingerprint(ValidationResult{Output: "FAIL (2s)", Report: report("A", "B")}, true))
+	assert.NotEqual(t, base, NewFingerprint(ValidationResult{Output: "FAIL (1s)", Report: report("B", "A")}, false))
+	assert.NotEqual(t, base, NewFingerprint(ValidationResult{Output: "FAIL (1s)", Report: report("A")}, true))
+}
+
+func TestStallDetector(t *testing.T) {
+	d := newStallDetector(2)
+	a, b := Fingerprint{Output: "a"}, Fingerprint{Output: "b"}
+
+	repeats, stalled := d.observe(a)
+	assert.Equal(t, 0, repeats)
+	assert.False(t, stalled)
+	repeats, stalled = d.observe(a)
+	assert.Equal(t, 1, repeats)
+	assert.False(t, stalled)
+	repeats, _ = d.observe(b)
+	assert.Equal(t, 0, repeats, "a different failure is progress")
+	d.observe(b)
+	repeats, stalled = d.observe(b)
+	assert.Equal(t, 2, repeats)
+	assert.True(t, stalled)
+
+	assert.Equal(t, config.DefaultPatience, newStallDetector(0).patience)
+	_, stalled = newStallDetector(-1).observe(a)
+	assert.False(t, stalled)
+}
+
+func TestRunner_StopsWhenNoProgress(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.Command = "true %s"
+	cfg.Validate.Command = "echo same failure; exit 1"
+	cfg.Patience = 2
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 10)
+	rec := &recorder{}
+	r.Subscribe(rec)
+
+	err := r.Run(context.Background(), "task")
+	var stallErr *StallError
+	require.ErrorAs(t, err, &stallErr)
+	assert.Equal(t, "no progress for 2 iterations", err.Error())
+	assert.Contains(t, rec.events, NoProgress{Iterations: 2, Patience: 2})
+	assert.Contains(t, rec.events, TaskComplete{Title: "task", Iterations: 3, Err: err})
+}
+
+func TestRunner_ChangingOutputIsProgress(t *testing.T) {
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "n")
+	require.NoError(t, os.WriteFile(counter, nil, 0644))
+
+	cfg := &config.Config{}
+	cfg.Agent.Command = "echo x >> " + counter + " #%s"
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Validate.Command = "wc -l < " + counter + "; exit 1"
+	cfg.Patience = 1
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 4)
+	err := r.Run(context.Background(), "task")
+	require.ErrorIs(t, err, ErrMaxIterations)
+}
@@ -0,0 +1,188 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/proc"
+	"github.com/jack/tatsu/testresult"
+)
+
+// validate runs the validation pipeline and emits ValidationStart, a
+// StageStart/StageResult pair per stage and ValidationResult. Result.Err is a
+// TimeoutError when validation timed out.
+func (r *Runner) validate(parent context.Context) ValidationResult {
+	return r.runValidation(parent, r.Emit)
+}
+
+// runValidation runs the validation pipeline, reporting through emit.
+func (r *Runner) runValidation(parent context.Context, emit func(Event)) ValidationResult {
+	ctx, cancel := stepContext(parent, r.config.Validate.Timeout)
+	defer cancel()
+
+	emit(ValidationStart{})
+
+	stages := r.config.ValidationStages()
+	result := ValidationResult{Success: true}
+	start := time.Now()
+	failFast := false
+	for i, stage := range stages {
+		if failFast {
+			skipped := StageResult{Name: stage.Name, Command: stage.Command, Skipped: true}
+			emit(skipped)
+			result.Stages = append(result.Stages, skipped)
+			continue
+		}
+
+		emit(StageStart{Name: stage.Name, Index: i + 1, Total: len(stages)})
+		sr := r.runStage(ctx, stage)
+		if stepTimedOut(parent, ctx) {
+			// The pipeline timeout fired during this stage
+			timeoutErr := &TimeoutError{Step: "validation", Timeout: r.config.Validate.Timeout}
+			sr.Success = false
+			sr.Err = timeoutErr
+			sr.Output += "\n" + timeoutErr.Error() + "\n"
+			result.Err = timeoutErr
+		}
+		emit(sr)
+		result.Stages = append(result.Stages, sr)
+
+		if !sr.Success {
+			result.Success = false
+			if result.Err == nil && sr.Err != nil {
+				result.Err = sr.Err
+			}
+			failFast = !stage.ContinueOnFailure || result.Err != nil
+		}
+	}
+	result.Duration = time.Since(start)
+	result.Output = combinedOutput(result.Stages)
+	for _, sr := range result.Stages {
+		result.Report = testresult.Merge(result.Report, sr.Report)
+	}
+	if known := r.onlyKnownFailures(result); known != nil {
+		result.Success = true
+		result.KnownFailures = known
+	}
+	result.Feedback = feedback(result) + r.knownFailureNote(result)
+	result.PreviousReport = r.lastReport
+	r.lastReport = result.Report
+
+	emit(result)
+	return result
+}
+
+// runStage runs a single validation stage with its own optional timeout.
+func (r *Runner) runStage(parent context.Context, stage config.Stage) StageResult {
+	ctx, cancel := stepContext(parent, stage.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	c := proc.Shell(ctx, stage.Command)
+	c.Dir = stage.Dir
+	c.Env = r.env
+	out, err := c.CombinedOutput()
+	out = []byte(r.scrub(string(out)))
+
+	sr := StageResult{
+		Name:     stage.Name,
+		Command:  stage.Command,
+		Success:  err == nil,
+		ExitCode: proc.ExitCode(err),
+		Output:   string(out),
+		Duration: time.Since(start),
+	}
+	if stepTimedOut(parent, ctx) {
+		timeoutErr := &TimeoutError{Step: "validation stage " + stage.Name, Timeout: stage.Timeout}
+		sr.Success = false
+		sr.Err = timeoutErr
+		sr.Output += "\n" + timeoutErr.Error() + "\n"
+	}
+	sr.Report = r.parseResults(stage, out, start)
+	return sr
+}
+
+// parseResults extracts test results from a stage's output, or from its
+// report file when one is configured. A report file older than the stage
+// run is ignored: it is left over from an earlier run.
+func (r *Runner) parseResults(stage config.Stage, output []byte, start time.Time) *testresult.Report {
+	format := stage.Parser
+	if format == "" {
+		format = config.DetectParser(filepath.Join(".", stage.Dir))
+	}
+
+	data := output
+	if stage.Report != "" {
+		path := filepath.Join(stage.Dir, stage.Report)
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Before(start.Truncate(time.Second)) {
+			return nil
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			r.Emit(Warning{Message: fmt.Sprintf("read test report %s: %v", path, err)})
+			return nil
+		}
+		data = []byte(r.scrub(string(data)))
+	}
+
+	report, err := testresult.Parse(format, data)
+	if err != nil {
+		r.Emit(Warning{Message: fmt.Sprintf("parse %s test results for stage %s: %v", format, stage.Name, err)})
+		return nil
+	}
+	return report
+}
+
+// feedback builds the validation output shown to the agent: for each failed
+// stage, the failing tests' messages if its results were parsed, otherwise
+// the stage's raw output. Stage headers are only added for multi-stage
+// pipelines.
+func feedback(result ValidationResult) string {
+	var b strings.Builder
+	for _, s := range result.Stages {
+		if s.Success || s.Skipped {
+			continue
+		}
+		text := s.Output
+		if s.Report != nil && s.Report.Failed > 0 && !s.Report.Incomplete && s.Err == nil {
+			text = fmt.Sprintf("%s\n%s", s.Report.Summary(), s.Report.FailureText())
+		}
+		if len(result.Stages) > 1 {
+			fmt.Fprintf(&b, "=== stage %s failed: %s ===\n", s.Name, s.Command)
+		}
+		b.WriteString(text)
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// combinedOutput joins stage outputs. A single stage's output is returned
+// as is; multiple stages get a header each so the agent can tell them apart.
+func combinedOutput(stages []StageResult) string {
+	if len(stages) == 1 {
+		return stages[0].Output
+	}
+	var b strings.Builder
+	for _, s := range stages {
+		if s.Skipped {
+			continue
+		}
+		status := "passed"
+		if !s.Success {
+			status = "failed"
+		}
+		fmt.Fprintf(&b, "=== stage %s (%s): %s ===\n", s.Name, status, s.Command)
+		b.WriteString(s.Output)
+		if s.Output != "" && !strings.HasSuffix(s.Output, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
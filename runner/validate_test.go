@@ -0,0 +1,176 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jack/tatsu/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate_SingleCommandIsOneStage(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Validate.Command = "echo ok"
+
+	r := New(cfg, newMockHarness(cfg))
+	result := r.validate(context.Background())
+
+	assert.True(t, result.Success)
+	assert.Equal(t, "ok\n", result.Output)
+	require.Len(t, result.Stages, 1)
+	assert.Equal(t, config.DefaultStageName, result.Stages[0].Name)
+}
+
+func TestValidate_FailFast(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Validate.Stages = []config.Stage{
+		{Name: "build", Command: "echo built"},
+		{Name: "vet", Command: "echo vet failed; exit 2"},
+		{Name: "test", Command: "echo tested"},
+	}
+
+	r := New(cfg, newMockHarness(cfg))
+	rec := &recorder{}
+	r.Subscribe(rec)
+	result := r.validate(context.Background())
+
+	assert.False(t, result.Success)
+	assert.Equal(t, []string{"vet"}, result.FailedStages())
+	require.Len(t, result.Stages, 3)
+	assert.True(t, result.Stages[0].Success)
+	assert.Equal(t, 2, result.Stages[1].ExitCode)
+	assert.True(t, result.Stages[2].Skipped)
+
+	assert.Contains(t, result.Output, "=== stage build (passed): echo built ===\nbuilt\n")
+	assert.Contains(t, result.Output, "=== stage vet (failed): echo vet failed; exit 2 ===\nvet failed\n")
+	assert.NotContains(t, result.Output, "tested")
+
+	assert.Equal(t, []string{
+		"ValidationStart",
+		"StageStart", "StageResult",
+		"StageStart", "StageResult",
+		"StageResult", // skipped
+		"ValidationResult",
+	}, rec.kinds())
+}
+
+func TestValidate_ContinueOnFailure(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Validate.Stages = []config.Stage{
+		{Name: "lint", Command: "exit 1", ContinueOnFailure: true},
+		{Name: "test", Command: "echo tested"},
+	}
+
+	r := New(cfg, newMockHarness(cfg))
+	result := r.validate(context.Background())
+
+	assert.False(t, result.Success)
+	assert.Equal(t, []string{"lint"}, result.FailedStages())
+	assert.True(t, result.Stages[1].Success)
+	assert.Contains(t, result.Output, "tested")
+}
+
+func TestValidate_StageDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "marker"), nil, 0644))
+
+	cfg := &config.Config{}
+	cfg.Validate.Stages = []config.Stage{
+		{Name: "in-dir", Command: "test -f marker", Dir: dir},
+	}
+
+	r := New(cfg, newMockHarness(cfg))
+	assert.True(t, r.validate(context.Background()).Success)
+}
+
+func TestValidate_StageTimeout(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Validate.Stages = []config.Stage{
+		{Name: "slow", Command: "sleep 5", Timeout: 100 * time.Millisecond},
+		{Name: "after", Command: "exit 0"},
+	}
+
+	r := New(cfg, newMockHarness(cfg))
+	result := r.validate(context.Background())
+
+	assert.False(t, result.Success)
+	assert.True(t, IsTimeout(result.Err))
+	assert.Contains(t, result.Output, "validation stage slow timed out after 100ms")
+	assert.True(t, result.Stages[1].Skipped)
+}
+
+func TestRunner_RetryPromptNamesFailedStage(t *testing.T) {
+	dir := t.TempDir()
+	prompts := filepath.Join(dir, "prompts.txt")
+
+	cfg := &config.Config{}
+	cfg.Agent.Command = "echo \"%s\" >> " + prompts
+	cfg.Agent.PromptVia = config.PromptViaShell
+	cfg.Validate.Stages = []config.Stage{
+		{Name: "build", Command: "exit 0"},
+		{Name: "test", Command: "exit 1"},
+	}
+
+	r := NewWithMaxIterations(cfg, newMockHarness(cfg), 2)
+	require.Error(t, r.Run(context.Background(), "task"))
+
+	data, err := os.ReadFile(prompts)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "(failed stage: test)")
+}
+
+func TestValidate_ParsesTestResults(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Validate.Command = `printf -- '--- PASS: TestA (0.00s)\n--- FAIL: TestB (0.00s)\n    b_test.go:9: want 2, got 3\nFAIL\nnoise line\n'; exit 1`
+	cfg.Validate.Parser = "go"
+
+	r := New(cfg, newMockHarness(cfg))
+	first := r.validate(context.Background())
+
+	require.NotNil(t, first.Report)
+	assert.Equal(t, 1, first.Report.Passed)
+	assert.Equal(t, 1, first.Report.Failed)
+	assert.Nil(t, first.PreviousReport)
+	assert.Contains(t, first.Feedback, "--- FAIL: TestB\nb_test.go:9: want 2, got 3")
+	assert.NotContains(t, first.Feedback, "noise line")
+	assert.Contains(t, first.Output, "noise line")
+
+	r.lastReport = first.Report
+	second := r.validate(context.Background())
+	assert.Same(t, first.Report, second.PreviousReport)
+}
+
+func TestValidate_IncompleteReportFeedsRawOutput(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Validate.Command = `printf -- './x.go:1: syntax error\nFAIL\texample.com/x [build failed]\n--- FAIL: TestB (0.00s)\n'; exit 1`
+	cfg.Validate.Parser = "go"
+
+	result := New(cfg, newMockHarness(cfg)).validate(context.Background())
+
+	require.NotNil(t, result.Report)
+	assert.True(t, result.Report.Incomplete)
+	assert.Contains(t, result.Feedback, "syntax error")
+}
+
+func TestValidate_ReportFile(t *testing.T) {
+	dir := t.TempDir()
+	report := `<testsuite><testcase classname="pkg" name="ok"/><testcase classname="pkg" name="bad"><failure message="boom">trace</failure></testcase></testsuite>`
+	cfg := &config.Config{}
+	cfg.Validate.Stages = []config.Stage{{
+		Name:    "test",
+		Command: "echo '" + report + "' > report.xml; exit 1",
+		Dir:     dir,
+		Parser:  "junit",
+		Report:  "report.xml",
+	}}
+
+	result := New(cfg, newMockHarness(cfg)).validate(context.Background())
+
+	require.NotNil(t, result.Report)
+	assert.Equal(t, 1, result.Report.Failed)
+	assert.Contains(t, result.Feedback, "--- FAIL: pkg.bad\ntrace")
+}
@@ -0,0 +1,153 @@
+package testresult
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// GoParser parses `go test -json` output, falling back to the plain text
+// format (`--- FAIL: TestName (0.00s)`) when the output is not JSON.
+type GoParser struct{}
+
+// Name implements Parser.
+func (GoParser) Name() string { return FormatGo }
+
+// goTestEvent is a line of `go test -json` (test2json) output.
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+var (
+	// goResultLine matches "--- FAIL: TestName (0.01s)" (any indentation for subtests).
+	goResultLine = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (\S+)`)
+	// goPackageFailure matches package-level failures not tied to a test.
+	goPackageFailure = regexp.MustCompile(`^FAIL\s+\S+\s+\[(build|setup) failed\]|^panic: `)
+)
+
+// Parse implements Parser.
+func (p GoParser) Parse(data []byte) (*Report, error) {
+	if looksLikeJSONLines(data) {
+		return p.parseJSON(data)
+	}
+	return p.parseText(data), nil
+}
+
+func (GoParser) parseJSON(data []byte) (*Report, error) {
+	report := &Report{}
+	output := make(map[string]*strings.Builder)
+	failedTests := make(map[string]bool) // packages with at least one failed test
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var ev goTestEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			// Non-JSON lines are build errors printed by go test itself
+			if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+				report.Incomplete = true
+			}
+			continue
+		}
+		if ev.Test == "" {
+			// A package failing without a failed test: build error, panic, TestMain exit
+			if ev.Action == "fail" && !failedTests[ev.Package] {
+				report.Incomplete = true
+			}
+			continue
+		}
+		name := ev.Package + "." + ev.Test
+		switch ev.Action {
+		case "run":
+			if _, ok := output[name]; !ok {
+				output[name] = &strings.Builder{}
+			}
+		case "output":
+			if b, ok := output[name]; ok {
+				b.WriteString(ev.Output)
+			}
+		case "pass", "fail", "skip":
+			test := Test{Name: name, Status: goStatus(ev.Action)}
+			if test.Status == Failed {
+				failedTests[ev.Package] = true
+				if b, ok := output[name]; ok {
+					test.Message = trimGoOutput(b.String())
+				}
+			}
+			report.Tests = append(report.Tests, test)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	report.count()
+	return report, nil
+}
+
+func (GoParser) parseText(data []byte) *Report {
+	report := &Report{}
+	var current *Test
+	indent := ""
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if goPackageFailure.MatchString(line) {
+			report.Incomplete = true
+		}
+		if m := goResultLine.FindStringSubmatch(line); m != nil {
+			report.Tests = append(report.Tests, Test{Name: m[2], Status: goStatus(strings.ToLower(m[1]))})
+			current = &report.Tests[len(report.Tests)-1]
+			indent = line[:len(line)-len(strings.TrimLeft(line, " "))] + "    "
+			continue
+		}
+		// Log lines of a failed test follow its result line, indented
+		if current != nil && current.Status == Failed && strings.HasPrefix(line, indent) {
+			current.Message += strings.TrimPrefix(line, indent) + "\n"
+			continue
+		}
+		current = nil
+	}
+	report.count()
+	return report
+}
+
+func goStatus(action string) Status {
+	switch action {
+	case "pass":
+		return Passed
+	case "skip":
+		return Skipped
+	default:
+		return Failed
+	}
+}
+
+// trimGoOutput drops test2json framing lines ("=== RUN", "--- FAIL") from a
+// test's output, keeping the log lines that explain the failure.
+func trimGoOutput(out string) string {
+	var kept []string
+	for _, line := range strings.Split(out, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- ") || trimmed == "" {
+			continue
+		}
+		kept = append(kept, trimmed)
+	}
+	return strings.Join(kept, "\n")
+}
+
+// looksLikeJSONLines reports whether any line is a JSON object. Build errors
+// are printed as plain text even with -json, so the first line may not be.
+func looksLikeJSONLines(data []byte) bool {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && line[0] == '{' && json.Valid(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package testresult
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoParser_JSON(t *testing.T) {
+	output := `# example.com/pkg [build output ignored]
+{"Action":"start","Package":"example.com/pkg"}
+{"Action":"run","Package":"example.com/pkg","Test":"TestAdd"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestAdd","Output":"=== RUN   TestAdd\n"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestAdd","Output":"--- PASS: TestAdd (0.00s)\n"}
+{"Action":"pass","Package":"example.com/pkg","Test":"TestAdd","Elapsed":0}
+{"Action":"run","Package":"example.com/pkg","Test":"TestSub"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestSub","Output":"=== RUN   TestSub\n"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestSub","Output":"    math_test.go:12: got 3, want 1\n"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestSub","Output":"--- FAIL: TestSub (0.00s)\n"}
+{"Action":"fail","Package":"example.com/pkg","Test":"TestSub","Elapsed":0}
+{"Action":"run","Package":"example.com/pkg","Test":"TestSlow"}
+{"Action":"skip","Package":"example.com/pkg","Test":"TestSlow","Elapsed":0}
+{"Action":"fail","Package":"example.com/pkg","Elapsed":0.01}
+`
+	report, err := GoParser{}.Parse([]byte(output))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Passed)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, 1, report.Skipped)
+	failing := report.Failing()
+	require.Len(t, failing, 1)
+	assert.Equal(t, "example.com/pkg.TestSub", failing[0].Name)
+	assert.Equal(t, "math_test.go:12: got 3, want 1", failing[0].Message)
+}
+
+func TestGoParser_Text(t *testing.T) {
+	output := `--- FAIL: TestSub (0.00s)
+    math_test.go:12: got 3, want 1
+    math_test.go:13: second line
+--- FAIL: TestTable (0.00s)
+    --- FAIL: TestTable/negative (0.00s)
+        table_test.go:20: wrong sign
+    --- PASS: TestTable/positive (0.00s)
+--- SKIP: TestSlow (0.00s)
+    slow_test.go:5: short mode
+FAIL
+FAIL	example.com/pkg	0.005s
+`
+	report, err := GoParser{}.Parse([]byte(output))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"TestSub", "TestTable", "TestTable/negative"}, report.Names(Failed))
+	assert.Equal(t, []string{"TestSlow"}, report.Names(Skipped))
+	assert.Equal(t, 1, report.Passed)
+
+	failing := report.Failing()
+	assert.Equal(t, "math_test.go:12: got 3, want 1\nmath_test.go:13: second line\n", failing[0].Message)
+	assert.Equal(t, "table_test.go:20: wrong sign\n", failing[2].Message)
+}
+
+func TestGoParser_BuildFailureIsIncomplete(t *testing.T) {
+	output := `# example.com/pkg
+./pkg.go:3:1: syntax error
+FAIL	example.com/pkg [build failed]
+--- FAIL: TestOther (0.00s)
+    other_test.go:5: boom
+FAIL	example.com/other	0.002s
+`
+	report, err := GoParser{}.Parse([]byte(output))
+	require.NoError(t, err)
+	assert.True(t, report.Incomplete)
+	assert.Equal(t, 1, report.Failed)
+
+	json := `{"Action":"start","Package":"example.com/pkg"}
+{"Action":"output","Package":"example.com/pkg","Output":"FAIL\texample.com/pkg [build failed]\n"}
+{"Action":"fail","Package":"example.com/pkg","Elapsed":0}
+`
+	report, err = Parse(FormatGo, []byte(json))
+	require.NoError(t, err)
+	require.NotNil(t, report, "an incomplete report is kept even without tests")
+	assert.True(t, report.Incomplete)
+}
@@ -0,0 +1,143 @@
+package testresult
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JestParser parses Jest output: the `--json` report when present,
+// otherwise the default reporter's text (`● Suite › test` failure blocks,
+// verbose `✓`/`○` lines and the `Tests:` summary line).
+type JestParser struct{}
+
+// Name implements Parser.
+func (JestParser) Name() string { return FormatJest }
+
+type jestJSON struct {
+	NumPassedTests  int `json:"numPassedTests"`
+	NumFailedTests  int `json:"numFailedTests"`
+	NumPendingTests int `json:"numPendingTests"`
+	NumTodoTests    int `json:"numTodoTests"`
+	TestResults     []struct {
+		AssertionResults []struct {
+			FullName        string   `json:"fullName"`
+			Status          string   `json:"status"`
+			FailureMessages []string `json:"failureMessages"`
+		} `json:"assertionResults"`
+	} `json:"testResults"`
+}
+
+var (
+	jestFailureHeader = regexp.MustCompile(`^\s*● (.+)$`)
+	jestPassLine      = regexp.MustCompile(`^\s+✓ (.+?)(?: \(\d+(?:\.\d+)? ?m?s\))?$`)
+	jestSkipLine      = regexp.MustCompile(`^\s+○ (?:skipped |todo )?(.+)$`)
+	jestFileLine      = regexp.MustCompile(`^(PASS|FAIL) \S`)
+	jestSummary       = regexp.MustCompile(`^Tests:\s+(.+)$`)
+	jestCount         = regexp.MustCompile(`(\d+) (failed|passed|skipped|todo|total)`)
+	// ansiEscape strips colour codes; Jest colours output even when piped in CI
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+// Parse implements Parser.
+func (p JestParser) Parse(data []byte) (*Report, error) {
+	if i := bytes.Index(data, []byte(`{"num`)); i >= 0 {
+		var report jestJSON
+		if err := json.NewDecoder(bytes.NewReader(data[i:])).Decode(&report); err == nil {
+			return p.fromJSON(report), nil
+		}
+	}
+	return p.parseText(data), nil
+}
+
+func (JestParser) fromJSON(j jestJSON) *Report {
+	report := &Report{}
+	for _, file := range j.TestResults {
+		for _, a := range file.AssertionResults {
+			t := Test{Name: a.FullName}
+			switch a.Status {
+			case "passed":
+				t.Status = Passed
+			case "failed":
+				t.Status = Failed
+				t.Message = strings.Join(a.FailureMessages, "\n")
+			default: // pending, skipped, todo, disabled
+				t.Status = Skipped
+			}
+			report.Tests = append(report.Tests, t)
+		}
+	}
+	report.Passed = j.NumPassedTests
+	report.Failed = j.NumFailedTests
+	report.Skipped = j.NumPendingTests + j.NumTodoTests
+	return report
+}
+
+func (JestParser) parseText(data []byte) *Report {
+	report := &Report{}
+	var current *strings.Builder
+	var currentName string
+	summary := ""
+
+	flush := func() {
+		if current != nil {
+			report.Tests = append(report.Tests, Test{
+				Name:    currentName,
+				Status:  Failed,
+				Message: strings.TrimSpace(current.String()),
+			})
+			current = nil
+		}
+	}
+
+	for _, line := range strings.Split(ansiEscape.ReplaceAllString(string(data), ""), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if m := jestSummary.FindStringSubmatch(line); m != nil {
+			flush()
+			summary = m[1]
+			continue
+		}
+		if m := jestFailureHeader.FindStringSubmatch(line); m != nil {
+			flush()
+			if strings.TrimSpace(m[1]) == "Test suite failed to run" {
+				report.Incomplete = true
+			}
+			current = &strings.Builder{}
+			currentName = strings.TrimSpace(m[1])
+			continue
+		}
+		if jestFileLine.MatchString(line) || strings.HasPrefix(line, "Test Suites:") {
+			flush()
+			continue
+		}
+		if current != nil {
+			current.WriteString(line + "\n")
+			continue
+		}
+		if m := jestPassLine.FindStringSubmatch(line); m != nil {
+			report.Tests = append(report.Tests, Test{Name: m[1], Status: Passed})
+		} else if m := jestSkipLine.FindStringSubmatch(line); m != nil {
+			report.Tests = append(report.Tests, Test{Name: m[1], Status: Skipped})
+		}
+	}
+	flush()
+
+	report.count()
+	if summary != "" {
+		report.Passed, report.Failed, report.Skipped = 0, 0, 0
+		for _, m := range jestCount.FindAllStringSubmatch(summary, -1) {
+			n, _ := strconv.Atoi(m[1])
+			switch m[2] {
+			case "passed":
+				report.Passed = n
+			case "failed":
+				report.Failed = n
+			case "skipped", "todo":
+				report.Skipped += n
+			}
+		}
+	}
+	return report
+}
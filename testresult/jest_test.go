@@ -0,0 +1,66 @@
+package testresult
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJestParser_Text(t *testing.T) {
+	output := "FAIL src/math.test.js\n" +
+		"  math\n" +
+		"    ✓ adds (3 ms)\n" +
+		"    ✕ subtracts (2 ms)\n" +
+		"    ○ skipped divides\n" +
+		"\n" +
+		"  ● math › subtracts\n" +
+		"\n" +
+		"    expect(received).toBe(expected)\n" +
+		"\n" +
+		"    Expected: 1\n" +
+		"    Received: 3\n" +
+		"\n" +
+		"Test Suites: 1 failed, 1 total\n" +
+		"Tests:       1 failed, 1 skipped, 1 passed, 3 total\n"
+
+	report, err := JestParser{}.Parse([]byte(output))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Passed)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, 1, report.Skipped)
+
+	failing := report.Failing()
+	require.Len(t, failing, 1)
+	assert.Equal(t, "math › subtracts", failing[0].Name)
+	assert.Contains(t, failing[0].Message, "Expected: 1\n    Received: 3")
+	assert.Equal(t, []string{"adds"}, report.Names(Passed))
+	assert.Equal(t, []string{"divides"}, report.Names(Skipped))
+}
+
+func TestJestParser_StripsColour(t *testing.T) {
+	output := "\x1b[1mTests:\x1b[22m       \x1b[1m\x1b[31m2 failed\x1b[39m\x1b[22m, \x1b[1m\x1b[32m5 passed\x1b[39m\x1b[22m, 7 total\n"
+
+	report, err := JestParser{}.Parse([]byte(output))
+	require.NoError(t, err)
+	assert.Equal(t, 5, report.Passed)
+	assert.Equal(t, 2, report.Failed)
+}
+
+func TestJestParser_JSON(t *testing.T) {
+	output := `{"numFailedTests":1,"numPassedTests":1,"numPendingTests":1,"numTodoTests":0,
+"testResults":[{"assertionResults":[
+ {"fullName":"math adds","status":"passed","failureMessages":[]},
+ {"fullName":"math subtracts","status":"failed","failureMessages":["Expected: 1\nReceived: 3"]},
+ {"fullName":"math divides","status":"pending","failureMessages":[]}
+]}]}`
+
+	report, err := JestParser{}.Parse([]byte(output))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Passed)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, "Expected: 1\nReceived: 3", report.Failing()[0].Message)
+}
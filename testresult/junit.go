@@ -0,0 +1,97 @@
+package testresult
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// JUnitParser parses JUnit XML reports (<testsuites> or a single
+// <testsuite>), as written by most test runners' JUnit reporters.
+type JUnitParser struct{}
+
+// Name implements Parser.
+func (JUnitParser) Name() string { return FormatJUnit }
+
+type junitSuites struct {
+	Suites []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Suites []junitSuite `xml:"testsuite"` // suites may nest
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	Error     *junitFailure `xml:"error"`
+	Skipped   *struct{}     `xml:"skipped"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Parse implements Parser.
+func (JUnitParser) Parse(data []byte) (*Report, error) {
+	start := bytes.Index(data, []byte("<testsuite"))
+	if start < 0 {
+		return nil, nil
+	}
+
+	var suites []junitSuite
+	if bytes.HasPrefix(data[start:], []byte("<testsuites")) {
+		var root junitSuites
+		if err := xml.Unmarshal(data[start:], &root); err != nil {
+			return nil, fmt.Errorf("parse JUnit XML: %w", err)
+		}
+		suites = root.Suites
+	} else {
+		var suite junitSuite
+		if err := xml.Unmarshal(data[start:], &suite); err != nil {
+			return nil, fmt.Errorf("parse JUnit XML: %w", err)
+		}
+		suites = []junitSuite{suite}
+	}
+
+	report := &Report{}
+	var walk func([]junitSuite)
+	walk = func(suites []junitSuite) {
+		for _, suite := range suites {
+			for _, c := range suite.Cases {
+				report.Tests = append(report.Tests, c.test())
+			}
+			walk(suite.Suites)
+		}
+	}
+	walk(suites)
+	report.count()
+	return report, nil
+}
+
+func (c junitCase) test() Test {
+	name := c.Name
+	if c.ClassName != "" {
+		name = c.ClassName + "." + c.Name
+	}
+	failure := c.Failure
+	if failure == nil {
+		failure = c.Error
+	}
+	switch {
+	case failure != nil:
+		msg := strings.TrimSpace(failure.Text)
+		if msg == "" {
+			msg = failure.Message
+		}
+		return Test{Name: name, Status: Failed, Message: msg}
+	case c.Skipped != nil:
+		return Test{Name: name, Status: Skipped}
+	default:
+		return Test{Name: name, Status: Passed}
+	}
+}
@@ -0,0 +1,57 @@
+package testresult
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJUnitParser(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="calc" tests="4">
+    <testcase classname="calc.AddTest" name="adds"/>
+    <testcase classname="calc.SubTest" name="subtracts">
+      <failure message="expected 1">expected 1 but was 3
+  at SubTest.java:12</failure>
+    </testcase>
+    <testcase classname="calc.DivTest" name="divides">
+      <error message="ArithmeticException"/>
+    </testcase>
+    <testcase classname="calc.SlowTest" name="slow"><skipped/></testcase>
+  </testsuite>
+</testsuites>`
+
+	report, err := JUnitParser{}.Parse([]byte(xml))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Passed)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, 1, report.Skipped)
+	failing := report.Failing()
+	require.Len(t, failing, 2)
+	assert.Equal(t, "calc.SubTest.subtracts", failing[0].Name)
+	assert.Equal(t, "expected 1 but was 3\n  at SubTest.java:12", failing[0].Message)
+	assert.Equal(t, "ArithmeticException", failing[1].Message)
+}
+
+func TestJUnitParser_SingleSuite(t *testing.T) {
+	xml := `<testsuite name="s"><testcase name="a"/><testcase name="b"/></testsuite>`
+
+	report, err := JUnitParser{}.Parse([]byte(xml))
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Passed)
+	assert.Equal(t, "a", report.Tests[0].Name)
+}
+
+func TestJUnitParser_NotXML(t *testing.T) {
+	report, err := JUnitParser{}.Parse([]byte("no report here"))
+	require.NoError(t, err)
+	assert.Nil(t, report)
+}
+
+func TestJUnitParser_Malformed(t *testing.T) {
+	_, err := JUnitParser{}.Parse([]byte(`<testsuite><testcase name="a">`))
+	require.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package testresult
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PytestParser parses pytest's terminal output. Per-test results come from
+// verbose lines (`path::test PASSED`) and the short test summary
+// (`FAILED path::test - message`); failure messages from the FAILURES
+// section; counts from the final `== 1 failed, 3 passed in 0.1s ==` line.
+type PytestParser struct{}
+
+// Name implements Parser.
+func (PytestParser) Name() string { return FormatPytest }
+
+var (
+	pytestVerbose  = regexp.MustCompile(`^(\S+::\S+)\s+(PASSED|FAILED|SKIPPED|ERROR|XFAIL|XPASS)\b`)
+	pytestShort    = regexp.MustCompile(`^(FAILED|ERROR) (\S+::\S+)(?: - (.*))?$`)
+	pytestSection  = regexp.MustCompile(`^=+ (.+?) =+$`)
+	pytestHeader   = regexp.MustCompile(`^_{3,} (.+?) _{3,}$`)
+	pytestSummary  = regexp.MustCompile(`^=+ .*\bin [\d.]+s\b.* =+$`)
+	pytestCount    = regexp.MustCompile(`(\d+) (failed|passed|skipped|errors?|xfailed|xpassed)\b`)
+	pytestStatuses = map[string]Status{
+		"PASSED":  Passed,
+		"XPASS":   Passed,
+		"FAILED":  Failed,
+		"ERROR":   Failed,
+		"SKIPPED": Skipped,
+		"XFAIL":   Skipped,
+	}
+)
+
+// Parse implements Parser.
+func (PytestParser) Parse(data []byte) (*Report, error) {
+	report := &Report{}
+	index := make(map[string]int) // nodeid -> position in report.Tests
+	add := func(name string, status Status, msg string) {
+		if i, ok := index[name]; ok {
+			report.Tests[i].Status = status
+			if msg != "" && report.Tests[i].Message == "" {
+				report.Tests[i].Message = msg
+			}
+			return
+		}
+		index[name] = len(report.Tests)
+		report.Tests = append(report.Tests, Test{Name: name, Status: status, Message: msg})
+	}
+
+	sections := make(map[string]*strings.Builder) // failure section title -> text
+	var current *strings.Builder
+	inFailures := false
+	summary := ""
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if m := pytestSection.FindStringSubmatch(line); m != nil {
+			inFailures = m[1] == "FAILURES" || m[1] == "ERRORS"
+			if m[1] == "ERRORS" {
+				// Collection/fixture errors are not test failures
+				report.Incomplete = true
+			}
+			current = nil
+			if pytestSummary.MatchString(line) {
+				summary = line
+			}
+			continue
+		}
+		if inFailures {
+			if m := pytestHeader.FindStringSubmatch(line); m != nil {
+				current = &strings.Builder{}
+				sections[m[1]] = current
+				continue
+			}
+			if current != nil {
+				current.WriteString(line + "\n")
+			}
+			continue
+		}
+		if m := pytestShort.FindStringSubmatch(line); m != nil {
+			add(m[2], Failed, m[3])
+			continue
+		}
+		if m := pytestVerbose.FindStringSubmatch(line); m != nil {
+			add(m[1], pytestStatuses[m[2]], "")
+		}
+	}
+
+	// Prefer the full traceback from the FAILURES section
+	for i, t := range report.Tests {
+		if t.Status != Failed {
+			continue
+		}
+		if text, ok := sections[pytestSectionTitle(t.Name)]; ok {
+			report.Tests[i].Message = strings.TrimRight(text.String(), "\n")
+		}
+	}
+
+	report.count()
+	if summary != "" {
+		applyPytestCounts(report, summary)
+	}
+	return report, nil
+}
+
+// pytestSectionTitle converts a node id ("tests/test_a.py::TestX::test_b")
+// to the title pytest uses for its failure section ("TestX.test_b").
+func pytestSectionTitle(nodeID string) string {
+	parts := strings.Split(nodeID, "::")
+	if len(parts) < 2 {
+		return nodeID
+	}
+	return strings.Join(parts[1:], ".")
+}
+
+// applyPytestCounts overrides the counts with pytest's own summary line,
+// which covers tests not listed individually in non-verbose mode.
+func applyPytestCounts(report *Report, summary string) {
+	report.Passed, report.Failed, report.Skipped = 0, 0, 0
+	for _, m := range pytestCount.FindAllStringSubmatch(summary, -1) {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "passed", "xpassed":
+			report.Passed += n
+		case "failed", "error", "errors":
+			report.Failed += n
+		case "skipped", "xfailed":
+			report.Skipped += n
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package testresult
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPytestParser_Verbose(t *testing.T) {
+	output := `============================= test session starts ==============================
+collected 4 items
+
+tests/test_calc.py::test_add PASSED                                      [ 25%]
+tests/test_calc.py::TestSub::test_sub FAILED                             [ 50%]
+tests/test_calc.py::test_slow SKIPPED (too slow)                         [ 75%]
+tests/test_calc.py::test_mul PASSED                                      [100%]
+
+=================================== FAILURES ===================================
+_______________________________ TestSub.test_sub _______________________________
+
+    def test_sub(self):
+>       assert sub(3, 1) == 1
+E       assert 2 == 1
+
+tests/test_calc.py:12: AssertionError
+=========================== short test summary info ============================
+FAILED tests/test_calc.py::TestSub::test_sub - assert 2 == 1
+=================== 1 failed, 2 passed, 1 skipped in 0.03s ====================
+`
+	report, err := PytestParser{}.Parse([]byte(output))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.Passed)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Len(t, report.Tests, 4)
+
+	failing := report.Failing()
+	require.Len(t, failing, 1)
+	assert.Equal(t, "tests/test_calc.py::TestSub::test_sub", failing[0].Name)
+	assert.Contains(t, failing[0].Message, "E       assert 2 == 1")
+	assert.Contains(t, failing[0].Message, "tests/test_calc.py:12: AssertionError")
+}
+
+func TestPytestParser_Quiet(t *testing.T) {
+	// Default (non-verbose) output only names failing tests
+	output := `..F.s
+=========================== short test summary info ============================
+FAILED tests/test_api.py::test_login - KeyError: 'token'
+ERROR tests/test_db.py::test_conn - ConnectionError
+============== 1 failed, 3 passed, 1 skipped, 1 error in 1.20s ===============
+`
+	report, err := PytestParser{}.Parse([]byte(output))
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.Passed)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, 1, report.Skipped)
+	failing := report.Failing()
+	require.Len(t, failing, 2)
+	assert.Equal(t, "KeyError: 'token'", failing[0].Message)
+	assert.Equal(t, "tests/test_db.py::test_conn", failing[1].Name)
+}
@@ -0,0 +1,176 @@
+// Package testresult parses test runner output (go test, JUnit XML, pytest,
+// Jest) into a common Report of passed, failed and skipped tests.
+package testresult
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Status is the outcome of a single test.
+type Status string
+
+const (
+	Passed  Status = "passed"
+	Failed  Status = "failed"
+	Skipped Status = "skipped"
+)
+
+// Test is a single test case.
+type Test struct {
+	Name    string
+	Status  Status
+	Message string // failure output, if any
+}
+
+// Report is the parsed result of a test run. The counts are authoritative:
+// some formats only list failing tests individually but report totals in a
+// summary line, so Tests may hold fewer entries than the counts add up to.
+type Report struct {
+	Tests   []Test
+	Passed  int
+	Failed  int
+	Skipped int
+	// Incomplete is set when the output shows failures that are not
+	// attributed to a test (build errors, collection errors, crashed
+	// suites). The raw output is then needed to see what went wrong.
+	Incomplete bool
+}
+
+// Total returns the number of tests that ran or were skipped.
+func (r *Report) Total() int {
+	return r.Passed + r.Failed + r.Skipped
+}
+
+// Failing returns the failed tests in the order they were reported.
+func (r *Report) Failing() []Test {
+	return r.withStatus(Failed)
+}
+
+// SkippedTests returns the skipped tests in the order they were reported.
+func (r *Report) SkippedTests() []Test {
+	return r.withStatus(Skipped)
+}
+
+func (r *Report) withStatus(status Status) []Test {
+	var tests []Test
+	for _, t := range r.Tests {
+		if t.Status == status {
+			tests = append(tests, t)
+		}
+	}
+	return tests
+}
+
+// Names returns the sorted names of tests with the given status.
+func (r *Report) Names(status Status) []string {
+	var names []string
+	for _, t := range r.withStatus(status) {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Summary is a one-line description such as "10 passed, 2 failed, 1 skipped".
+func (r *Report) Summary() string {
+	return fmt.Sprintf("%d passed, %d failed, %d skipped", r.Passed, r.Failed, r.Skipped)
+}
+
+// FailureText formats the failing tests and their messages for the agent.
+func (r *Report) FailureText() string {
+	var b strings.Builder
+	for _, t := range r.Failing() {
+		fmt.Fprintf(&b, "--- FAIL: %s\n", t.Name)
+		if msg := strings.TrimRight(t.Message, "\n"); msg != "" {
+			b.WriteString(msg)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// Merge returns a report combining r and other (either may be nil).
+func Merge(r, other *Report) *Report {
+	if r == nil {
+		return other
+	}
+	if other == nil {
+		return r
+	}
+	return &Report{
+		Tests:      append(append([]Test(nil), r.Tests...), other.Tests...),
+		Passed:     r.Passed + other.Passed,
+		Failed:     r.Failed + other.Failed,
+		Skipped:    r.Skipped + other.Skipped,
+		Incomplete: r.Incomplete || other.Incomplete,
+	}
+}
+
+// count sets the counts from Tests.
+func (r *Report) count() {
+	r.Passed, r.Failed, r.Skipped = 0, 0, 0
+	for _, t := range r.Tests {
+		switch t.Status {
+		case Passed:
+			r.Passed++
+		case Failed:
+			r.Failed++
+		case Skipped:
+			r.Skipped++
+		}
+	}
+}
+
+// Parser extracts a Report from test output. Parse returns a nil Report
+// (and no error) when the output contains no recognisable test results,
+// e.g. a compile error before any test ran.
+type Parser interface {
+	Name() string
+	Parse(data []byte) (*Report, error)
+}
+
+// Parser names accepted in tatsu.yaml.
+const (
+	FormatNone   = "none"
+	FormatGo     = "go"
+	FormatJUnit  = "junit"
+	FormatPytest = "pytest"
+	FormatJest   = "jest"
+)
+
+// Formats lists the parser names accepted by Get.
+var Formats = []string{FormatGo, FormatJUnit, FormatPytest, FormatJest, FormatNone}
+
+// Get returns the parser for a format name. FormatNone returns nil.
+func Get(format string) (Parser, error) {
+	switch format {
+	case FormatGo, "gotest":
+		return GoParser{}, nil
+	case FormatJUnit:
+		return JUnitParser{}, nil
+	case FormatPytest:
+		return PytestParser{}, nil
+	case FormatJest:
+		return JestParser{}, nil
+	case FormatNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown test result parser %q (expected one of %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// Parse parses data with the named format. It returns nil for FormatNone
+// and for output without test results.
+func Parse(format string, data []byte) (*Report, error) {
+	p, err := Get(format)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	report, err := p.Parse(data)
+	if err != nil || report == nil || (report.Total() == 0 && !report.Incomplete) {
+		return nil, err
+	}
+	return report, nil
+}
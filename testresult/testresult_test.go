@@ -0,0 +1,64 @@
+package testresult
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGet(t *testing.T) {
+	for _, format := range []string{FormatGo, FormatJUnit, FormatPytest, FormatJest} {
+		p, err := Get(format)
+		require.NoError(t, err)
+		assert.Equal(t, format, p.Name())
+	}
+
+	p, err := Get(FormatNone)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	_, err = Get("mocha")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown test result parser "mocha"`)
+}
+
+func TestParse_NoTestsIsNil(t *testing.T) {
+	report, err := Parse(FormatGo, []byte("./main.go:3:1: syntax error\n"))
+	require.NoError(t, err)
+	assert.Nil(t, report)
+
+	report, err = Parse(FormatNone, []byte("--- FAIL: TestX (0.00s)\n"))
+	require.NoError(t, err)
+	assert.Nil(t, report)
+}
+
+func TestReport_Helpers(t *testing.T) {
+	r := &Report{Tests: []Test{
+		{Name: "b", Status: Failed, Message: "boom\n"},
+		{Name: "a", Status: Failed},
+		{Name: "c", Status: Skipped},
+		{Name: "d", Status: Passed},
+	}}
+	r.count()
+
+	assert.Equal(t, "1 passed, 2 failed, 1 skipped", r.Summary())
+	assert.Equal(t, 4, r.Total())
+	assert.Equal(t, []string{"a", "b"}, r.Names(Failed))
+	assert.Len(t, r.SkippedTests(), 1)
+	assert.Equal(t, "--- FAIL: b\nboom\n--- FAIL: a\n", r.FailureText())
+}
+
+func TestMerge(t *testing.T) {
+	a := &Report{Tests: []Test{{Name: "a", Status: Passed}}, Passed: 1}
+	b := &Report{Tests: []Test{{Name: "b", Status: Failed}}, Failed: 1}
+
+	assert.Same(t, a, Merge(a, nil))
+	assert.Same(t, b, Merge(nil, b))
+
+	merged := Merge(a, b)
+	assert.Equal(t, 1, merged.Passed)
+	assert.Equal(t, 1, merged.Failed)
+	assert.Len(t, merged.Tests, 2)
+	assert.Len(t, a.Tests, 1, "inputs are not modified")
+}
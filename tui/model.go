@@ -1,7 +1,9 @@
 package tui
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 	"unicode"
@@ -10,6 +12,8 @@ import (
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/jack/tatsu/config"
+	"github.com/jack/tatsu/harness"
+	"github.com/jack/tatsu/runner"
 )
 
 // Mode is either "task" or "prd"
@@ -28,36 +32,11 @@ const (
 	stateDone
 )
 
-// Messages from run goroutine
-type iterationStartMsg struct {
-	iter    int
-	maxIter int
-}
-
-type agentOutputMsg struct {
-	line string
-}
-
-type agentErrorMsg struct {
-	err string
-}
-
-type validationStartMsg struct{}
-
-type validationResultMsg struct {
-	success bool
-	output  string
-}
-
-type runCompleteMsg struct {
-	success bool
-	errMsg  string
-}
-
-type prdTaskStartMsg struct {
-	current int
-	total   int
-	title   string
+// confirmMsg asks the user a yes/no question for the run goroutine, which
+// waits on answer.
+type confirmMsg struct {
+	question string
+	answer   chan bool
 }
 
 // iterationTickMsg forces a repaint after iteration update (so UI shows new count)
@@ -100,22 +79,33 @@ type model struct {
 	state  appState
 
 	// run context (set when starting run)
-	cfg        *config.Config
-	maxIter    int
-	send       func(tea.Msg)
-	runMode    Mode
-	runInput   string
-	prdCurrent int
-	prdTotal   int
-	prdTitle   string
+	cfg         *config.Config
+	harness     harness.Harness
+	maxIter     int
+	load        runner.ProfileLoader
+	profiles    []string // selectable profiles; "" is the config as loaded
+	profile     int      // index of the selected profile
+	send        func(tea.Msg)
+	runMode     Mode
+	runInput    string
+	prdCurrent  int
+	prdTotal    int
+	prdTitle    string
+	taskProfile string             // profile of the current task, if any
+	cancel      context.CancelFunc // stops the current run and kills its processes
+	done        chan struct{}      // closed when the run goroutine returns
 
 	// running state
 	currentIter      int
 	maxIterations    int
 	agentOutput      []string
 	validationOutput string
+	testSummary      string // parsed test counts of the last validation
+	stages           []runner.StageResult
 	agentError       string
+	warnings         []string
 	status           string
+	confirm          *confirmMsg // question waiting for y/n, if any
 
 	// done state
 	runSuccess   bool
@@ -124,21 +114,80 @@ type model struct {
 }
 
 // NewModel creates a TUI model. send is program.Send; set before Run().
-func NewModel(cfg *config.Config, maxIter int) *model {
-	return &model{
+// load applies a profile of cfg; with it, ctrl+p picks the profile to run
+// with.
+func NewModel(cfg *config.Config, h harness.Harness, maxIter int, load runner.ProfileLoader) *model {
+	m := &model{
 		mode:        ModeTask,
 		input:       "",
 		state:       stateInput,
 		cfg:         cfg,
+		harness:     h,
 		maxIter:     maxIter,
+		load:        load,
 		agentOutput: make([]string, 0),
 	}
+	if load != nil && len(cfg.Profiles) > 0 {
+		if cfg.Profile == "" {
+			m.profiles = append(m.profiles, "")
+		}
+		for name := range cfg.Profiles {
+			m.profiles = append(m.profiles, name)
+		}
+		sort.Strings(m.profiles)
+		for i, name := range m.profiles {
+			if name == cfg.Profile {
+				m.profile = i
+			}
+		}
+	}
+	return m
+}
+
+// selectedProfile returns the profile picked with ctrl+p, if any.
+func (m *model) selectedProfile() Profiles {
+	p := Profiles{Load: m.load}
+	if len(m.profiles) > 0 {
+		p.Selected = m.profiles[m.profile]
+	}
+	return p
 }
 
 func (m *model) setSend(send func(tea.Msg)) {
 	m.send = send
 }
 
+// start launches the run goroutine for input with a cancellable context.
+func (m *model) start(in string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	m.cancel = cancel
+	m.done = done
+	mode := m.runMode
+	profiles := m.selectedProfile()
+	go func() {
+		defer close(done)
+		if mode == ModeTask {
+			RunTaskInTUI(ctx, m.send, m.cfg, m.harness, m.maxIter, profiles, in)
+		} else {
+			RunPRDInTUI(ctx, m.send, m.cfg, m.harness, m.maxIter, profiles, in)
+		}
+	}()
+}
+
+// stop cancels the current run (if any) and waits for its goroutine, so
+// agent and validation processes are gone before the TUI exits. It must not
+// be called from Update: the goroutine may be blocked in send until the
+// program loop has stopped.
+func (m *model) stop() {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+	m.cancel = nil
+}
+
 func (m *model) Init() tea.Cmd {
 	return nil
 }
@@ -150,9 +199,9 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 		return m, nil
 
-	case iterationStartMsg:
-		m.currentIter = msg.iter
-		m.maxIterations = msg.maxIter
+	case runner.IterationStart:
+		m.currentIter = msg.Iteration
+		m.maxIterations = msg.MaxIterations
 		m.status = "running agent"
 		m.agentOutput = nil
 		m.agentError = ""
@@ -162,41 +211,112 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case iterationTickMsg:
 		return m, nil
 
-	case agentOutputMsg:
-		m.agentOutput = append(m.agentOutput, msg.line)
+	case runner.AgentLine:
+		m.agentOutput = append(m.agentOutput, msg.Line)
 		if len(m.agentOutput) > 100 {
 			m.agentOutput = m.agentOutput[len(m.agentOutput)-100:]
 		}
 		return m, nil
 
-	case agentErrorMsg:
-		m.agentError = msg.err
+	case runner.AgentExit:
+		if msg.Err != nil {
+			m.agentError = msg.Err.Error()
+		}
 		return m, nil
 
-	case validationStartMsg:
+	case runner.ValidationStart:
 		m.status = "validating"
+		m.stages = nil
+		return m, nil
+
+	case runner.StageStart:
+		if msg.Total > 1 {
+			m.status = fmt.Sprintf("validating %d/%d: %s", msg.Index, msg.Total, msg.Name)
+		}
+		return m, nil
+
+	case runner.StageResult:
+		m.stages = append(m.stages, msg)
+		return m, nil
+
+	case confirmMsg:
+		m.confirm = &msg
+		return m, nil
+
+	case runner.Baseline:
+		m.testSummary = msg.Result.TestSummary()
+		if msg.Skipped {
+			m.warnings = append(m.warnings, "Validation already passes, task skipped")
+		}
+		return m, nil
+
+	case runner.IntegrityViolation:
+		if msg.Accepted {
+			m.warnings = append(m.warnings, "Test changes accepted: "+strings.Join(msg.Issues, "; "))
+		} else {
+			m.status = "tests removed or skipped"
+		}
+		return m, nil
+
+	case runner.GuardViolation:
+		warning := "Agent changed protected files: " + strings.Join(msg.Changes, ", ")
+		switch {
+		case msg.Err != nil:
+			warning += fmt.Sprintf(" (revert failed: %v)", msg.Err)
+		case msg.Reverted:
+			warning += " (reverted)"
+		}
+		m.warnings = append(m.warnings, warning)
+		return m, nil
+
+	case runner.NoProgress:
+		m.status = fmt.Sprintf("no progress for %d iteration(s) (giving up at %d)", msg.Iterations, msg.Patience)
 		return m, nil
 
-	case validationResultMsg:
-		m.validationOutput = msg.output
-		if msg.success {
+	case runner.ValidationResult:
+		m.validationOutput = msg.Output
+		m.testSummary = msg.TestSummary()
+		if msg.Success {
 			m.status = "success"
+			if len(msg.KnownFailures) > 0 {
+				m.warnings = append(m.warnings, "Ignored failures present before the task: "+strings.Join(msg.KnownFailures, ", "))
+			}
+		} else if msg.Err != nil {
+			m.status = msg.Err.Error()
 		} else {
 			m.status = "validation failed"
 		}
 		return m, nil
 
-	case runCompleteMsg:
-		m.runSuccess = msg.success
-		m.runErr = msg.errMsg
+	case runner.RunComplete:
+		m.runSuccess = msg.Err == nil
+		m.runErr = ""
+		if msg.Err != nil {
+			m.runErr = msg.Err.Error()
+		}
 		m.state = stateDone
 		m.scrollOffset = 0
 		return m, nil
 
-	case prdTaskStartMsg:
-		m.prdCurrent = msg.current
-		m.prdTotal = msg.total
-		m.prdTitle = msg.title
+	case runner.TaskStart:
+		if m.runMode == ModePRD {
+			m.prdCurrent = msg.Index
+			m.prdTotal = msg.Total
+			m.prdTitle = msg.Title
+		}
+		m.taskProfile = msg.Profile
+		return m, nil
+
+	case runner.Warning:
+		m.warnings = append(m.warnings, msg.Message)
+		return m, nil
+
+	case runner.RolledBack:
+		if msg.Err != nil {
+			m.warnings = append(m.warnings, fmt.Sprintf("Rollback to %s failed: %v", msg.Name, msg.Err))
+		} else {
+			m.warnings = append(m.warnings, "Rolled back working tree to checkpoint "+msg.Name)
+		}
 		return m, nil
 
 	case tea.KeyMsg:
@@ -212,7 +332,10 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.runErr = ""
 				m.agentOutput = nil
 				m.validationOutput = ""
+				m.testSummary = ""
+				m.warnings = nil
 				m.prdTitle = ""
+				m.prdTotal = 0
 				m.scrollOffset = 0
 				return m, nil
 			case "q", "ctrl+c":
@@ -228,8 +351,17 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 		}
-		// running: only allow quit
+		// running: answer a question, or quit (cancelling the run first; Run waits for it)
+		if m.confirm != nil {
+			switch s {
+			case "y", "n", "esc":
+				m.confirm.answer <- s == "y"
+				m.confirm = nil
+				return m, nil
+			}
+		}
 		if s == "q" || s == "ctrl+c" {
+			m.cancel()
 			return m, tea.Quit
 		}
 		return m, nil
@@ -240,6 +372,12 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m *model) handleInputKey(s string) (tea.Model, tea.Cmd) {
 	switch s {
+	case "ctrl+p":
+		if len(m.profiles) > 0 {
+			m.profile = (m.profile + 1) % len(m.profiles)
+		}
+		return m, nil
+
 	case "tab", "left", "right":
 		if m.mode == ModeTask {
 			m.mode = ModePRD
@@ -265,13 +403,10 @@ func (m *model) handleInputKey(s string) (tea.Model, tea.Cmd) {
 		m.maxIterations = m.maxIter
 		m.agentOutput = nil
 		m.validationOutput = ""
+		m.testSummary = ""
 		m.agentError = ""
 		m.status = "starting..."
-		if m.runMode == ModeTask {
-			go RunTaskInTUI(m.send, m.cfg, m.maxIter, in)
-		} else {
-			go RunPRDInTUI(m.send, m.cfg, m.maxIter, in)
-		}
+		m.start(in)
 		return m, nil
 
 	case "q", "ctrl+c":
@@ -322,6 +457,15 @@ func (m *model) viewInput() string {
 		sections = append(sections, helpStyle.Render("Default: prd.md"))
 	}
 	sections = append(sections, helpStyle.Render("Tab to switch mode"))
+	if len(m.profiles) > 0 {
+		profile := m.profiles[m.profile]
+		if profile == "" {
+			profile = "none"
+		}
+		sections = append(sections, "")
+		sections = append(sections, labelStyle.Render("Profile: ")+profile)
+		sections = append(sections, helpStyle.Render("Ctrl+P to switch profile"))
+	}
 	sections = append(sections, "")
 	sections = append(sections, "  "+m.input+"▌")
 	sections = append(sections, "")
@@ -340,6 +484,9 @@ func (m *model) viewRunning() string {
 	}
 	iterLine := fmt.Sprintf("🔁 Iteration %d/%d • %s", m.currentIter, m.maxIterations, m.status)
 	sections = append(sections, titleStyle.Render(iterLine))
+	if m.taskProfile != "" {
+		sections = append(sections, helpStyle.Render("Profile: "+m.taskProfile))
+	}
 	sections = append(sections, "")
 	if m.agentError != "" {
 		sections = append(sections, errorStyle.Render("Agent error: "+m.agentError))
@@ -354,6 +501,12 @@ func (m *model) viewRunning() string {
 		sections = append(sections, outputBoxStyle.Width(m.width-4).Render("Agent output:\n"+lines))
 		sections = append(sections, "")
 	}
+	if line := m.stageSummary(); line != "" {
+		sections = append(sections, line)
+	}
+	if m.testSummary != "" {
+		sections = append(sections, labelStyle.Render("Tests:")+" "+m.testSummary)
+	}
 	if m.validationOutput != "" {
 		valLines := m.validationOutput
 		if len(valLines) > 500 {
@@ -362,7 +515,12 @@ func (m *model) viewRunning() string {
 		sections = append(sections, outputBoxStyle.Width(m.width-4).Render("Validation:\n"+valLines))
 	}
 	sections = append(sections, "")
-	sections = append(sections, helpStyle.Render("q to quit"))
+	if m.confirm != nil {
+		sections = append(sections, outputBoxStyle.Width(m.width-4).Render(m.confirm.question))
+		sections = append(sections, helpStyle.Render("y to accept • n to reject • q to quit"))
+	} else {
+		sections = append(sections, helpStyle.Render("q to quit"))
+	}
 	content := lipgloss.JoinVertical(lipgloss.Left, sections...)
 	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, content)
 }
@@ -388,13 +546,19 @@ func (m *model) viewDone() string {
 		sections = append(sections, outputBoxStyle.Width(m.width-4).Render("Agent output:\n"+agentLines))
 		sections = append(sections, "")
 	}
+	if line := m.stageSummary(); line != "" {
+		sections = append(sections, line)
+	}
+	if m.testSummary != "" {
+		sections = append(sections, labelStyle.Render("Tests:")+" "+m.testSummary)
+	}
 	if m.validationOutput != "" {
 		sections = append(sections, outputBoxStyle.Width(m.width-4).Render("Validation:\n"+m.validationOutput))
 	}
 	// Join and split into lines for scrolling (output only; footer is fixed below)
 	fullOutput := lipgloss.JoinVertical(lipgloss.Left, sections...)
 	lines := strings.Split(fullOutput, "\n")
-	footerHeight := 4
+	footerHeight := 4 + len(m.warnings)
 	visibleHeight := m.height - footerHeight
 	if visibleHeight < 1 {
 		visibleHeight = 1
@@ -422,6 +586,9 @@ func (m *model) viewDone() string {
 	// Fixed footer: result + key bindings
 	var footer []string
 	footer = append(footer, "")
+	for _, w := range m.warnings {
+		footer = append(footer, errorStyle.Render("⚠️  "+w))
+	}
 	if m.runSuccess {
 		footer = append(footer, successStyle.Render("✅ Done"))
 	} else {
@@ -432,11 +599,32 @@ func (m *model) viewDone() string {
 	return lipgloss.Place(m.width, m.height, lipgloss.Left, lipgloss.Top, content)
 }
 
+// stageSummary renders the per-stage results of a multi-stage validation
+// on one line, e.g. "✅ build  ❌ test  ⏭ lint". Empty for a single stage.
+func (m *model) stageSummary() string {
+	if len(m.stages) < 2 {
+		return ""
+	}
+	var parts []string
+	for _, s := range m.stages {
+		switch {
+		case s.Skipped:
+			parts = append(parts, helpStyle.Render("⏭ "+s.Name))
+		case s.Success:
+			parts = append(parts, successStyle.Render("✅ "+s.Name))
+		default:
+			parts = append(parts, errorStyle.Render("❌ "+s.Name))
+		}
+	}
+	return labelStyle.Render("Stages:") + " " + strings.Join(parts, "  ")
+}
+
 // Run starts the TUI. Config must be loaded; execution happens inside the TUI.
-func Run(cfg *config.Config, maxIter int) error {
-	m := NewModel(cfg, maxIter)
+func Run(cfg *config.Config, h harness.Harness, maxIter int, load runner.ProfileLoader) error {
+	m := NewModel(cfg, h, maxIter, load)
 	p := tea.NewProgram(m, tea.WithAltScreen())
 	m.setSend(p.Send)
 	_, err := p.Run()
+	m.stop()
 	return err
 }
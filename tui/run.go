@@ -1,115 +1,83 @@
 package tui
 
 import (
-	"bufio"
+	"context"
 	"fmt"
-	"io"
-	"os/exec"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/jack/tatsu/config"
 	"github.com/jack/tatsu/harness"
+	"github.com/jack/tatsu/journal"
 	"github.com/jack/tatsu/prd"
 	"github.com/jack/tatsu/runner"
 )
 
-// RunTaskInTUI runs a single task and sends progress messages to the TUI.
-// send is program.Send; call from a goroutine.
-func RunTaskInTUI(send func(tea.Msg), cfg *config.Config, maxIter int, task string) {
-	for i := 1; i <= maxIter; i++ {
-		send(iterationStartMsg{iter: i, maxIter: maxIter})
-
-		// Run agent
-		if err := runAgentCapture(send, cfg, task); err != nil {
-			send(agentErrorMsg{err: err.Error()})
-		}
-
-		// Validate
-		send(validationStartMsg{})
-		success, output := runValidate(cfg)
-		send(validationResultMsg{success: success, output: output})
-
-		if success {
-			send(runCompleteMsg{success: true})
-			return
-		}
-	}
-	send(runCompleteMsg{success: false, errMsg: "max iterations reached"})
+// Profiles are the named profiles of a config that the TUI can run with.
+type Profiles struct {
+	// Selected is the profile to run with; empty means the config as loaded.
+	Selected string
+	// Load returns the config with a profile applied; nil disables
+	// profiles.
+	Load runner.ProfileLoader
 }
 
-// RunPRDInTUI runs a PRD file and sends progress messages to the TUI.
-func RunPRDInTUI(send func(tea.Msg), cfg *config.Config, maxIter int, prdPath string) {
-	doc, err := prd.LoadPRD(prdPath)
-	if err != nil {
-		send(runCompleteMsg{success: false, errMsg: err.Error()})
-		return
-	}
-	incomplete := doc.IncompleteTasks()
-	if len(incomplete) == 0 {
-		send(runCompleteMsg{success: true})
-		return
-	}
-
-	for idx, task := range incomplete {
-		send(prdTaskStartMsg{current: idx + 1, total: len(incomplete), title: task.Title})
-		if err := runTaskLoop(send, cfg, maxIter, task.Title); err != nil {
-			send(runCompleteMsg{success: false, errMsg: err.Error()})
-			return
-		}
-		// Mark task complete in PRD file
-		if task.LineNum > 0 {
-			if err := prd.MarkTaskCompleteInFile(prdPath, task.LineNum); err != nil {
-				_ = err // log but don't fail - task completed successfully
+// newRunner creates a runner whose events are forwarded to the TUI as
+// messages and recorded in the run journal. send is program.Send. It is
+// nil if the selected profile cannot be used; the error is sent as
+// RunComplete.
+func newRunner(send func(tea.Msg), cfg *config.Config, h harness.Harness, maxIter int, profiles Profiles) *runner.Runner {
+	r := runner.NewWithMaxIterations(cfg, h, maxIter)
+	r.Subscribe(runner.SinkFunc(func(e runner.Event) { send(e) }))
+	if profiles.Load != nil {
+		r.SetProfiles(profiles.Load)
+		if profiles.Selected != "" && profiles.Selected != cfg.Profile {
+			if err := r.UseProfile(profiles.Selected); err != nil {
+				send(runner.RunComplete{Err: err})
+				return nil
 			}
 		}
 	}
-	send(runCompleteMsg{success: true})
-}
-
-func runTaskLoop(send func(tea.Msg), cfg *config.Config, maxIter int, task string) error {
-	for i := 1; i <= maxIter; i++ {
-		send(iterationStartMsg{iter: i, maxIter: maxIter})
-		if err := runAgentCapture(send, cfg, task); err != nil {
-			send(agentErrorMsg{err: err.Error()})
-		}
-		send(validationStartMsg{})
-		success, output := runValidate(cfg)
-		send(validationResultMsg{success: success, output: output})
-		if success {
-			return nil
+	r.SetConfirm(func(ctx context.Context, question string) bool {
+		answer := make(chan bool, 1)
+		send(confirmMsg{question: question, answer: answer})
+		select {
+		case ok := <-answer:
+			return ok
+		case <-ctx.Done():
+			return false
 		}
+	})
+	for _, note := range harness.PolicyNotes(r.Harness(), r.Config()) {
+		send(runner.Warning{Message: note})
 	}
-	return fmt.Errorf("max iterations reached")
-}
-
-func runAgentCapture(send func(tea.Msg), cfg *config.Config, task string) error {
-	cmdStr := fmt.Sprintf(cfg.Agent.Command, runner.EscapeTask(task))
-	c := exec.Command("bash", "-c", cmdStr)
-	c.Env = harness.AgentEnv()
-	stdout, _ := c.StdoutPipe()
-	stderr, _ := c.StderrPipe()
-	if err := c.Start(); err != nil {
-		return err
+	if j, err := journal.Open("", r.RunID(), r.Config()); err != nil {
+		send(runner.Warning{Message: fmt.Sprintf("run journal disabled: %v", err)})
+	} else {
+		r.Subscribe(j)
 	}
-	go captureLines(send, stdout)
-	go captureLines(send, stderr)
-	return c.Wait()
+	return r
 }
 
-func captureLines(send func(tea.Msg), r io.ReadCloser) {
-	defer r.Close()
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		send(agentOutputMsg{line: scanner.Text()})
+// RunTaskInTUI runs a single task and sends progress events to the TUI.
+// send is program.Send; call from a goroutine.
+func RunTaskInTUI(ctx context.Context, send func(tea.Msg), cfg *config.Config, h harness.Harness, maxIter int, profiles Profiles, task string) {
+	r := newRunner(send, cfg, h, maxIter, profiles)
+	if r == nil {
+		return
 	}
+	_ = r.Run(ctx, task) // reported via RunComplete
 }
 
-func runValidate(cfg *config.Config) (bool, string) {
-	c := exec.Command("bash", "-c", cfg.Validate.Command)
-	out, err := c.CombinedOutput()
-	s := string(out)
+// RunPRDInTUI runs a PRD file and sends progress events to the TUI.
+func RunPRDInTUI(ctx context.Context, send func(tea.Msg), cfg *config.Config, h harness.Harness, maxIter int, profiles Profiles, prdPath string) {
+	doc, err := prd.LoadPRD(prdPath)
 	if err != nil {
-		return false, s
+		send(runner.RunComplete{Err: err})
+		return
+	}
+	r := newRunner(send, cfg, h, maxIter, profiles)
+	if r == nil {
+		return
 	}
-	return true, s
+	_ = prd.NewExecutor(r).ExecutePRD(ctx, doc, prdPath) // reported via RunComplete
 }